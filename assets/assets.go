@@ -0,0 +1,181 @@
+// Package assets fingerprints and precompresses the static files of an application, and
+// serves them with the right encoding and cache headers.
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// BuildDir is the folder, inside the public folder, that Build writes to
+const BuildDir = "build"
+
+// ManifestFile is the name of the manifest Build writes in BuildDir
+const ManifestFile = "manifest.json"
+
+// minCompressSize is the smallest file that is worth compressing
+const minCompressSize = 256
+
+// compressible lists the extensions of files which are precompressed. Images, fonts and
+// archives are compressed already.
+var compressible = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".mjs":  true,
+	".map":  true,
+	".json": true,
+	".svg":  true,
+	".html": true,
+	".txt":  true,
+	".xml":  true,
+	".wasm": true,
+	".ico":  true,
+}
+
+// Manifest maps the path of every asset in the public folder, such as css/app.css, to
+// the path of its fingerprinted copy, such as build/css/app.3f9a1c.css
+type Manifest map[string]string
+
+// Build copies every file in publicDir to publicDir/build, with a hash of its contents in
+// its name, writes gzip and brotli compressed variants of the files worth compressing,
+// and writes the manifest to publicDir/build/manifest.json. Anything previously in the
+// build folder is removed first.
+func Build(publicDir string) (Manifest, error) {
+	buildDir := filepath.Join(publicDir, BuildDir)
+	if err := os.RemoveAll(buildDir); err != nil {
+		return nil, err
+	}
+
+	manifest := make(Manifest)
+	err := filepath.WalkDir(publicDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if file == buildDir || (file != publicDir && strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := filepath.Ext(file)
+		if strings.HasPrefix(d.Name(), ".") || ext == ".gz" || ext == ".br" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(publicDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		fingerprinted, err := buildFile(file, filepath.Join(buildDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+
+		manifest[rel] = path.Join(BuildDir, path.Dir(rel), filepath.Base(fingerprinted))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(buildDir, 0755); err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(filepath.Join(buildDir, ManifestFile), data, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// buildFile writes the fingerprinted copy of file, and its compressed variants, next to
+// dest, and returns the name of the copy
+func buildFile(file, dest string) (string, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(contents)
+	ext := filepath.Ext(dest)
+	fingerprinted := strings.TrimSuffix(dest, ext) + "." + hex.EncodeToString(sum[:])[:6] + ext
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+
+	if err = os.WriteFile(fingerprinted, contents, 0644); err != nil {
+		return "", err
+	}
+
+	if !compressible[strings.ToLower(ext)] || len(contents) < minCompressSize {
+		return fingerprinted, nil
+	}
+
+	var gz bytes.Buffer
+	gw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	_, _ = gw.Write(contents)
+	if err = gw.Close(); err != nil {
+		return "", err
+	}
+
+	var br bytes.Buffer
+	bw := brotli.NewWriterLevel(&br, brotli.BestCompression)
+	_, _ = bw.Write(contents)
+	if err = bw.Close(); err != nil {
+		return "", err
+	}
+
+	// a compressed variant that is not smaller is of no use
+	for suffix, compressed := range map[string][]byte{".gz": gz.Bytes(), ".br": br.Bytes()} {
+		if len(compressed) >= len(contents) {
+			continue
+		}
+
+		if err = os.WriteFile(fingerprinted+suffix, compressed, 0644); err != nil {
+			return "", err
+		}
+	}
+
+	return fingerprinted, nil
+}
+
+// LoadManifest reads the manifest written by Build in publicDir. If assets have not been
+// built, the manifest is empty.
+func LoadManifest(publicDir string) (Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(publicDir, BuildDir, ManifestFile))
+	if os.IsNotExist(err) {
+		return Manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(Manifest)
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,66 @@
+package assets
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	public := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(public, "css"), 0755)
+	_ = os.WriteFile(filepath.Join(public, "css", "app.css"), []byte(strings.Repeat("body { color: red; }\n", 50)), 0644)
+	_ = os.WriteFile(filepath.Join(public, "logo.png"), []byte("not really a png"), 0644)
+	_ = os.WriteFile(filepath.Join(public, ".gitkeep"), nil, 0644)
+
+	manifest, err := Build(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest) != 2 {
+		t.Fatal("expected 2 assets in the manifest, got", manifest)
+	}
+
+	css := manifest["css/app.css"]
+	if !regexp.MustCompile(`^build/css/app\.[0-9a-f]{6}\.css$`).MatchString(css) {
+		t.Error("wrong fingerprinted name:", css)
+	}
+
+	for _, suffix := range []string{"", ".gz", ".br"} {
+		if _, err := os.Stat(filepath.Join(public, filepath.FromSlash(css)+suffix)); err != nil {
+			t.Error("missing built file:", css+suffix)
+		}
+	}
+
+	png := filepath.Join(public, filepath.FromSlash(manifest["logo.png"]))
+	if _, err := os.Stat(png + ".gz"); err == nil {
+		t.Error("image was compressed")
+	}
+
+	loaded, err := LoadManifest(public)
+	if err != nil {
+		t.Error(err)
+	}
+	if loaded["css/app.css"] != css {
+		t.Error("manifest was not written:", loaded)
+	}
+
+	// building again must not pick up the previous build
+	manifest, err = Build(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 2 {
+		t.Error("previous build was included:", manifest)
+	}
+}
+
+func TestLoadManifest_NotBuilt(t *testing.T) {
+	manifest, err := LoadManifest(t.TempDir())
+	if err != nil || len(manifest) != 0 {
+		t.Error("expected an empty manifest, got", manifest, err)
+	}
+}
@@ -0,0 +1,101 @@
+package assets
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// encodings are the precompressed variants FileServer looks for, in order of preference
+var encodings = []struct {
+	name   string
+	suffix string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// FileServer returns a handler which serves the files in publicDir. When the client
+// accepts brotli or gzip and a precompressed variant of the file exists, the variant is
+// served instead. Fingerprinted files, in the build folder, never change, so they are
+// cached by browsers for a year; other files must be revalidated.
+func FileServer(publicDir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := path.Clean("/" + r.URL.Path)
+		file := filepath.Join(publicDir, filepath.FromSlash(name))
+
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		if strings.HasPrefix(name, "/"+BuildDir+"/") {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+
+		accepted := r.Header.Get("Accept-Encoding")
+		for _, encoding := range encodings {
+			if !acceptsEncoding(accepted, encoding.name) {
+				continue
+			}
+
+			variant := file + encoding.suffix
+			if vinfo, err := os.Stat(variant); err == nil && !vinfo.IsDir() {
+				w.Header().Set("Content-Encoding", encoding.name)
+				serveFile(w, r, variant, vinfo)
+				return
+			}
+		}
+
+		serveFile(w, r, file, info)
+	})
+}
+
+// serveFile sends file, handling conditional and range requests
+func serveFile(w http.ResponseWriter, r *http.Request, file string, info os.FileInfo) {
+	f, err := os.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows encoding
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), encoding) {
+			continue
+		}
+
+		for _, param := range fields[1:] {
+			param = strings.ReplaceAll(param, " ", "")
+			if param == "q=0" || param == "q=0.0" || param == "q=0.00" || param == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
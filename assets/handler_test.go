@@ -0,0 +1,64 @@
+package assets
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileServer(t *testing.T) {
+	public := t.TempDir()
+	_ = os.WriteFile(filepath.Join(public, "app.js"), []byte(strings.Repeat("console.log('hello');\n", 50)), 0644)
+
+	manifest, err := Build(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := FileServer(public)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		encoding       string
+		cacheControl   string
+	}{
+		{"brotli", "/" + manifest["app.js"], "gzip, deflate, br", "br", "public, max-age=31536000, immutable"},
+		{"gzip", "/" + manifest["app.js"], "gzip", "gzip", "public, max-age=31536000, immutable"},
+		{"brotli refused", "/" + manifest["app.js"], "gzip, br;q=0", "gzip", "public, max-age=31536000, immutable"},
+		{"identity", "/" + manifest["app.js"], "", "", "public, max-age=31536000, immutable"},
+		{"not fingerprinted", "/app.js", "gzip, br", "", "no-cache"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		rr := httptest.NewRecorder()
+		fs.ServeHTTP(rr, req)
+
+		if rr.Code != 200 {
+			t.Errorf("%s: expected status 200, got %d", test.name, rr.Code)
+			continue
+		}
+		if got := rr.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s: expected encoding %q, got %q", test.name, test.encoding, got)
+		}
+		if got := rr.Header().Get("Cache-Control"); got != test.cacheControl {
+			t.Errorf("%s: expected Cache-Control %q, got %q", test.name, test.cacheControl, got)
+		}
+		if got := rr.Header().Get("Content-Type"); !strings.Contains(got, "javascript") {
+			t.Errorf("%s: wrong Content-Type %q", test.name, got)
+		}
+	}
+
+	for _, path := range []string{"/missing.js", "/../etc/passwd", "/"} {
+		rr := httptest.NewRecorder()
+		fs.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != 404 {
+			t.Errorf("%s: expected status 404, got %d", path, rr.Code)
+		}
+	}
+}
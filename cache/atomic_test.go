@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func atomicTestCaches() map[string]Cache {
+	return map[string]Cache{
+		"redis":  &testRedisCache,
+		"badger": &testBadgerCache,
+		"memory": NewMemoryCache(100, 0),
+		"tiered": NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60),
+	}
+}
+
+func TestCache_Increment(t *testing.T) {
+	for name, c := range atomicTestCaches() {
+		_ = c.Empty()
+
+		n, err := c.Increment("hits", 1, 60)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		if n != 1 {
+			t.Errorf("%s: expected 1 after first increment, got %d", name, n)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := c.Increment("hits", 2); err != nil {
+					t.Errorf("%s: %s", name, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		n, err = c.Decrement("hits", 1)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		if n != 40 {
+			t.Errorf("%s: expected 40 after concurrent increments, got %d", name, n)
+		}
+
+		x, err := c.Get("hits")
+		if err != nil || x != int64(40) {
+			t.Errorf("%s: did not get counter from cache: %v %v", name, x, err)
+		}
+
+		_ = c.Set("not-a-counter", "value")
+		_, err = c.Increment("not-a-counter", 1)
+		if !errors.Is(err, ErrNotCounter) {
+			t.Errorf("%s: expected ErrNotCounter incrementing a value that is not a counter, got %v", name, err)
+		}
+	}
+}
+
+func TestCache_Add(t *testing.T) {
+	for name, c := range atomicTestCaches() {
+		_ = c.Empty()
+
+		ok, err := c.Add("job:1", "first")
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		if !ok {
+			t.Errorf("%s: add to empty key was not stored", name)
+		}
+
+		ok, _ = c.Add("job:1", "second")
+		if ok {
+			t.Errorf("%s: add to existing key was stored", name)
+		}
+
+		x, _ := c.Get("job:1")
+		if x != "first" {
+			t.Errorf("%s: expected first, got %v", name, x)
+		}
+	}
+}
+
+func TestCache_GetManySetMany(t *testing.T) {
+	for name, c := range atomicTestCaches() {
+		_ = c.Empty()
+
+		err := c.SetMany(map[string]interface{}{"a": "alpha", "b": "beta"}, 60)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		items, err := c.GetMany("a", "b", "missing")
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		if len(items) != 2 || items["a"] != "alpha" || items["b"] != "beta" {
+			t.Errorf("%s: wrong items returned: %v", name, items)
+		}
+
+		if _, ok := items["missing"]; ok {
+			t.Errorf("%s: missing key included in result", name)
+		}
+	}
+}
+
+func TestCache_CompareAndSwap(t *testing.T) {
+	for name, c := range atomicTestCaches() {
+		_ = c.Empty()
+
+		_ = c.Set("version", "v1")
+
+		ok, err := c.CompareAndSwap("version", "v0", "v2")
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		if ok {
+			t.Errorf("%s: swapped although the old value did not match", name)
+		}
+
+		ok, err = c.CompareAndSwap("version", "v1", "v2", 60)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		if !ok {
+			t.Errorf("%s: did not swap although the old value matched", name)
+		}
+
+		x, _ := c.Get("version")
+		if x != "v2" {
+			t.Errorf("%s: expected v2, got %v", name, x)
+		}
+
+		ok, _ = c.CompareAndSwap("absent", nil, "created")
+		if !ok {
+			t.Errorf("%s: did not store absent key with nil old value", name)
+		}
+	}
+}
+
+func TestCache_CompareAndSwapCodecs(t *testing.T) {
+	stock := map[string]int{"kettle": 3, "toaster": 5, "blender": 1, "mixer": 8}
+	gob.Register(stock)
+
+	for _, codec := range []Codec{Gob, JSON, Msgpack} {
+		redisCache := testRedisCache
+		redisCache.Encoding = Encoding{Codec: codec}
+		badgerCache := testBadgerCache
+		badgerCache.Encoding = Encoding{Codec: codec}
+
+		for name, c := range map[string]Cache{"redis": &redisCache, "badger": &badgerCache} {
+			if err := c.Set("stock", stock); err != nil {
+				t.Errorf("%s, codec %d: %s", name, codec, err)
+			}
+
+			ok, err := c.CompareAndSwap("stock", map[string]int{"kettle": 3, "toaster": 5, "blender": 1, "mixer": 8}, 1)
+			if err != nil || !ok {
+				t.Errorf("%s, codec %d: did not swap a map equal to the stored one: %v %v", name, codec, ok, err)
+			}
+
+			ok, err = c.CompareAndSwap("stock", 2, 3)
+			if err != nil || ok {
+				t.Errorf("%s, codec %d: swapped although the old value did not match: %v %v", name, codec, ok, err)
+			}
+		}
+	}
+}
@@ -1,14 +1,17 @@
 package cache
 
 import (
+	"bytes"
+	"strconv"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 )
 
 type BadgerCache struct {
-	Conn   *badger.DB
-	Prefix string
+	Conn     *badger.DB
+	Prefix   string
+	Encoding Encoding
 }
 
 func (b *BadgerCache) Has(s string) (bool, error) {
@@ -21,6 +24,27 @@ func (b *BadgerCache) Has(s string) (bool, error) {
 }
 
 func (b *BadgerCache) Get(s string) (interface{}, error) {
+	fromCache, err := b.get(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeValue(s, fromCache)
+}
+
+// getInto gets an item from the cache into target, a pointer, decoding it into the type
+// target points to
+func (b *BadgerCache) getInto(s string, target interface{}) error {
+	fromCache, err := b.get(s)
+	if err != nil {
+		return err
+	}
+
+	return decodeValueInto(s, fromCache, target)
+}
+
+// get returns the encoded value stored at s
+func (b *BadgerCache) get(s string) ([]byte, error) {
 	var fromCache []byte
 
 	err := b.Conn.View(func(txn *badger.Txn) error {
@@ -39,49 +63,327 @@ func (b *BadgerCache) Get(s string) (interface{}, error) {
 
 		return nil
 	})
-	if err != nil {
-		return nil, err
-	}
 
-	decoded, err := decode(string(fromCache))
+	return fromCache, err
+}
+
+func (b *BadgerCache) Set(s string, value interface{}, expires ...int) error {
+	return b.SetWithTags(s, value, nil, expires...)
+}
+
+// SetWithTags stores value like Set, and adds an index entry for each of tags, with the
+// same expiry, so that it is removed by FlushTags. The index entries of tags s was stored
+// with before are removed, so that FlushTags only removes s for its current tags.
+func (b *BadgerCache) SetWithTags(s string, value interface{}, tags []string, expires ...int) error {
+	encoded, err := b.Encoding.encode(value)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	item := decoded[s]
+	err = b.update(func(txn *badger.Txn) error {
+		if err := deleteTagEntries(txn, s); err != nil {
+			return err
+		}
+
+		entries := []*badger.Entry{badger.NewEntry([]byte(s), encoded)}
+		for _, tag := range tags {
+			entries = append(entries,
+				badger.NewEntry(tagIndexKey(tag, s), nil),
+				badger.NewEntry(keyTagKey(s, tag), nil),
+			)
+		}
+
+		for _, e := range entries {
+			if len(expires) > 0 {
+				e = e.WithTTL(time.Second * time.Duration(expires[0]))
+			}
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 
-	return item, nil
+	return err
 }
 
-func (b *BadgerCache) Set(s string, value interface{}, expires ...int) error {
-	entry := Entry{}
-	entry[s] = value
-	encoded, err := encode(entry)
+// FlushTags removes every entry that was stored with any of tags, along with their index
+// entries for other tags. Only the index entries are read, not the whole keyspace.
+func (b *BadgerCache) FlushTags(tags ...string) error {
+	var keysForDelete [][]byte
+
+	err := b.Conn.View(func(txn *badger.Txn) error {
+		var flushed []string
+		for _, tag := range tags {
+			prefix := tagIndexKey(tag, "")
+			iterateKeys(txn, prefix, func(indexKey []byte) {
+				keysForDelete = append(keysForDelete, indexKey)
+				flushed = append(flushed, string(indexKey[len(prefix):]))
+			})
+		}
+
+		for _, s := range flushed {
+			keysForDelete = append(keysForDelete, []byte(s))
+			keysForDelete = append(keysForDelete, tagEntries(txn, s)...)
+		}
+
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	if len(expires) > 0 {
-		err = b.Conn.Update(func(txn *badger.Txn) error {
-			e := badger.NewEntry([]byte(s), encoded).WithTTL(time.Second * time.Duration(expires[0]))
-			err = txn.SetEntry(e)
+	return b.deleteKeys(keysForDelete)
+}
+
+// tagEntries returns the keys of the index entries of every tag s was stored with
+func tagEntries(txn *badger.Txn, s string) [][]byte {
+	var keys [][]byte
+
+	prefix := keyTagKey(s, "")
+	iterateKeys(txn, prefix, func(key []byte) {
+		keys = append(keys, key, tagIndexKey(string(key[len(prefix):]), s))
+	})
+
+	return keys
+}
+
+// deleteTagEntries removes s from every tag it was stored with
+func deleteTagEntries(txn *badger.Txn, s string) error {
+	for _, key := range tagEntries(txn, s) {
+		if err := txn.Delete(key); err != nil {
 			return err
-		})
-	} else {
-		err = b.Conn.Update(func(txn *badger.Txn) error {
-			e := badger.NewEntry([]byte(s), encoded)
-			err = txn.SetEntry(e)
+		}
+	}
+
+	return nil
+}
+
+// iterateKeys calls fn with a copy of every key starting with prefix
+func iterateKeys(txn *badger.Txn, prefix []byte, fn func(key []byte)) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		fn(it.Item().KeyCopy(nil))
+	}
+}
+
+// deleteKeys deletes keys, in as many transactions as necessary
+func (b *BadgerCache) deleteKeys(keys [][]byte) error {
+	for len(keys) > 0 {
+		txn := b.Conn.NewTransaction(true)
+		n := 0
+		for ; n < len(keys); n++ {
+			if err := txn.Delete(keys[n]); err == badger.ErrTxnTooBig {
+				break
+			} else if err != nil {
+				txn.Discard()
+				return err
+			}
+		}
+
+		if err := txn.Commit(); err != nil {
 			return err
-		})
+		}
+		keys = keys[n:]
 	}
 
 	return nil
 }
 
+// tagIndexKey returns the key of the index entry recording that s was stored with tag
+func tagIndexKey(tag, s string) []byte {
+	return []byte("tag|" + tag + "\x00" + s)
+}
+
+// keyTagKey returns the key of the index entry recording that tag is a tag of s, so that
+// the tags of s can be found when it is stored again or forgotten
+func keyTagKey(s, tag string) []byte {
+	return []byte("tags|" + s + "\x00" + tag)
+}
+
+// Increment atomically adds delta to the counter stored at s, and returns the new value. A
+// counter that does not exist starts at zero, and expires after expires seconds, if given.
+func (b *BadgerCache) Increment(s string, delta int64, expires ...int) (int64, error) {
+	var n int64
+
+	err := b.update(func(txn *badger.Txn) error {
+		e := badger.NewEntry([]byte(s), nil)
+
+		item, err := txn.Get([]byte(s))
+		switch {
+		case err == badger.ErrKeyNotFound:
+			n = delta
+			if len(expires) > 0 {
+				e = e.WithTTL(time.Second * time.Duration(expires[0]))
+			}
+		case err != nil:
+			return err
+		default:
+			err = item.Value(func(val []byte) error {
+				current, err := strconv.ParseInt(string(val), 10, 64)
+				if err != nil {
+					return ErrNotCounter
+				}
+				n = current + delta
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			e.ExpiresAt = item.ExpiresAt()
+		}
+
+		e.Value = []byte(strconv.FormatInt(n, 10))
+		return txn.SetEntry(e)
+	})
+
+	return n, err
+}
+
+// Decrement atomically subtracts delta from the counter stored at s, and returns the new value
+func (b *BadgerCache) Decrement(s string, delta int64, expires ...int) (int64, error) {
+	return b.Increment(s, -delta, expires...)
+}
+
+// Add stores value only if s is not already in the cache, and reports whether it was stored
+func (b *BadgerCache) Add(s string, value interface{}, expires ...int) (bool, error) {
+	return b.CompareAndSwap(s, nil, value, expires...)
+}
+
+// GetMany gets several items from the cache in one transaction. Keys that are not
+// in the cache are left out of the result.
+func (b *BadgerCache) GetMany(keys ...string) (map[string]interface{}, error) {
+	items := make(map[string]interface{})
+
+	err := b.Conn.View(func(txn *badger.Txn) error {
+		for _, s := range keys {
+			item, err := txn.Get([]byte(s))
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			err = item.Value(func(val []byte) error {
+				value, err := decodeValue(s, val)
+				if err != nil {
+					return err
+				}
+				items[s] = value
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// SetMany stores several items in the cache in one transaction
+func (b *BadgerCache) SetMany(items map[string]interface{}, expires ...int) error {
+	return b.Conn.Update(func(txn *badger.Txn) error {
+		for s, value := range items {
+			encoded, err := b.Encoding.encode(value)
+			if err != nil {
+				return err
+			}
+
+			e := badger.NewEntry([]byte(s), encoded)
+			if len(expires) > 0 {
+				e = e.WithTTL(time.Second * time.Duration(expires[0]))
+			}
+
+			if err = txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// CompareAndSwap stores new only if the value stored at s is currently old, compared
+// with reflect.DeepEqual after decoding the stored value into the type of old, and
+// reports whether it was stored. If old is nil, new is only stored if s is not in the
+// cache.
+func (b *BadgerCache) CompareAndSwap(s string, old, new interface{}, expires ...int) (bool, error) {
+	newEncoded, err := b.Encoding.encode(new)
+	if err != nil {
+		return false, err
+	}
+
+	swapped := false
+	err = b.update(func(txn *badger.Txn) error {
+		swapped = false
+
+		item, err := txn.Get([]byte(s))
+		switch {
+		case err == badger.ErrKeyNotFound:
+			if old != nil {
+				return nil
+			}
+		case err != nil:
+			return err
+		default:
+			if old == nil {
+				return nil
+			}
+
+			matches := false
+			err = item.Value(func(val []byte) error {
+				matches = storedEquals(s, val, old)
+				return nil
+			})
+			if err != nil || !matches {
+				return err
+			}
+		}
+
+		e := badger.NewEntry([]byte(s), newEncoded)
+		if len(expires) > 0 {
+			e = e.WithTTL(time.Second * time.Duration(expires[0]))
+		}
+
+		swapped = true
+		return txn.SetEntry(e)
+	})
+
+	return swapped, err
+}
+
+// update runs fn in a read-write transaction, retrying when it conflicts with
+// another transaction
+func (b *BadgerCache) update(fn func(txn *badger.Txn) error) error {
+	for {
+		err := b.Conn.Update(fn)
+		if err != badger.ErrConflict {
+			return err
+		}
+	}
+}
+
+// Forget removes s from the cache, and from the tags it was stored with
 func (b *BadgerCache) Forget(s string) error {
-	err := b.Conn.Update(func(txn *badger.Txn) error {
-		err := txn.Delete([]byte(s))
-		return err
+	err := b.update(func(txn *badger.Txn) error {
+		if err := deleteTagEntries(txn, s); err != nil {
+			return err
+		}
+
+		return txn.Delete([]byte(s))
 	})
 
 	return err
@@ -91,6 +393,11 @@ func (b *BadgerCache) EmptyByMatch(s string) error {
 	return b.emptyByMatch(s)
 }
 
+// sessionKeyPrefix starts the keys of sessions, and of their index by user, kept in the
+// same badger database by the session package. Empty leaves them alone, so that emptying
+// the cache does not log everyone out.
+const sessionKeyPrefix = "scs:"
+
 func (b *BadgerCache) Empty() error {
 	return b.emptyByMatch("")
 }
@@ -126,6 +433,9 @@ func (b *BadgerCache) emptyByMatch(s string) error {
 
 		for it.Seek([]byte(s)); it.ValidForPrefix([]byte(s)); it.Next() {
 			key := it.Item().KeyCopy(nil)
+			if bytes.HasPrefix(key, []byte(sessionKeyPrefix)) || bytes.HasPrefix(key, []byte(lockKeyPrefix)) {
+				continue
+			}
 			keysForDelete = append(keysForDelete, key)
 			keysCollected++
 
@@ -147,3 +457,20 @@ func (b *BadgerCache) emptyByMatch(s string) error {
 
 	return err
 }
+
+// RunBadgerGC rewrites value log files of db in which at least discardRatio of the space
+// is taken by deleted or expired entries, until there are none left, and returns the
+// number of files rewritten
+func RunBadgerGC(db *badger.DB, discardRatio float64) (int, error) {
+	rewritten := 0
+	for {
+		err := db.RunValueLogGC(discardRatio)
+		if err == badger.ErrNoRewrite {
+			return rewritten, nil
+		}
+		if err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+}
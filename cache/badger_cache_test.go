@@ -1,6 +1,12 @@
 package cache
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+)
 
 func TestBadgerCache_Has(t *testing.T) {
 	err := testBadgerCache.Forget("foo")
@@ -139,3 +145,87 @@ func TestBadgerCache_EmptyByMatch(t *testing.T) {
 		t.Error("beta not found in cache, and it should be there")
 	}
 }
+
+func TestBadgerCache_EmptyKeepsSessions(t *testing.T) {
+	err := testBadgerCache.Conn.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(sessionKeyPrefix+"token"), []byte("session"))
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	_ = testBadgerCache.Set("foo", "bar")
+
+	err = testBadgerCache.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = testBadgerCache.Conn.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(sessionKeyPrefix + "token"))
+		return err
+	})
+	if err != nil {
+		t.Error("session was removed when the cache was emptied:", err)
+	}
+}
+
+func TestRunBadgerGC(t *testing.T) {
+	// small value log files, with every value in them, and compaction as soon as there
+	// are two tables, so that overwritten values are discarded
+	opts := badger.DefaultOptions(t.TempDir()).
+		WithLogger(nil).
+		WithValueLogFileSize(1 << 20).
+		WithValueThreshold(1 << 10).
+		WithNumLevelZeroTables(1)
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewritten, err := RunBadgerGC(db, 0.5)
+	if err != nil || rewritten != 0 {
+		t.Error("rewrote files without garbage:", rewritten, err)
+	}
+
+	value := bytes.Repeat([]byte("x"), 16<<10)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 300; i++ {
+			err := db.Update(func(txn *badger.Txn) error {
+				return txn.Set([]byte(fmt.Sprint("key", i)), value)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// closing writes the memtable to a table
+		_ = db.Close()
+		db, err = badger.Open(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer db.Close()
+
+	if err := db.Flatten(1); err != nil {
+		t.Fatal(err)
+	}
+
+	rewritten, err = RunBadgerGC(db, 0.5)
+	if err != nil {
+		t.Error(err)
+	}
+	if rewritten == 0 {
+		t.Error("no value log files rewritten after every value was overwritten")
+	}
+
+	err = db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("key299"))
+		return err
+	})
+	if err != nil {
+		t.Error("value lost by gc:", err)
+	}
+}
@@ -2,26 +2,53 @@ package cache
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/gob"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
 )
 
+// ErrCacheMiss is returned by drivers that have no error of their own when a key is not in the cache
+var ErrCacheMiss = errors.New("cache: key not found")
+
+// ErrNotCounter is returned by Increment and Decrement when the key holds a value that
+// was not created by Increment or Decrement
+var ErrNotCounter = errors.New("cache: value is not a counter")
+
 type Cache interface {
 	Has(string) (bool, error)
 	Get(string) (interface{}, error)
 	Set(string, interface{}, ...int) error
+	SetWithTags(string, interface{}, []string, ...int) error
+	FlushTags(...string) error
+	Increment(string, int64, ...int) (int64, error)
+	Decrement(string, int64, ...int) (int64, error)
+	Add(string, interface{}, ...int) (bool, error)
+	GetMany(...string) (map[string]interface{}, error)
+	SetMany(map[string]interface{}, ...int) error
+	CompareAndSwap(string, interface{}, interface{}, ...int) (bool, error)
 	Forget(string) error
 	EmptyByMatch(string) error
 	Empty() error
 }
 
+// RedisCache stores values in redis. Conn is used for a single server, or for the current
+// master of a sentinel group; when Cluster is set, it is used instead of Conn.
 type RedisCache struct {
-	Conn   *redis.Pool
-	Prefix string
+	Conn     *redis.Pool
+	Cluster  *redisc.Cluster
+	Prefix   string
+	Encoding Encoding
 }
 
+// Entry is the older format for cached values, a gob encoded map from the key to the
+// value. Values in this format are still read, but no longer written.
 type Entry map[string]interface{}
 
 func encode(item Entry) ([]byte, error) {
@@ -53,7 +80,7 @@ func decode(s string) (Entry, error) {
 
 func (c *RedisCache) Has(s string) (bool, error) {
 	key := fmt.Sprintf("%s:%s", c.Prefix, s)
-	conn := c.Conn.Get()
+	conn := c.conn(key)
 	defer conn.Close()
 
 	ok, err := redis.Bool(conn.Do("EXISTS", key))
@@ -66,7 +93,7 @@ func (c *RedisCache) Has(s string) (bool, error) {
 
 func (c *RedisCache) Get(s string) (interface{}, error) {
 	key := fmt.Sprintf("%s:%s", c.Prefix, s)
-	conn := c.Conn.Get()
+	conn := c.conn(key)
 	defer conn.Close()
 
 	cacheEntry, err := redis.Bytes(conn.Do("GET", key))
@@ -74,24 +101,30 @@ func (c *RedisCache) Get(s string) (interface{}, error) {
 		return nil, err
 	}
 
-	decoded, err := decode(string(cacheEntry))
+	return decodeValue(key, cacheEntry)
+}
+
+// getInto gets an item from the cache into target, a pointer, decoding it into the type
+// target points to
+func (c *RedisCache) getInto(s string, target interface{}) error {
+	key := fmt.Sprintf("%s:%s", c.Prefix, s)
+	conn := c.conn(key)
+	defer conn.Close()
+
+	cacheEntry, err := redis.Bytes(conn.Do("GET", key))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	item := decoded[key]
-
-	return item, nil
+	return decodeValueInto(key, cacheEntry, target)
 }
 
 func (c *RedisCache) Set(s string, value interface{}, expires ...int) error {
 	key := fmt.Sprintf("%s:%s", c.Prefix, s)
-	conn := c.Conn.Get()
+	conn := c.conn(key)
 	defer conn.Close()
 
-	entry := Entry{}
-	entry[key] = value
-	encoded, err := encode(entry)
+	encoded, err := c.Encoding.encode(value)
 	if err != nil {
 		return err
 	}
@@ -111,81 +144,430 @@ func (c *RedisCache) Set(s string, value interface{}, expires ...int) error {
 	return nil
 }
 
-func (c *RedisCache) Forget(s string) error {
+// tagScript adds ARGV[1] to the tag set KEYS[1], and keeps the set until the last of its
+// entries expires. ARGV[2] is the expiry of the entry in seconds, or 0 if it never expires.
+const tagScript = `
+local ttl = redis.call("TTL", KEYS[1])
+redis.call("SADD", KEYS[1], ARGV[1])
+local expires = tonumber(ARGV[2])
+if expires <= 0 then
+	redis.call("PERSIST", KEYS[1])
+elseif ttl == -2 or (ttl >= 0 and ttl < expires) then
+	redis.call("EXPIRE", KEYS[1], expires)
+end
+return 1`
+
+// SetWithTags stores value like Set, and adds s to each of tags, so that it is removed by
+// FlushTags. A tag set expires with the last of its entries, and the tags of s are kept
+// with it, so that Forget can remove s from them.
+func (c *RedisCache) SetWithTags(s string, value interface{}, tags []string, expires ...int) error {
 	key := fmt.Sprintf("%s:%s", c.Prefix, s)
-	conn := c.Conn.Get()
+
+	encoded, err := c.Encoding.encode(value)
+	if err != nil {
+		return err
+	}
+
+	ttl := 0
+	if len(expires) > 0 {
+		ttl = expires[0]
+	}
+
+	var cmds [][]interface{}
+	if ttl > 0 {
+		cmds = append(cmds, []interface{}{"SETEX", key, ttl, string(encoded)})
+	} else {
+		cmds = append(cmds, []interface{}{"SET", key, string(encoded)})
+	}
+
+	entryTags := []interface{}{"SADD", c.entryTagsKey(s)}
+	for _, tag := range tags {
+		cmds = append(cmds, []interface{}{"EVAL", tagScript, 1, c.tagKey(tag), s, ttl})
+		entryTags = append(entryTags, tag)
+	}
+
+	if len(tags) > 0 {
+		cmds = append(cmds, entryTags)
+		if ttl > 0 {
+			cmds = append(cmds, []interface{}{"EXPIRE", c.entryTagsKey(s), ttl})
+		} else {
+			cmds = append(cmds, []interface{}{"PERSIST", c.entryTagsKey(s)})
+		}
+	}
+
+	return c.multi(cmds)
+}
+
+// FlushTags removes every entry that was stored with any of tags
+func (c *RedisCache) FlushTags(tags ...string) error {
+	_, err := c.flushTags(tags...)
+	return err
+}
+
+// flushTags removes every entry stored with any of tags, and returns their keys. The
+// entries are also removed from the other tags they were stored with.
+func (c *RedisCache) flushTags(tags ...string) ([]string, error) {
+	var flushed []string
+	for _, tag := range tags {
+		keys, err := c.tagMembers(tag)
+		if err != nil {
+			return flushed, err
+		}
+
+		cmds, err := c.forgetCmds(keys...)
+		if err != nil {
+			return flushed, err
+		}
+		cmds = append(cmds, []interface{}{"DEL", c.tagKey(tag)})
+
+		err = c.multi(cmds)
+		if err != nil {
+			return flushed, err
+		}
+
+		flushed = append(flushed, keys...)
+	}
+
+	return flushed, nil
+}
+
+// tagMembers returns the keys stored with tag
+func (c *RedisCache) tagMembers(tag string) ([]string, error) {
+	conn := c.conn(c.tagKey(tag))
 	defer conn.Close()
 
-	_, err := conn.Do("DEL", key)
+	return redis.Strings(conn.Do("SMEMBERS", c.tagKey(tag)))
+}
+
+// tagKey returns the key of the set holding the keys stored with tag
+func (c *RedisCache) tagKey(tag string) string {
+	return fmt.Sprintf("%s:tag|%s", c.Prefix, tag)
+}
+
+// entryTagsKey returns the key of the set holding the tags s was stored with
+func (c *RedisCache) entryTagsKey(s string) string {
+	return fmt.Sprintf("%s:%s|tags", c.Prefix, s)
+}
+
+// forgetCmds returns the commands which remove the entries with keys, and remove them from
+// the tags they were stored with
+func (c *RedisCache) forgetCmds(keys ...string) ([][]interface{}, error) {
+	var cmds [][]interface{}
+	for _, s := range keys {
+		tags, err := c.entryTags(s)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tags {
+			cmds = append(cmds, []interface{}{"SREM", c.tagKey(tag), s})
+		}
+		cmds = append(cmds,
+			[]interface{}{"DEL", fmt.Sprintf("%s:%s", c.Prefix, s)},
+			[]interface{}{"DEL", c.entryTagsKey(s)},
+		)
+	}
+
+	return cmds, nil
+}
+
+// entryTags returns the tags s was stored with
+func (c *RedisCache) entryTags(s string) ([]string, error) {
+	key := c.entryTagsKey(s)
+	conn := c.conn(key)
+	defer conn.Close()
+
+	return redis.Strings(conn.Do("SMEMBERS", key))
+}
+
+// Forget removes s from the cache, and from the tags it was stored with
+func (c *RedisCache) Forget(s string) error {
+	cmds, err := c.forgetCmds(s)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return c.multi(cmds)
 }
 
 func (c *RedisCache) EmptyByMatch(s string) error {
 	key := fmt.Sprintf("%s:%s", c.Prefix, s)
-	conn := c.Conn.Get()
-	defer conn.Close()
 
 	keys, err := c.getKeys(key)
 	if err != nil {
 		return err
 	}
 
-	for _, key := range keys {
-		_, err := conn.Do("DEL", key)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return c.del(c.withoutLocks(keys)...)
 }
 
 func (c *RedisCache) Empty() error {
 	key := fmt.Sprintf("%s:", c.Prefix)
-	conn := c.Conn.Get()
-	defer conn.Close()
 
 	keys, err := c.getKeys(key)
 	if err != nil {
 		return err
 	}
 
+	return c.del(c.withoutLocks(keys)...)
+}
+
+// withoutLocks returns keys, except the keys of locks
+func (c *RedisCache) withoutLocks(keys []string) []string {
+	lockPrefix := fmt.Sprintf("%s:%s", c.Prefix, lockKeyPrefix)
+
+	kept := keys[:0]
 	for _, key := range keys {
-		_, err := conn.Do("DEL", key)
-		if err != nil {
-			return err
+		if !strings.HasPrefix(key, lockPrefix) {
+			kept = append(kept, key)
 		}
 	}
 
-	return nil
+	return kept
 }
 
+// getKeys returns every key starting with pattern. In a cluster, every primary node is scanned.
 func (c *RedisCache) getKeys(pattern string) ([]string, error) {
-	conn := c.Conn.Get()
+	return c.scan(fmt.Sprintf("%s*", pattern))
+}
+
+// incrementScript adds ARGV[1] to a counter, and sets an expiry of ARGV[2] seconds
+// if the counter did not exist before
+var incrementScript = redis.NewScript(1, `
+local existed = redis.call("EXISTS", KEYS[1])
+local n = redis.call("INCRBY", KEYS[1], ARGV[1])
+if existed == 0 and tonumber(ARGV[2]) > 0 then
+	redis.call("EXPIRE", KEYS[1], ARGV[2])
+end
+return n`)
+
+// Increment atomically adds delta to the counter stored at s, and returns the new value. A
+// counter that does not exist starts at zero, and expires after expires seconds, if given.
+func (c *RedisCache) Increment(s string, delta int64, expires ...int) (int64, error) {
+	key := fmt.Sprintf("%s:%s", c.Prefix, s)
+	conn := c.conn(key)
 	defer conn.Close()
 
-	iter := 0
-	keys := []string{}
+	ttl := 0
+	if len(expires) > 0 {
+		ttl = expires[0]
+	}
 
-	for {
-		arr, err := redis.Values(conn.Do("SCAN", iter, "MATCH", fmt.Sprintf("%s*", pattern)))
+	n, err := redis.Int64(incrementScript.Do(conn, key, delta, ttl))
+	if rerr, ok := err.(redis.Error); ok && strings.Contains(string(rerr), "not an integer") {
+		// the same error as the other drivers, for a value stored with Set
+		return 0, ErrNotCounter
+	}
+
+	return n, err
+}
+
+// Decrement atomically subtracts delta from the counter stored at s, and returns the new value
+func (c *RedisCache) Decrement(s string, delta int64, expires ...int) (int64, error) {
+	return c.Increment(s, -delta, expires...)
+}
+
+// Add stores value only if s is not already in the cache, and reports whether it was stored
+func (c *RedisCache) Add(s string, value interface{}, expires ...int) (bool, error) {
+	key := fmt.Sprintf("%s:%s", c.Prefix, s)
+	conn := c.conn(key)
+	defer conn.Close()
+
+	encoded, err := c.Encoding.encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	args := redis.Args{}.Add(key, string(encoded), "NX")
+	if len(expires) > 0 {
+		args = args.Add("EX", expires[0])
+	}
+
+	_, err = redis.String(conn.Do("SET", args...))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetMany gets several items from the cache in one round trip. Keys that are not
+// in the cache are left out of the result. In a cluster the keys may be held by
+// different nodes, so there they are read one at a time.
+func (c *RedisCache) GetMany(keys ...string) (map[string]interface{}, error) {
+	items := make(map[string]interface{})
+	if len(keys) == 0 {
+		return items, nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, s := range keys {
+		prefixed[i] = fmt.Sprintf("%s:%s", c.Prefix, s)
+	}
+
+	values, err := c.mget(prefixed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+
+		item, err := decodeValue(prefixed[i], value)
 		if err != nil {
-			return keys, err
+			return nil, err
+		}
+		items[keys[i]] = item
+	}
+
+	return items, nil
+}
+
+// mget returns the values stored at keys, with nil for missing keys
+func (c *RedisCache) mget(keys []string) ([][]byte, error) {
+	if c.Cluster == nil {
+		conn := c.conn()
+		defer conn.Close()
+
+		return redis.ByteSlices(conn.Do("MGET", redis.Args{}.AddFlat(keys)...))
+	}
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		conn := c.conn(key)
+		value, err := redis.Bytes(conn.Do("GET", key))
+		conn.Close()
+		if err != nil && err != redis.ErrNil {
+			return nil, err
 		}
+		values[i] = value
+	}
 
-		iter, _ = redis.Int(arr[0], nil)
-		k, _ := redis.Strings(arr[1], nil)
-		keys = append(keys, k...)
+	return values, nil
+}
 
-		if iter == 0 {
-			break
+// SetMany stores several items in the cache in one transaction
+func (c *RedisCache) SetMany(items map[string]interface{}, expires ...int) error {
+	var cmds [][]interface{}
+	for s, value := range items {
+		key := fmt.Sprintf("%s:%s", c.Prefix, s)
+		encoded, err := c.Encoding.encode(value)
+		if err != nil {
+			return err
 		}
+
+		if len(expires) > 0 {
+			cmds = append(cmds, []interface{}{"SETEX", key, expires[0], string(encoded)})
+		} else {
+			cmds = append(cmds, []interface{}{"SET", key, string(encoded)})
+		}
+	}
+
+	return c.multi(cmds)
+}
+
+// CompareAndSwap stores new only if the value stored at s is currently old, compared
+// with reflect.DeepEqual after decoding the stored value into the type of old, and
+// reports whether it was stored. If old is nil, new is only stored if s is not in the
+// cache. The key is watched, so that new is not stored if s changes in the meantime.
+func (c *RedisCache) CompareAndSwap(s string, old, new interface{}, expires ...int) (bool, error) {
+	if old == nil {
+		return c.Add(s, new, expires...)
+	}
+
+	key := fmt.Sprintf("%s:%s", c.Prefix, s)
+	conn := c.conn(key)
+	defer conn.Close()
+
+	newEncoded, err := c.Encoding.encode(new)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := conn.Do("WATCH", key); err != nil {
+		return false, err
 	}
+	defer conn.Do("UNWATCH")
 
-	return keys, nil
+	stored, err := redis.Bytes(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !storedEquals(key, stored, old) {
+		return false, nil
+	}
+
+	args := []interface{}{key, string(newEncoded)}
+	if len(expires) > 0 && expires[0] > 0 {
+		args = append(args, "EX", expires[0])
+	}
+
+	_ = conn.Send("MULTI")
+	_ = conn.Send("SET", args...)
+	_, err = redis.Values(conn.Do("EXEC"))
+	if err == redis.ErrNil {
+		// s was changed since it was compared
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// unlockScript deletes a lock only if it is still held by the given token, so that
+// one holder cannot release a lock that has since been taken by another
+var unlockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// tryLock sets s to token, unless s already exists, and expires it after ttl. It reports
+// whether the lock was taken.
+func (c *RedisCache) tryLock(s, token string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("%s:%s", c.Prefix, s)
+	conn := c.conn(key)
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("SET", key, token, "NX", "PX", ttl.Milliseconds()))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// unlock deletes s if it is still set to token, and reports whether it was deleted
+func (c *RedisCache) unlock(s, token string) (bool, error) {
+	key := fmt.Sprintf("%s:%s", c.Prefix, s)
+	conn := c.conn(key)
+	defer conn.Close()
+
+	n, err := redis.Int(unlockScript.Do(conn, key, token))
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
 
+// randomToken returns a random hex string, used to identify lock holders and instances
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
 }
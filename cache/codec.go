@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec is a format used to serialize cached values
+type Codec byte
+
+const (
+	// Gob serializes values with encoding/gob. Values are returned with their original
+	// types, but custom types must be registered with gob.Register.
+	Gob Codec = iota + 1
+	// JSON serializes values as json, so they can be read from other languages. Get
+	// returns values as the generic json types: float64, string, bool, []interface{} and
+	// map[string]interface{}, while GetAs and Remember decode them into their type.
+	JSON
+	// Msgpack serializes values as MessagePack, which is more compact than json and can
+	// also be read from other languages. Get returns integers as int64 or uint64, while
+	// GetAs and Remember decode values into their type.
+	Msgpack
+)
+
+// Compression is an algorithm used to compress cached values
+type Compression byte
+
+const (
+	NoCompression Compression = iota
+	Zstd
+	Snappy
+)
+
+// Encoding configures how a cache stores values. The zero value stores values with
+// gob, uncompressed.
+type Encoding struct {
+	Codec       Codec
+	Compression Compression
+	// CompressAbove is the size in bytes above which values are compressed
+	CompressAbove int
+}
+
+// formatMarker starts every value written with an Encoding, followed by the codec and
+// the compression used. Values in the older format are gob encoded entries, which never
+// start with a zero byte, so both formats can be read from the same cache.
+const formatMarker = 0x00
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// ParseCodec returns the codec called name, which is one of gob, json or msgpack. An
+// empty name means gob.
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "", "gob":
+		return Gob, nil
+	case "json":
+		return JSON, nil
+	case "msgpack":
+		return Msgpack, nil
+	}
+
+	return 0, fmt.Errorf("cache: unknown codec %s", name)
+}
+
+// ParseCompression returns the compression called name, which is one of zstd or snappy.
+// An empty name, or none, means no compression.
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "", "none":
+		return NoCompression, nil
+	case "zstd":
+		return Zstd, nil
+	case "snappy":
+		return Snappy, nil
+	}
+
+	return 0, fmt.Errorf("cache: unknown compression %s", name)
+}
+
+// encode serializes value with e's codec, and compresses it if it is larger than CompressAbove
+func (e Encoding) encode(value interface{}) ([]byte, error) {
+	codec := e.Codec
+	if codec == 0 {
+		codec = Gob
+	}
+
+	data, err := codec.marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	compression := NoCompression
+	if e.Compression != NoCompression && len(data) > e.CompressAbove {
+		compression = e.Compression
+		data, err = compression.compress(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return append([]byte{formatMarker, byte(codec), byte(compression)}, data...), nil
+}
+
+// decodeValue decodes a value stored in a cache, whatever encoding it was written with.
+// Values in the older format are gob encoded entries holding key. Counters created by
+// Increment are stored as plain integers, so that they can be changed atomically, and
+// are returned as int64.
+func decodeValue(key string, data []byte) (interface{}, error) {
+	if len(data) >= 3 && data[0] == formatMarker {
+		payload, err := Compression(data[2]).decompress(data[3:])
+		if err != nil {
+			return nil, err
+		}
+
+		return Codec(data[1]).unmarshal(payload)
+	}
+
+	decoded, err := decode(string(data))
+	if err != nil {
+		if n, convErr := strconv.ParseInt(string(data), 10, 64); convErr == nil {
+			return n, nil
+		}
+		return nil, err
+	}
+
+	return decoded[key], nil
+}
+
+// decodeValueInto decodes a value stored in a cache into target, which is a pointer.
+// Values written with the json and msgpack codecs are decoded straight into the type of
+// target, rather than into the generic types decodeValue returns.
+func decodeValueInto(key string, data []byte, target interface{}) error {
+	if len(data) >= 3 && data[0] == formatMarker {
+		payload, err := Compression(data[2]).decompress(data[3:])
+		if err != nil {
+			return err
+		}
+
+		return Codec(data[1]).unmarshalInto(payload, target)
+	}
+
+	value, err := decodeValue(key, data)
+	if err != nil {
+		return err
+	}
+
+	return assign(value, target)
+}
+
+// storedEquals reports whether data, a value stored in a cache under key, decodes to a
+// value equal to value. The stored value is decoded into the type of value and compared
+// with reflect.DeepEqual, so that encodings which are not deterministic, such as gob and
+// msgpack maps, and values in the older format compare as the values they hold.
+func storedEquals(key string, data []byte, value interface{}) bool {
+	stored := reflect.New(reflect.TypeOf(value))
+	if err := decodeValueInto(key, data, stored.Interface()); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(stored.Elem().Interface(), value)
+}
+
+// assign stores value in target, a pointer, if value is of the type target points to.
+// It returns ErrWrongType otherwise.
+func assign(value, target interface{}) error {
+	dst := reflect.ValueOf(target).Elem()
+
+	src := reflect.ValueOf(value)
+	if !src.IsValid() {
+		// a nil value is only the zero value of an interface type
+		if dst.Kind() != reflect.Interface {
+			return ErrWrongType
+		}
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	if !src.Type().AssignableTo(dst.Type()) {
+		return ErrWrongType
+	}
+	dst.Set(src)
+
+	return nil
+}
+
+func (c Codec) marshal(value interface{}) ([]byte, error) {
+	switch c {
+	case Gob:
+		b := bytes.Buffer{}
+		err := gob.NewEncoder(&b).Encode(&value)
+		if err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case JSON:
+		return json.Marshal(value)
+	case Msgpack:
+		return msgpack.Marshal(value)
+	}
+
+	return nil, fmt.Errorf("cache: unknown codec %d", c)
+}
+
+func (c Codec) unmarshal(data []byte) (interface{}, error) {
+	var value interface{}
+
+	switch c {
+	case Gob:
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+		return value, err
+	case JSON:
+		err := json.Unmarshal(data, &value)
+		return value, err
+	case Msgpack:
+		d := msgpack.NewDecoder(bytes.NewReader(data))
+		d.UseLooseInterfaceDecoding(true)
+		err := d.Decode(&value)
+		return value, err
+	}
+
+	return nil, fmt.Errorf("cache: unknown codec %d", c)
+}
+
+// unmarshalInto decodes data into target, which is a pointer. A value which does not fit
+// the type of target is reported as ErrWrongType.
+func (c Codec) unmarshalInto(data []byte, target interface{}) error {
+	var err error
+
+	switch c {
+	case JSON:
+		err = json.Unmarshal(data, target)
+	case Msgpack:
+		err = msgpack.Unmarshal(data, target)
+	default:
+		value, err := c.unmarshal(data)
+		if err != nil {
+			return err
+		}
+		return assign(value, target)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWrongType, err)
+	}
+
+	return nil
+}
+
+func (c Compression) compress(data []byte) ([]byte, error) {
+	switch c {
+	case NoCompression:
+		return data, nil
+	case Zstd:
+		initZstd()
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case Snappy:
+		return snappy.Encode(nil, data), nil
+	}
+
+	return nil, fmt.Errorf("cache: unknown compression %d", c)
+}
+
+func (c Compression) decompress(data []byte) ([]byte, error) {
+	switch c {
+	case NoCompression:
+		return data, nil
+	case Zstd:
+		initZstd()
+		return zstdDecoder.DecodeAll(data, nil)
+	case Snappy:
+		return snappy.Decode(nil, data)
+	}
+
+	return nil, fmt.Errorf("cache: unknown compression %d", c)
+}
+
+// initZstd creates the shared zstd encoder and decoder, which are safe for concurrent use
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestEncoding_RoundTrip(t *testing.T) {
+	long := strings.Repeat("sokudo ", 200)
+
+	tests := []struct {
+		name     string
+		encoding Encoding
+		value    interface{}
+		expected interface{}
+	}{
+		{"zero value", Encoding{}, "bar", "bar"},
+		{"gob", Encoding{Codec: Gob}, 42, 42},
+		{"json", Encoding{Codec: JSON}, map[string]interface{}{"n": 1}, map[string]interface{}{"n": float64(1)}},
+		{"msgpack", Encoding{Codec: Msgpack}, 42, int64(42)},
+		{"gob zstd", Encoding{Codec: Gob, Compression: Zstd, CompressAbove: 100}, long, long},
+		{"json snappy", Encoding{Codec: JSON, Compression: Snappy, CompressAbove: 100}, long, long},
+		{"msgpack zstd below threshold", Encoding{Codec: Msgpack, Compression: Zstd, CompressAbove: 100}, "short", "short"},
+	}
+
+	for _, tt := range tests {
+		encoded, err := tt.encoding.encode(tt.value)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if tt.encoding.Compression != NoCompression && tt.value == long && len(encoded) >= len(long) {
+			t.Errorf("%s: value was not compressed", tt.name)
+		}
+
+		decoded, err := decodeValue("foo", encoded)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if fmt.Sprint(decoded) != fmt.Sprint(tt.expected) || fmt.Sprintf("%T", decoded) != fmt.Sprintf("%T", tt.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tt.name, tt.expected, decoded)
+		}
+	}
+}
+
+func TestRedisCache_Encoding(t *testing.T) {
+	c := testRedisCache
+	c.Encoding = Encoding{Codec: Msgpack, Compression: Zstd}
+
+	err := c.Set("encoded", "value")
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := c.Get("encoded")
+	if err != nil || x != "value" {
+		t.Error("did not get value stored with msgpack and zstd:", x, err)
+	}
+
+	// a cache with a different encoding can still read the value
+	x, err = testRedisCache.Get("encoded")
+	if err != nil || x != "value" {
+		t.Error("did not get value stored with another encoding:", x, err)
+	}
+}
+
+func TestRedisCache_LegacyFormat(t *testing.T) {
+	key := fmt.Sprintf("%s:%s", testRedisCache.Prefix, "legacy")
+	encoded, err := encode(Entry{key: "old"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	conn := testRedisCache.Conn.Get()
+	_, err = conn.Do("SET", key, string(encoded))
+	conn.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := testRedisCache.Get("legacy")
+	if err != nil || x != "old" {
+		t.Error("did not read value in the older format:", x, err)
+	}
+
+	ok, err := testRedisCache.CompareAndSwap("legacy", "old", "new")
+	if err != nil || !ok {
+		t.Error("did not swap value in the older format:", ok, err)
+	}
+}
+
+func TestBadgerCache_LegacyFormat(t *testing.T) {
+	encoded, err := encode(Entry{"legacy": "old"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = testBadgerCache.Conn.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("legacy"), encoded)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := testBadgerCache.Get("legacy")
+	if err != nil || x != "old" {
+		t.Error("did not read value in the older format:", x, err)
+	}
+
+	ok, err := testBadgerCache.CompareAndSwap("legacy", "old", "new")
+	if err != nil || !ok {
+		t.Error("did not swap value in the older format:", ok, err)
+	}
+}
@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	// ErrLocked is returned by Acquire when the lock is held by another owner
+	ErrLocked = errors.New("cache: lock is held by another owner")
+	// ErrNotLockOwner is returned by Release and Extend when the lock has expired, or
+	// has been taken by another owner
+	ErrNotLockOwner = errors.New("cache: lock is not held by this owner")
+)
+
+// lockRetryInterval is how often AcquireContext retries a lock that is held
+const lockRetryInterval = 50 * time.Millisecond
+
+// Locker provides mutual exclusion across every instance of the application that shares
+// the same cache. Acquire returns an owner token, which must be passed to Release and
+// Extend, so that a holder whose lock has expired cannot release a lock that has since
+// been taken by someone else.
+type Locker interface {
+	Acquire(key string, ttl time.Duration) (string, error)
+	Release(key, token string) error
+	Extend(key, token string, ttl time.Duration) error
+}
+
+// AcquireContext waits until the lock for key can be acquired, or ctx is done
+func AcquireContext(ctx context.Context, l Locker, key string, ttl time.Duration) (string, error) {
+	ticker := time.NewTicker(lockRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		token, err := l.Acquire(key, ttl)
+		if err != ErrLocked {
+			return token, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockKeyPrefix starts the keys locks are stored under. Empty and EmptyByMatch leave
+// them alone, so that emptying the cache does not release held locks.
+const lockKeyPrefix = "lock:"
+
+// lockKey returns the key a lock is stored under, so that locks do not clash with cached values
+func lockKey(key string) string {
+	return lockKeyPrefix + key
+}
+
+// extendScript resets the expiry of a lock only if it is still held by the given token
+var extendScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+else
+	return 0
+end`)
+
+// Acquire takes the lock for key for ttl, and returns the owner token. It returns
+// ErrLocked if the lock is held by another owner.
+func (c *RedisCache) Acquire(key string, ttl time.Duration) (string, error) {
+	token := randomToken()
+
+	ok, err := c.tryLock(lockKey(key), token, ttl)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrLocked
+	}
+
+	return token, nil
+}
+
+// Release releases the lock for key, if it is still held by token
+func (c *RedisCache) Release(key, token string) error {
+	ok, err := c.unlock(lockKey(key), token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotLockOwner
+	}
+
+	return nil
+}
+
+// Extend resets the expiry of the lock for key to ttl from now, if it is still held by token
+func (c *RedisCache) Extend(key, token string, ttl time.Duration) error {
+	k := fmt.Sprintf("%s:%s", c.Prefix, lockKey(key))
+	conn := c.conn(k)
+	defer conn.Close()
+
+	n, err := redis.Int(extendScript.Do(conn, k, token, ttl.Milliseconds()))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotLockOwner
+	}
+
+	return nil
+}
+
+// Acquire takes the lock for key for ttl, and returns the owner token. It returns
+// ErrLocked if the lock is held by another owner. Badger expires entries with a
+// resolution of one second, so ttl is rounded up to whole seconds.
+func (b *BadgerCache) Acquire(key string, ttl time.Duration) (string, error) {
+	token := randomToken()
+
+	err := b.update(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(lockKey(key)))
+		if err == nil {
+			return ErrLocked
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		return txn.SetEntry(badger.NewEntry([]byte(lockKey(key)), []byte(token)).WithTTL(lockTTL(ttl)))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Release releases the lock for key, if it is still held by token
+func (b *BadgerCache) Release(key, token string) error {
+	return b.update(func(txn *badger.Txn) error {
+		err := b.checkLockOwner(txn, key, token)
+		if err != nil {
+			return err
+		}
+
+		return txn.Delete([]byte(lockKey(key)))
+	})
+}
+
+// Extend resets the expiry of the lock for key to ttl from now, if it is still held by token
+func (b *BadgerCache) Extend(key, token string, ttl time.Duration) error {
+	return b.update(func(txn *badger.Txn) error {
+		err := b.checkLockOwner(txn, key, token)
+		if err != nil {
+			return err
+		}
+
+		return txn.SetEntry(badger.NewEntry([]byte(lockKey(key)), []byte(token)).WithTTL(lockTTL(ttl)))
+	})
+}
+
+// checkLockOwner returns ErrNotLockOwner unless the lock for key is held by token
+func (b *BadgerCache) checkLockOwner(txn *badger.Txn, key, token string) error {
+	item, err := txn.Get([]byte(lockKey(key)))
+	if err == badger.ErrKeyNotFound {
+		return ErrNotLockOwner
+	}
+	if err != nil {
+		return err
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	if string(value) != token {
+		return ErrNotLockOwner
+	}
+
+	return nil
+}
+
+// lockTTL rounds ttl up to whole seconds
+func lockTTL(ttl time.Duration) time.Duration {
+	if rounded := ttl.Truncate(time.Second); rounded < ttl {
+		return rounded + time.Second
+	}
+	return ttl
+}
+
+// memoryLock is a lock held in a MemoryCache. Locks are kept apart from cached values,
+// so that they are never evicted.
+type memoryLock struct {
+	token   string
+	expires time.Time
+}
+
+// Acquire takes the lock for key for ttl, and returns the owner token. It returns
+// ErrLocked if the lock is held by another owner. Locks in a MemoryCache only exclude
+// other holders in the same process.
+func (m *MemoryCache) Acquire(key string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.locks == nil {
+		m.locks = make(map[string]memoryLock)
+	}
+
+	if l, ok := m.locks[key]; ok && time.Now().Before(l.expires) {
+		return "", ErrLocked
+	}
+
+	// locks which expire without being released are dropped here, so that they do not
+	// pile up
+	now := time.Now()
+	for k, l := range m.locks {
+		if !now.Before(l.expires) {
+			delete(m.locks, k)
+		}
+	}
+
+	token := randomToken()
+	m.locks[key] = memoryLock{token: token, expires: now.Add(ttl)}
+
+	return token, nil
+}
+
+// Release releases the lock for key, if it is still held by token
+func (m *MemoryCache) Release(key, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.ownsLock(key, token) {
+		return ErrNotLockOwner
+	}
+
+	delete(m.locks, key)
+
+	return nil
+}
+
+// Extend resets the expiry of the lock for key to ttl from now, if it is still held by token
+func (m *MemoryCache) Extend(key, token string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.ownsLock(key, token) {
+		return ErrNotLockOwner
+	}
+
+	m.locks[key] = memoryLock{token: token, expires: time.Now().Add(ttl)}
+
+	return nil
+}
+
+// ownsLock reports whether the lock for key is held by token. The caller must hold the lock.
+func (m *MemoryCache) ownsLock(key, token string) bool {
+	l, ok := m.locks[key]
+	return ok && l.token == token && time.Now().Before(l.expires)
+}
+
+// Acquire takes the lock for key in redis, so that it is shared by every instance
+func (c *TieredCache) Acquire(key string, ttl time.Duration) (string, error) {
+	return c.Remote.Acquire(key, ttl)
+}
+
+// Release releases the lock for key in redis, if it is still held by token
+func (c *TieredCache) Release(key, token string) error {
+	return c.Remote.Release(key, token)
+}
+
+// Extend resets the expiry of the lock for key in redis, if it is still held by token
+func (c *TieredCache) Extend(key, token string, ttl time.Duration) error {
+	return c.Remote.Extend(key, token, ttl)
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocker_AcquireRelease(t *testing.T) {
+	lockers := map[string]Locker{
+		"redis":  &testRedisCache,
+		"badger": &testBadgerCache,
+		"memory": NewMemoryCache(100, 0),
+		"tiered": NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60),
+	}
+
+	for name, l := range lockers {
+		token, err := l.Acquire("report", 10*time.Second)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		_, err = l.Acquire("report", 10*time.Second)
+		if err != ErrLocked {
+			t.Errorf("%s: expected ErrLocked acquiring a held lock, got %v", name, err)
+		}
+
+		err = l.Release("report", "someone-else")
+		if err != ErrNotLockOwner {
+			t.Errorf("%s: expected ErrNotLockOwner releasing with the wrong token, got %v", name, err)
+		}
+
+		err = l.Extend("report", token, 20*time.Second)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		err = l.Release("report", token)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		token, err = l.Acquire("report", 10*time.Second)
+		if err != nil {
+			t.Errorf("%s: could not acquire released lock: %s", name, err)
+		}
+		_ = l.Release("report", token)
+	}
+}
+
+func TestLocker_Expiry(t *testing.T) {
+	l := NewMemoryCache(100, 0)
+
+	token, _ := l.Acquire("expiring", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := l.Acquire("expiring", time.Second); err != nil {
+		t.Error("could not acquire expired lock:", err)
+	}
+
+	if err := l.Release("expiring", token); err != ErrNotLockOwner {
+		t.Error("previous holder released a lock taken by someone else")
+	}
+}
+
+func TestMemoryCache_AcquirePurgesExpiredLocks(t *testing.T) {
+	m := NewMemoryCache(100, 0)
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = m.Acquire(key, 10*time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	_, _ = m.Acquire("d", time.Second)
+	if len(m.locks) != 1 {
+		t.Error("expected expired locks to be purged, but there are", len(m.locks), "locks")
+	}
+}
+
+func TestAcquireContext(t *testing.T) {
+	l := NewMemoryCache(100, 0)
+
+	token, _ := l.Acquire("busy", time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := AcquireContext(ctx, l, "busy", time.Second)
+	if err != context.DeadlineExceeded {
+		t.Error("expected deadline exceeded waiting for a held lock, got", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = l.Release("busy", token)
+	}()
+
+	_, err = AcquireContext(context.Background(), l, "busy", time.Second)
+	if err != nil {
+		t.Error("lock was not acquired after it was released:", err)
+	}
+}
+
+func TestLocker_HeldAcrossEmpty(t *testing.T) {
+	caches := map[string]interface {
+		Cache
+		Locker
+	}{
+		"redis":  &testRedisCache,
+		"badger": &testBadgerCache,
+		"memory": NewMemoryCache(100, 0),
+		"tiered": NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60),
+	}
+
+	for name, c := range caches {
+		token, err := c.Acquire("nightly", 10*time.Second)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		_ = c.Set("nightly", "value")
+		if err := c.Empty(); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		if found, _ := c.Has("nightly"); found {
+			t.Errorf("%s: value was not emptied", name)
+		}
+
+		_, err = c.Acquire("nightly", 10*time.Second)
+		if err != ErrLocked {
+			t.Errorf("%s: expected ErrLocked acquiring a lock held across Empty, got %v", name, err)
+		}
+
+		err = c.Release("nightly", token)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
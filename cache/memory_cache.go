@@ -0,0 +1,376 @@
+package cache
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// MemoryCache is a process-local cache, bounded by number of entries and/or
+// approximate size in bytes, which evicts the least recently used entries first.
+// It is safe for concurrent use. Values are stored as is, not encoded, so callers
+// should not modify values after storing them.
+type MemoryCache struct {
+	MaxEntries int
+	MaxBytes   int64
+	mu         sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+	tags       map[string]map[string]struct{}
+	locks      map[string]memoryLock
+	size       int64
+}
+
+type memoryEntry struct {
+	key     string
+	value   interface{}
+	size    int64
+	expires time.Time
+	tags    []string
+}
+
+// NewMemoryCache returns a memory cache holding at most maxEntries entries and
+// maxBytes bytes. A limit of zero means no limit.
+func NewMemoryCache(maxEntries int, maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		MaxEntries: maxEntries,
+		MaxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		tags:       make(map[string]map[string]struct{}),
+	}
+}
+
+func (m *MemoryCache) Has(s string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.get(s)
+	return ok, nil
+}
+
+func (m *MemoryCache) Get(s string) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.get(s)
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+
+	return e.value, nil
+}
+
+func (m *MemoryCache) Set(s string, value interface{}, expires ...int) error {
+	return m.SetWithTags(s, value, nil, expires...)
+}
+
+// SetWithTags stores value like Set, and records it under each of tags, so that it is
+// removed by FlushTags
+func (m *MemoryCache) SetWithTags(s string, value interface{}, tags []string, expires ...int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(s, value, tags, expires...)
+
+	return nil
+}
+
+// set stores value, replacing any existing entry. The caller must hold the lock.
+func (m *MemoryCache) set(s string, value interface{}, tags []string, expires ...int) {
+	var size int64
+	if m.MaxBytes > 0 {
+		size = sizeOf(s, value)
+	}
+
+	var expiry time.Time
+	if len(expires) > 0 {
+		expiry = time.Now().Add(time.Second * time.Duration(expires[0]))
+	}
+
+	m.init()
+
+	if el, ok := m.items[s]; ok {
+		m.remove(el)
+	}
+
+	m.items[s] = m.ll.PushFront(&memoryEntry{key: s, value: value, size: size, expires: expiry, tags: tags})
+	m.size += size
+
+	for _, tag := range tags {
+		if m.tags[tag] == nil {
+			m.tags[tag] = make(map[string]struct{})
+		}
+		m.tags[tag][s] = struct{}{}
+	}
+
+	m.evict()
+}
+
+// FlushTags removes every entry that was stored with any of tags
+func (m *MemoryCache) FlushTags(tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range m.tags[tag] {
+			if el, ok := m.items[key]; ok {
+				m.remove(el)
+			}
+		}
+		delete(m.tags, tag)
+	}
+
+	return nil
+}
+
+// Increment atomically adds delta to the counter stored at s, and returns the new value. A
+// counter that does not exist starts at zero, and expires after expires seconds, if given.
+func (m *MemoryCache) Increment(s string, delta int64, expires ...int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.get(s)
+	if !ok {
+		m.set(s, delta, nil, expires...)
+		return delta, nil
+	}
+
+	var n int64
+	switch v := e.value.(type) {
+	case int64:
+		n = v + delta
+	case int:
+		n = int64(v) + delta
+	default:
+		return 0, ErrNotCounter
+	}
+
+	// the size is recomputed as set does, so that MaxBytes stays accurate
+	var size int64
+	if m.MaxBytes > 0 {
+		size = sizeOf(s, n)
+	}
+	m.size += size - e.size
+	e.value = n
+	e.size = size
+	m.evict()
+
+	return n, nil
+}
+
+// Decrement atomically subtracts delta from the counter stored at s, and returns the new value
+func (m *MemoryCache) Decrement(s string, delta int64, expires ...int) (int64, error) {
+	return m.Increment(s, -delta, expires...)
+}
+
+// Add stores value only if s is not already in the cache, and reports whether it was stored
+func (m *MemoryCache) Add(s string, value interface{}, expires ...int) (bool, error) {
+	return m.CompareAndSwap(s, nil, value, expires...)
+}
+
+// GetMany gets several items from the cache. Keys that are not in the cache are left
+// out of the result.
+func (m *MemoryCache) GetMany(keys ...string) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := make(map[string]interface{})
+	for _, s := range keys {
+		if e, ok := m.get(s); ok {
+			items[s] = e.value
+		}
+	}
+
+	return items, nil
+}
+
+// SetMany stores several items in the cache
+func (m *MemoryCache) SetMany(items map[string]interface{}, expires ...int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for s, value := range items {
+		m.set(s, value, nil, expires...)
+	}
+
+	return nil
+}
+
+// CompareAndSwap stores new only if the value stored at s is currently old, compared
+// with reflect.DeepEqual, and reports whether it was stored. If old is nil, new is only
+// stored if s is not in the cache.
+func (m *MemoryCache) CompareAndSwap(s string, old, new interface{}, expires ...int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.get(s)
+	if old == nil && ok {
+		return false, nil
+	}
+	if old != nil && (!ok || !reflect.DeepEqual(e.value, old)) {
+		return false, nil
+	}
+
+	m.set(s, new, nil, expires...)
+	return true, nil
+}
+
+func (m *MemoryCache) Forget(s string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[s]; ok {
+		m.remove(el)
+	}
+
+	return nil
+}
+
+// EmptyByMatch removes every entry whose key matches the glob pattern s followed by *,
+// so a plain string removes all keys with that prefix
+func (m *MemoryCache) EmptyByMatch(s string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pattern := s + "*"
+	for key, el := range m.items {
+		if globMatch(pattern, key) {
+			m.remove(el)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryCache) Empty() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ll = list.New()
+	m.items = make(map[string]*list.Element)
+	m.tags = make(map[string]map[string]struct{})
+	m.size = 0
+
+	return nil
+}
+
+// Len returns the number of entries in the cache, including expired entries
+// that have not been removed yet
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.items)
+}
+
+// get returns the live entry for key, marking it as recently used. Expired entries
+// are removed. The caller must hold the lock.
+func (m *MemoryCache) get(key string) (*memoryEntry, bool) {
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*memoryEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		m.remove(el)
+		return nil, false
+	}
+
+	m.ll.MoveToFront(el)
+	return e, true
+}
+
+// evict removes least recently used entries until the cache is within its limits
+func (m *MemoryCache) evict() {
+	for (m.MaxEntries > 0 && m.ll.Len() > m.MaxEntries) || (m.MaxBytes > 0 && m.size > m.MaxBytes) {
+		el := m.ll.Back()
+		if el == nil {
+			return
+		}
+		m.remove(el)
+	}
+}
+
+func (m *MemoryCache) remove(el *list.Element) {
+	e := el.Value.(*memoryEntry)
+	m.ll.Remove(el)
+	delete(m.items, e.key)
+	m.size -= e.size
+
+	for _, tag := range e.tags {
+		delete(m.tags[tag], e.key)
+		if len(m.tags[tag]) == 0 {
+			delete(m.tags, tag)
+		}
+	}
+}
+
+// init allows a MemoryCache to be used without calling NewMemoryCache
+func (m *MemoryCache) init() {
+	if m.items == nil {
+		m.ll = list.New()
+		m.items = make(map[string]*list.Element)
+		m.tags = make(map[string]map[string]struct{})
+	}
+}
+
+// sizeOf returns the approximate number of bytes used by a key and its value
+func sizeOf(key string, value interface{}) int64 {
+	size := int64(len(key))
+
+	switch v := value.(type) {
+	case string:
+		return size + int64(len(v))
+	case []byte:
+		return size + int64(len(v))
+	case bool, int8, uint8:
+		return size + 1
+	case int16, uint16:
+		return size + 2
+	case int32, uint32, float32:
+		return size + 4
+	case int, uint, int64, uint64, float64:
+		return size + 8
+	}
+
+	encoded, err := Encoding{}.encode(value)
+	if err != nil {
+		return size
+	}
+
+	return size + int64(len(encoded))
+}
+
+// globMatch reports whether s matches pattern, where * matches any sequence of
+// characters and ? matches any single character
+func globMatch(pattern, s string) bool {
+	p, n := []rune(pattern), []rune(s)
+	pi, ni := 0, 0
+	star, match := -1, 0
+
+	for ni < len(n) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == n[ni]):
+			pi++
+			ni++
+		case pi < len(p) && p[pi] == '*':
+			star, match = pi, ni
+			pi++
+		case star != -1:
+			pi = star + 1
+			match++
+			ni = match
+		default:
+			return false
+		}
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+
+	return pi == len(p)
+}
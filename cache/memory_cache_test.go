@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache_Has(t *testing.T) {
+	err := testMemoryCache.Forget("foo")
+	if err != nil {
+		t.Error(err)
+	}
+
+	inCache, err := testMemoryCache.Has("foo")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if inCache {
+		t.Error("foo found in cache, and it shouldn't be there")
+	}
+
+	_ = testMemoryCache.Set("foo", "bar")
+	inCache, err = testMemoryCache.Has("foo")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !inCache {
+		t.Error("foo not found in cache")
+	}
+}
+
+func TestMemoryCache_Get(t *testing.T) {
+	err := testMemoryCache.Set("foo", "bar")
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := testMemoryCache.Get("foo")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if x != "bar" {
+		t.Error("did not get correct value from cache")
+	}
+
+	_, err = testMemoryCache.Get("not-there")
+	if err != ErrCacheMiss {
+		t.Error("expected ErrCacheMiss, but got", err)
+	}
+}
+
+func TestMemoryCache_Forget(t *testing.T) {
+	err := testMemoryCache.Set("alpha", "beta")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = testMemoryCache.Forget("alpha")
+	if err != nil {
+		t.Error(err)
+	}
+
+	inCache, _ := testMemoryCache.Has("alpha")
+	if inCache {
+		t.Error("alpha found in cache, and it should not be there")
+	}
+}
+
+func TestMemoryCache_Empty(t *testing.T) {
+	err := testMemoryCache.Set("alpha", "beta")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = testMemoryCache.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+
+	inCache, _ := testMemoryCache.Has("alpha")
+	if inCache {
+		t.Error("alpha found in cache, and it should not be there")
+	}
+}
+
+func TestMemoryCache_EmptyByMatch(t *testing.T) {
+	_ = testMemoryCache.Set("alpha", "foo")
+	_ = testMemoryCache.Set("alpha2", "foo")
+	_ = testMemoryCache.Set("beta", "foo")
+	_ = testMemoryCache.Set("user:1:posts", "foo")
+	_ = testMemoryCache.Set("user:2:posts", "foo")
+	_ = testMemoryCache.Set("user:2:name", "foo")
+
+	err := testMemoryCache.EmptyByMatch("alpha")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = testMemoryCache.EmptyByMatch("user:*:posts")
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, key := range []string{"alpha", "alpha2", "user:1:posts", "user:2:posts"} {
+		if inCache, _ := testMemoryCache.Has(key); inCache {
+			t.Error(key, "found in cache, and it should not be there")
+		}
+	}
+
+	for _, key := range []string{"beta", "user:2:name"} {
+		if inCache, _ := testMemoryCache.Has(key); !inCache {
+			t.Error(key, "not found in cache, and it should be there")
+		}
+	}
+}
+
+func TestMemoryCache_Expires(t *testing.T) {
+	c := NewMemoryCache(0, 0)
+	_ = c.Set("foo", "bar", 1)
+
+	if inCache, _ := c.Has("foo"); !inCache {
+		t.Error("foo not found in cache before it expired")
+	}
+
+	c.items["foo"].Value.(*memoryEntry).expires = time.Now().Add(-time.Second)
+
+	if inCache, _ := c.Has("foo"); inCache {
+		t.Error("foo found in cache after it expired")
+	}
+
+	if c.Len() != 0 {
+		t.Error("expired entry was not removed")
+	}
+}
+
+func TestMemoryCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewMemoryCache(2, 0)
+	_ = c.Set("a", 1)
+	_ = c.Set("b", 2)
+
+	// use a, so that b is the least recently used
+	_, _ = c.Get("a")
+	_ = c.Set("c", 3)
+
+	if inCache, _ := c.Has("b"); inCache {
+		t.Error("b was not evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if inCache, _ := c.Has(key); !inCache {
+			t.Error(key, "was evicted, and it should not have been")
+		}
+	}
+}
+
+func TestMemoryCache_MaxBytes(t *testing.T) {
+	c := NewMemoryCache(0, 20)
+	_ = c.Set("a", "0123456789")
+	_ = c.Set("b", "0123456789")
+
+	if inCache, _ := c.Has("a"); inCache {
+		t.Error("a was not evicted when the cache grew beyond MaxBytes")
+	}
+
+	if c.size > 20 {
+		t.Error("cache size is larger than MaxBytes:", c.size)
+	}
+}
+
+func TestMemoryCache_IncrementSize(t *testing.T) {
+	c := NewMemoryCache(0, 1000)
+	_ = c.Set("hits", 1)
+	_, _ = c.Increment("hits", 1)
+	_, _ = c.Increment("fresh", 1)
+
+	want := sizeOf("hits", int64(2)) + sizeOf("fresh", int64(1))
+	if c.size != want {
+		t.Errorf("expected cache size %d after increments, got %d", want, c.size)
+	}
+}
+
+func TestMemoryCache_Concurrent(t *testing.T) {
+	c := NewMemoryCache(100, 0)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := strconv.Itoa(i*1000 + j)
+				_ = c.Set(key, j)
+				_, _ = c.Get(key)
+				_ = c.EmptyByMatch("5")
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if c.Len() > 100 {
+		t.Error("cache holds more than MaxEntries entries:", c.Len())
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	var tests = []struct {
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{"alpha*", "alpha2", true},
+		{"alpha*", "beta", false},
+		{"user:*:posts*", "user:42:posts", true},
+		{"user:*:posts*", "user:42:name", false},
+		{"a?c*", "abc", true},
+		{"a?c*", "ac", false},
+		{"*", "", true},
+	}
+
+	for _, e := range tests {
+		if got := globMatch(e.pattern, e.s); got != e.expected {
+			t.Errorf("globMatch(%q, %q) = %v, expected %v", e.pattern, e.s, got, e.expected)
+		}
+	}
+}
+
+func BenchmarkMemoryCache_Get(b *testing.B) {
+	c := NewMemoryCache(1000, 0)
+	_ = c.Set("foo", "bar")
+
+	for i := 0; i < b.N; i++ {
+		_, _ = c.Get("foo")
+	}
+}
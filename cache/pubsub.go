@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Publish sends data to the subscribers of channel, on every instance of the application.
+// Channels are namespaced with the cache prefix.
+func (c *RedisCache) Publish(channel string, data []byte) error {
+	conn := c.conn()
+	defer conn.Close()
+
+	_, err := conn.Do("PUBLISH", c.pubSubChannel(channel), data)
+	return err
+}
+
+// Subscribe calls handle with the data of every message published to channel, until the
+// connection to redis fails, so it should be run in its own goroutine
+func (c *RedisCache) Subscribe(channel string, handle func(data []byte)) error {
+	psc := redis.PubSubConn{Conn: c.pubSubConn()}
+	defer psc.Close()
+
+	err := psc.Subscribe(c.pubSubChannel(channel))
+	if err != nil {
+		return err
+	}
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			handle(v.Data)
+		case error:
+			return v
+		}
+	}
+}
+
+func (c *RedisCache) pubSubChannel(channel string) string {
+	return fmt.Sprintf("%s:%s", c.Prefix, channel)
+}
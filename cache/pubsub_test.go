@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestRedisCache_Publish(t *testing.T) {
+	received := make(chan string, 1)
+	go func() {
+		_ = testRedisCache.Subscribe("pubsub-test", func(data []byte) {
+			received <- string(data)
+		})
+	}()
+
+	// publish until the subscriber is listening, as it subscribes asynchronously
+	waitFor(t, func() bool {
+		if err := testRedisCache.Publish("pubsub-test", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case data := <-received:
+			if data != "hello" {
+				t.Fatal("wrong message:", data)
+			}
+			return true
+		default:
+			return false
+		}
+	})
+}
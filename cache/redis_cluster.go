@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+)
+
+// deleteBatchSize is the number of keys removed by a single DEL command
+const deleteBatchSize = 500
+
+// conn returns a connection to redis. In cluster mode, the connection is bound to the
+// node holding key, if one is given, and follows redirections when slots have moved.
+func (c *RedisCache) conn(key ...string) redis.Conn {
+	if c.Cluster == nil {
+		return c.Conn.Get()
+	}
+
+	conn := c.Cluster.Get()
+	if len(key) > 0 {
+		_ = redisc.BindConn(conn, key...)
+	}
+
+	retryConn, err := redisc.RetryConn(conn, 3, 100*time.Millisecond)
+	if err != nil {
+		return conn
+	}
+
+	return retryConn
+}
+
+// pubSubConn returns a connection for publish/subscribe. Messages published on any
+// node of a cluster are delivered to subscribers on every node.
+func (c *RedisCache) pubSubConn() redis.Conn {
+	if c.Cluster == nil {
+		return c.Conn.Get()
+	}
+
+	return c.Cluster.Get()
+}
+
+// multi runs cmds, each a command name followed by its key and arguments, in a MULTI
+// transaction. In a cluster the keys may be held by different nodes, so there the
+// commands are run one at a time instead.
+func (c *RedisCache) multi(cmds [][]interface{}) error {
+	if c.Cluster != nil {
+		for _, cmd := range cmds {
+			err := c.do(cmd)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	conn := c.conn()
+	defer conn.Close()
+
+	_ = conn.Send("MULTI")
+	for _, cmd := range cmds {
+		_ = conn.Send(cmd[0].(string), cmd[1:]...)
+	}
+
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+// do runs a single command on the node holding its key. The key of a script run with
+// EVAL follows the script and the number of keys.
+func (c *RedisCache) do(cmd []interface{}) error {
+	key := cmd[1]
+	if cmd[0] == "EVAL" {
+		key = cmd[3]
+	}
+
+	conn := c.conn(fmt.Sprint(key))
+	defer conn.Close()
+
+	_, err := conn.Do(cmd[0].(string), cmd[1:]...)
+	return err
+}
+
+// del removes keys, in batches. In a cluster the keys may be held by different nodes,
+// so there they are removed one at a time.
+func (c *RedisCache) del(keys ...string) error {
+	if c.Cluster != nil {
+		for _, key := range keys {
+			err := c.do([]interface{}{"DEL", key})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	conn := c.conn()
+	defer conn.Close()
+
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		_, err := conn.Do("DEL", redis.Args{}.AddFlat(keys[start:end])...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scan returns every key matching pattern, from every primary node in a cluster
+func (c *RedisCache) scan(pattern string) ([]string, error) {
+	if c.Cluster == nil {
+		conn := c.conn()
+		defer conn.Close()
+
+		return scanConn(conn, pattern)
+	}
+
+	var keys []string
+	err := c.Cluster.EachNode(false, func(addr string, conn redis.Conn) error {
+		k, err := scanConn(conn, pattern)
+		if err != nil {
+			return fmt.Errorf("scanning %s: %w", addr, err)
+		}
+		keys = append(keys, k...)
+		return nil
+	})
+
+	return keys, err
+}
+
+// scanConn returns every key matching pattern on the server conn is connected to
+func scanConn(conn redis.Conn, pattern string) ([]string, error) {
+	iter := 0
+	keys := []string{}
+
+	for {
+		arr, err := redis.Values(conn.Do("SCAN", iter, "MATCH", pattern))
+		if err != nil {
+			return keys, err
+		}
+
+		iter, _ = redis.Int(arr[0], nil)
+		k, _ := redis.Strings(arr[1], nil)
+		keys = append(keys, k...)
+
+		if iter == 0 {
+			break
+		}
+	}
+
+	return keys, nil
+}
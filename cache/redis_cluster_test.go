@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/mna/redisc"
+)
+
+func testClusterCache(t *testing.T) *RedisCache {
+	cluster := &redisc.Cluster{StartupNodes: []string{testRedisAddr}}
+	t.Cleanup(func() {
+		_ = cluster.Close()
+	})
+
+	err := cluster.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &RedisCache{Cluster: cluster, Prefix: "test-cluster"}
+}
+
+func TestRedisCache_Cluster(t *testing.T) {
+	c := testClusterCache(t)
+
+	err := c.Set("foo", "bar", 60)
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := c.Get("foo")
+	if err != nil || x != "bar" {
+		t.Error("did not get correct value from cluster:", x, err)
+	}
+
+	err = c.SetMany(map[string]interface{}{"a": "alpha", "b": "beta"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	items, err := c.GetMany("a", "b", "missing")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(items) != 2 || items["a"] != "alpha" || items["b"] != "beta" {
+		t.Error("wrong items returned from cluster:", items)
+	}
+
+	err = c.SetWithTags("tagged", "value", []string{"group"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.FlushTags("group")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if inCache, _ := c.Has("tagged"); inCache {
+		t.Error("tagged found in cluster after its tag was flushed")
+	}
+
+	n, err := c.Increment("counter", 5)
+	if err != nil || n != 5 {
+		t.Error("did not increment counter in cluster:", n, err)
+	}
+}
+
+func TestRedisCache_ClusterEmpty(t *testing.T) {
+	c := testClusterCache(t)
+
+	_ = c.Set("alpha", "a")
+	_ = c.Set("beta", "b")
+
+	keys, err := c.getKeys(c.Prefix + ":")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) < 2 {
+		t.Error("expected keys from every node, got", keys)
+	}
+
+	err = c.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, key := range []string{"alpha", "beta"} {
+		if inCache, _ := c.Has(key); inCache {
+			t.Error(key, "found in cluster after it was emptied")
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrNotMaster is returned when a server reported as master by sentinel is no longer the
+// master, which happens for a short time during a failover
+var ErrNotMaster = errors.New("cache: redis server is not the master")
+
+// Sentinel discovers the current master of a group of redis servers monitored by redis
+// sentinel, so that connections follow the master when it fails over
+type Sentinel struct {
+	// Addrs are the addresses of the sentinels
+	Addrs []string
+	// MasterName is the name of the group, as configured in the sentinels
+	MasterName string
+	// DialOptions are used to connect to the sentinels
+	DialOptions []redis.DialOption
+	mu          sync.Mutex
+}
+
+// MasterAddr asks the sentinels, in turn, for the address of the current master. The
+// first sentinel to answer is asked first next time.
+func (s *Sentinel) MasterAddr() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lastErr error
+	for i, addr := range s.Addrs {
+		master, err := s.askSentinel(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		copy(s.Addrs[1:i+1], s.Addrs[:i])
+		s.Addrs[0] = addr
+
+		return master, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no sentinel addresses")
+	}
+
+	return "", fmt.Errorf("cache: no sentinel knows the master %s: %w", s.MasterName, lastErr)
+}
+
+func (s *Sentinel) askSentinel(addr string) (string, error) {
+	conn, err := redis.Dial("tcp", addr, s.DialOptions...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	res, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", s.MasterName))
+	if err != nil {
+		return "", err
+	}
+	if len(res) != 2 {
+		return "", fmt.Errorf("unexpected reply from sentinel %s", addr)
+	}
+
+	return net.JoinHostPort(res[0], res[1]), nil
+}
+
+// Dial connects to the current master with options, and checks that it is still the master
+func (s *Sentinel) Dial(options ...redis.DialOption) (redis.Conn, error) {
+	addr, err := s.MasterAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := redis.Dial("tcp", addr, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = TestRole(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// TestRole returns ErrNotMaster if conn is not connected to a master. Use it as TestOnBorrow
+// in a pool dialled with Sentinel.Dial, so that connections to a master that has since
+// been demoted are discarded.
+func TestRole(conn redis.Conn) error {
+	values, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+
+	if len(values) == 0 {
+		return ErrNotMaster
+	}
+
+	role, err := redis.String(values[0], nil)
+	if err != nil || role != "master" {
+		return ErrNotMaster
+	}
+
+	return nil
+}
+
+// TestOnBorrow checks the role of pooled connections that have been idle for more than a
+// second, and is meant for the TestOnBorrow field of a redis.Pool
+func (s *Sentinel) TestOnBorrow(conn redis.Conn, t time.Time) error {
+	if time.Since(t) < time.Second {
+		return nil
+	}
+
+	return TestRole(conn)
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSentinel answers the few commands used to discover a master. It acts as both the
+// sentinel and the master it reports, so that Dial can be tested without real servers.
+type fakeSentinel struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	role string
+}
+
+func newFakeSentinel(t *testing.T) *fakeSentinel {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+
+	f := &fakeSentinel{ln: ln, role: "master"}
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeSentinel) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeSentinel) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		role := f.role
+		f.mu.Unlock()
+
+		host, port, _ := net.SplitHostPort(f.ln.Addr().String())
+
+		switch strings.ToUpper(args[0]) {
+		case "SENTINEL":
+			fmt.Fprintf(conn, "*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+		case "ROLE":
+			fmt.Fprintf(conn, "*3\r\n$%d\r\n%s\r\n:0\r\n*0\r\n", len(role), role)
+		default:
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+	}
+}
+
+func (f *fakeSentinel) setRole(role string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.role = role
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if _, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSpace(arg)
+	}
+
+	return args, nil
+}
+
+func TestSentinel_Dial(t *testing.T) {
+	f := newFakeSentinel(t)
+
+	s := &Sentinel{
+		Addrs:      []string{"127.0.0.1:1", f.ln.Addr().String()},
+		MasterName: "mymaster",
+	}
+
+	addr, err := s.MasterAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != f.ln.Addr().String() {
+		t.Error("wrong master address:", addr)
+	}
+	if s.Addrs[0] != f.ln.Addr().String() {
+		t.Error("sentinel that answered was not moved to the front")
+	}
+
+	conn, err := s.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	f.setRole("slave")
+
+	if err = TestRole(conn); err != ErrNotMaster {
+		t.Error("expected ErrNotMaster after failover, got", err)
+	}
+
+	if _, err = s.Dial(); err != ErrNotMaster {
+		t.Error("expected ErrNotMaster dialling a demoted master, got", err)
+	}
+}
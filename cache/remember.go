@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrWrongType is returned by GetAs when the cached value is not of the requested type
+var ErrWrongType = errors.New("cache: value is not of the requested type")
+
+// group coalesces concurrent calls to Remember for the same cache and key
+var group singleflight.Group
+
+// registered records the types of remembered values already registered with gob
+var registered sync.Map
+
+// remembered wraps values stored by Remember with WithStale, recording until when
+// the value is fresh. After that, it is served while being refreshed in the background.
+type remembered[T any] struct {
+	Value      T
+	FreshUntil time.Time
+}
+
+type rememberOptions struct {
+	lock     Locker
+	lockWait time.Duration
+	stale    int
+}
+
+// RememberOption configures Remember
+type RememberOption func(*rememberOptions)
+
+// WithLock makes Remember take a lock from l before computing a value, so that only one
+// instance of the application computes it at a time. Other instances wait up to wait for
+// the value to appear in the cache, and then compute it themselves.
+func WithLock(l Locker, wait time.Duration) RememberOption {
+	return func(o *rememberOptions) {
+		o.lock = l
+		o.lockWait = wait
+	}
+}
+
+// WithStale keeps values for a further seconds after they expire. During that time the
+// stale value is returned immediately, while a fresh value is computed in the background.
+func WithStale(seconds int) RememberOption {
+	return func(o *rememberOptions) {
+		o.stale = seconds
+	}
+}
+
+// typedGetter is implemented by the caches which store encoded values, so that GetAs can
+// decode values straight into their type
+type typedGetter interface {
+	getInto(key string, target interface{}) error
+}
+
+// GetAs gets an item from the cache, as a value of type T. It returns ErrWrongType if
+// the item is not a T. Note that drivers which encode values with gob, such as redis and
+// badger, need custom types to be registered with gob.Register.
+func GetAs[T any](c Cache, key string) (T, error) {
+	var zero T
+
+	if tg, ok := c.(typedGetter); ok {
+		var typed T
+		if err := tg.getInto(key, &typed); err != nil {
+			return zero, err
+		}
+		return typed, nil
+	}
+
+	value, err := c.Get(key)
+	if err != nil {
+		return zero, err
+	}
+
+	typed, ok := value.(T)
+	if !ok {
+		return zero, ErrWrongType
+	}
+
+	return typed, nil
+}
+
+// Remember returns the value stored in the cache for key. If there is none, it calls fn,
+// and stores the result for ttl seconds. Concurrent calls for the same key share a single
+// call to fn. Errors from fn are returned, and nothing is stored.
+func Remember[T any](c Cache, key string, ttl int, fn func() (T, error), opts ...RememberOption) (T, error) {
+	var o rememberOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.stale > 0 {
+		return rememberStale(c, key, ttl, fn, o)
+	}
+
+	if value, err := GetAs[T](c, key); err == nil {
+		return value, nil
+	}
+
+	lookup := func() (T, bool) {
+		value, err := GetAs[T](c, key)
+		return value, err == nil
+	}
+
+	store := func(value T) error {
+		return c.Set(key, value, ttl)
+	}
+
+	return compute(c, key, fn, o, lookup, store)
+}
+
+// rememberStale implements Remember with stale-while-revalidate
+func rememberStale[T any](c Cache, key string, ttl int, fn func() (T, error), o rememberOptions) (T, error) {
+	registerRemembered[T]()
+
+	lookup := func() (remembered[T], bool) {
+		entry, err := GetAs[remembered[T]](c, key)
+		return entry, err == nil
+	}
+
+	store := func(value T) error {
+		entry := remembered[T]{
+			Value:      value,
+			FreshUntil: time.Now().Add(time.Duration(ttl) * time.Second),
+		}
+		return c.Set(key, entry, ttl+o.stale)
+	}
+
+	if entry, ok := lookup(); ok {
+		if time.Now().After(entry.FreshUntil) {
+			// refresh in the background; DoChan makes sure only one refresh runs at a time
+			group.DoChan(groupKey(c, "refresh:"+key), func() (interface{}, error) {
+				value, err := fn()
+				if err != nil {
+					return nil, err
+				}
+				return value, store(value)
+			})
+		}
+
+		return entry.Value, nil
+	}
+
+	freshLookup := func() (T, bool) {
+		entry, ok := lookup()
+		return entry.Value, ok
+	}
+
+	return compute(c, key, fn, o, freshLookup, store)
+}
+
+// registerRemembered registers remembered[T] with gob, once for each T
+func registerRemembered[T any]() {
+	entry := remembered[T]{}
+	if _, loaded := registered.LoadOrStore(reflect.TypeOf(entry), true); !loaded {
+		gob.Register(entry)
+	}
+}
+
+// compute calls fn once for all concurrent callers in this process, and if WithLock was
+// given, once across all instances, and stores the result
+func compute[T any](c Cache, key string, fn func() (T, error), o rememberOptions, lookup func() (T, bool), store func(T) error) (T, error) {
+	v, err, _ := group.Do(groupKey(c, key), func() (interface{}, error) {
+		// another caller may have stored the value while we were waiting
+		if value, ok := lookup(); ok {
+			return value, nil
+		}
+
+		if o.lock != nil {
+			release, value, ok := waitForLock(o, key, lookup)
+			if ok {
+				return value, nil
+			}
+			defer release()
+		}
+
+		value, err := fn()
+		if err != nil {
+			return value, err
+		}
+
+		return value, store(value)
+	})
+
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	t, _ := v.(T)
+	return t, nil
+}
+
+// waitForLock tries to take the lock for key until o.lockWait has passed. While it waits,
+// it checks whether another instance has stored the value, and returns it if so.
+func waitForLock[T any](o rememberOptions, key string, lookup func() (T, bool)) (func(), T, bool) {
+	lockKey := "remember:" + key
+	deadline := time.Now().Add(o.lockWait)
+	ttl := o.lockWait + 30*time.Second
+
+	for {
+		token, err := o.lock.Acquire(lockKey, ttl)
+		if err != ErrLocked || time.Now().After(deadline) {
+			return func() {
+				if err == nil {
+					_ = o.lock.Release(lockKey, token)
+				}
+			}, *new(T), false
+		}
+
+		time.Sleep(lockRetryInterval)
+
+		if value, ok := lookup(); ok {
+			return func() {}, value, true
+		}
+	}
+}
+
+// groupKey identifies a key in a particular cache, so that different caches do not share calls
+func groupKey(c Cache, key string) string {
+	return fmt.Sprintf("%p:%s", c, key)
+}
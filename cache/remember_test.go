@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetAs(t *testing.T) {
+	_ = testMemoryCache.Set("typed", 42)
+
+	n, err := GetAs[int](testMemoryCache, "typed")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 42 {
+		t.Error("wrong value returned:", n)
+	}
+
+	_, err = GetAs[string](testMemoryCache, "typed")
+	if err != ErrWrongType {
+		t.Error("expected ErrWrongType, but got", err)
+	}
+}
+
+func TestRemember(t *testing.T) {
+	c := NewMemoryCache(100, 0)
+	var calls int32
+
+	fn := func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "computed", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := Remember(c, "remember", 60, fn)
+			if err != nil {
+				t.Error(err)
+			}
+			if value != "computed" {
+				t.Error("wrong value returned:", value)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := Remember(c, "remember", 60, fn)
+	if err != nil || value != "computed" {
+		t.Error("wrong value returned from cache:", value, err)
+	}
+
+	if calls != 1 {
+		t.Error("expected fn to be called once, but it was called", calls, "times")
+	}
+}
+
+func TestRemember_Error(t *testing.T) {
+	c := NewMemoryCache(100, 0)
+
+	_, err := Remember(c, "fails", 60, func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	if err == nil {
+		t.Error("error from fn was not returned")
+	}
+
+	if inCache, _ := c.Has("fails"); inCache {
+		t.Error("value stored in cache after an error")
+	}
+}
+
+func TestRemember_NilInterface(t *testing.T) {
+	c := NewMemoryCache(100, 0)
+
+	value, err := Remember(c, "nothing", 60, func() (fmt.Stringer, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if value != nil {
+		t.Error("expected nil, got", value)
+	}
+}
+
+func TestRemember_Stale(t *testing.T) {
+	c := NewMemoryCache(100, 0)
+	var calls int32
+
+	fn := func() (int32, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	value, _ := Remember(c, "stale", 60, fn, WithStale(60))
+	if value != 1 {
+		t.Error("wrong value returned:", value)
+	}
+
+	// make the entry stale
+	entry, _ := GetAs[remembered[int32]](c, "stale")
+	entry.FreshUntil = time.Now().Add(-time.Second)
+	_ = c.Set("stale", entry, 60)
+
+	value, _ = Remember(c, "stale", 60, fn, WithStale(60))
+	if value != 1 {
+		t.Error("stale value was not returned:", value)
+	}
+
+	waitFor(t, func() bool {
+		value, _ = Remember(c, "stale", 60, fn, WithStale(60))
+		return value == 2
+	})
+}
+
+func TestRemember_Redis(t *testing.T) {
+	_ = testRedisCache.Forget("remember-redis")
+	var calls int32
+
+	fn := func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "computed", nil
+	}
+
+	for i := 0; i < 2; i++ {
+		value, err := Remember[string](&testRedisCache, "remember-redis", 60, fn, WithLock(&testRedisCache, time.Second))
+		if err != nil {
+			t.Error(err)
+		}
+		if value != "computed" {
+			t.Error("wrong value returned:", value)
+		}
+	}
+
+	if calls != 1 {
+		t.Error("expected fn to be called once, but it was called", calls, "times")
+	}
+}
+
+func TestRemember_WaitsForLock(t *testing.T) {
+	lockers := map[string]struct {
+		cache  Cache
+		locker Locker
+	}{
+		"redis":  {&testRedisCache, &testRedisCache},
+		"badger": {&testBadgerCache, &testBadgerCache},
+	}
+
+	for name, l := range lockers {
+		_ = l.cache.Forget("remember-locked")
+
+		// another instance holds the lock, and stores the value shortly
+		token, err := l.locker.Acquire("remember:remember-locked", time.Minute)
+		if err != nil {
+			t.Fatal(name, "could not take lock", err)
+		}
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			_ = l.cache.Set("remember-locked", "from other instance")
+			_ = l.locker.Release("remember:remember-locked", token)
+		}()
+
+		value, err := Remember(l.cache, "remember-locked", 60, func() (string, error) {
+			return "computed", nil
+		}, WithLock(l.locker, time.Second))
+		if err != nil {
+			t.Error(name, err)
+		}
+
+		if value != "from other instance" {
+			t.Error(name, "did not wait for the value from the lock holder; got", value)
+		}
+	}
+}
+
+func TestRedisCache_unlock(t *testing.T) {
+	ok, _ := testRedisCache.tryLock("lock-test", "a", time.Minute)
+	if !ok {
+		t.Error("could not take lock")
+	}
+
+	ok, _ = testRedisCache.tryLock("lock-test", "b", time.Minute)
+	if ok {
+		t.Error("took lock that is already held")
+	}
+
+	ok, _ = testRedisCache.unlock("lock-test", "b")
+	if ok {
+		t.Error("released lock held by another token")
+	}
+
+	ok, _ = testRedisCache.unlock("lock-test", "a")
+	if !ok {
+		t.Error("could not release lock")
+	}
+}
+
+type rememberedProduct struct {
+	ID    int
+	Name  string
+	Price float64
+	Tags  []string
+}
+
+func TestRemember_Codecs(t *testing.T) {
+	want := rememberedProduct{ID: 7, Name: "kettle", Price: 19.5, Tags: []string{"kitchen"}}
+	gob.Register(rememberedProduct{})
+
+	for _, codec := range []Codec{Gob, JSON, Msgpack} {
+		c := testRedisCache
+		c.Encoding = Encoding{Codec: codec}
+		_ = c.Forget("product")
+		_ = c.Forget("stale-product")
+
+		calls := 0
+		fn := func() (rememberedProduct, error) {
+			calls++
+			return want, nil
+		}
+
+		for i := 0; i < 3; i++ {
+			got, err := Remember(&c, "product", 60, fn)
+			if err != nil || got.Name != want.Name || got.Price != want.Price || len(got.Tags) != 1 {
+				t.Errorf("codec %d: wrong value returned: %+v %v", codec, got, err)
+			}
+
+			_, err = Remember(&c, "stale-product", 60, fn, WithStale(60))
+			if err != nil {
+				t.Errorf("codec %d: %v", codec, err)
+			}
+		}
+
+		if calls != 2 {
+			t.Errorf("codec %d: expected the values to be computed once each, but fn was called %d times", codec, calls)
+		}
+
+		got, err := GetAs[rememberedProduct](&c, "product")
+		if err != nil || got.ID != want.ID {
+			t.Errorf("codec %d: GetAs returned %+v %v", codec, got, err)
+		}
+
+		_, err = GetAs[int](&c, "product")
+		if !errors.Is(err, ErrWrongType) {
+			t.Errorf("codec %d: expected ErrWrongType, but got %v", codec, err)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// responseKeyPrefix starts the keys of cached responses, followed by the request path
+const responseKeyPrefix = "response:"
+
+// ResponseCache is middleware that caches whole responses to GET requests, and serves
+// them to later GET and HEAD requests. Only use it for routes whose responses are the same
+// for every user, since responses are shared by everyone who requests the same url.
+//
+// Middleware outside ResponseCache, such as the session and CSRF middleware, may write
+// cookies it cannot see, and handlers may render data for the user, such as a CSRF token
+// or a flash message. Requests with one of SkipCookies, such as the session cookie,
+// therefore bypass the cache, and the requests whose responses are to be shared are
+// marked, so that renderers can leave out per-user data; see IsShared.
+type ResponseCache struct {
+	Cache Cache
+	// TTL is how many seconds responses are cached for
+	TTL int
+	// Vary lists request headers whose values select different responses
+	Vary []string
+	// Tags are stored with every response, so that they can be removed with FlushTags
+	Tags []string
+	// SkipCookies lists cookies whose requests are neither served from nor stored in the
+	// cache
+	SkipCookies []string
+}
+
+// ResponseOption configures a ResponseCache
+type ResponseOption func(*ResponseCache)
+
+// WithVary caches a separate response for every combination of values of headers, such
+// as Accept-Language or Accept
+func WithVary(headers ...string) ResponseOption {
+	return func(rc *ResponseCache) {
+		rc.Vary = append(rc.Vary, headers...)
+	}
+}
+
+// WithTags stores responses with tags, so that they can be removed with FlushTags
+func WithTags(tags ...string) ResponseOption {
+	return func(rc *ResponseCache) {
+		rc.Tags = append(rc.Tags, tags...)
+	}
+}
+
+// WithoutCookies bypasses the cache for requests which have any of the cookies names,
+// such as the session cookie
+func WithoutCookies(names ...string) ResponseOption {
+	return func(rc *ResponseCache) {
+		rc.SkipCookies = append(rc.SkipCookies, names...)
+	}
+}
+
+// sharedKey marks the context of a request whose response is stored for everyone
+type sharedKey struct{}
+
+// IsShared reports whether the response to the request with ctx is stored in a response
+// cache and served to everyone, in which case it must not contain data for the user,
+// such as a CSRF token or a flash message
+func IsShared(ctx context.Context) bool {
+	shared, _ := ctx.Value(sharedKey{}).(bool)
+	return shared
+}
+
+// NewResponseCache returns middleware which caches responses in c for ttl seconds
+func NewResponseCache(c Cache, ttl int, opts ...ResponseOption) *ResponseCache {
+	rc := &ResponseCache{
+		Cache: c,
+		TTL:   ttl,
+	}
+
+	for _, opt := range opts {
+		opt(rc)
+	}
+
+	return rc
+}
+
+// cachedResponse is a response stored in the cache
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Middleware serves cached responses when there are any, and caches the responses of
+// next otherwise. Every response gets an ETag, and requests whose If-None-Match matches it
+// are answered with 304 Not Modified. Requests with Cache-Control: no-store bypass the
+// cache, as do requests with one of SkipCookies, and no-cache skips the cached response
+// but still stores the new one. Responses that set cookies, or that have Cache-Control
+// no-store or private, are not stored.
+func (rc *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rc.Cache == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestControl := r.Header.Get("Cache-Control")
+		if hasDirective(requestControl, "no-store") || rc.skipped(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := rc.key(r)
+
+		if !hasDirective(requestControl, "no-cache") {
+			if resp, ok := rc.load(key); ok {
+				w.Header().Set("X-Cache", "HIT")
+				resp.write(w, r)
+				return
+			}
+		}
+
+		// a HEAD response has no body, so it cannot be used for GET requests
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), sharedKey{}, true)))
+
+		resp := &cachedResponse{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+		if resp.Status == http.StatusOK && resp.Header.Get("ETag") == "" {
+			resp.Header.Set("ETag", etag(resp.Body))
+		}
+		if len(rc.Vary) > 0 {
+			resp.Header.Add("Vary", strings.Join(rc.Vary, ", "))
+		}
+
+		if resp.cacheable() {
+			rc.store(key, resp)
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		resp.write(w, r)
+	})
+}
+
+// skipped reports whether r has one of SkipCookies
+func (rc *ResponseCache) skipped(r *http.Request) bool {
+	for _, name := range rc.SkipCookies {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// key identifies the response to r. The path is kept readable, so that responses can be
+// removed by path prefix; the query and the values of Vary headers are hashed.
+func (rc *ResponseCache) key(r *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(r.URL.RawQuery))
+	for _, header := range rc.Vary {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(r.Header.Values(header), ",")))
+	}
+
+	return responseKeyPrefix + r.URL.Path + "|" + hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// load returns the cached response stored at key. Responses are stored as base64 strings,
+// so that they survive every codec.
+func (rc *ResponseCache) load(key string) (*cachedResponse, bool) {
+	value, err := GetAs[string](rc.Cache, key)
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+
+	var resp cachedResponse
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&resp)
+	if err != nil {
+		return nil, false
+	}
+
+	return &resp, true
+}
+
+func (rc *ResponseCache) store(key string, resp *cachedResponse) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(resp); err != nil {
+		return
+	}
+
+	value := base64.StdEncoding.EncodeToString(b.Bytes())
+	if len(rc.Tags) > 0 {
+		_ = rc.Cache.SetWithTags(key, value, rc.Tags, rc.TTL)
+	} else {
+		_ = rc.Cache.Set(key, value, rc.TTL)
+	}
+}
+
+// InvalidateResponses removes every cached response for a path starting with prefix
+func InvalidateResponses(c Cache, prefix string) error {
+	return c.EmptyByMatch(responseKeyPrefix + prefix)
+}
+
+// cacheable reports whether the response may be stored
+func (resp *cachedResponse) cacheable() bool {
+	control := resp.Header.Get("Cache-Control")
+
+	return resp.Status == http.StatusOK &&
+		resp.Header.Get("Set-Cookie") == "" &&
+		!hasDirective(control, "no-store") &&
+		!hasDirective(control, "private")
+}
+
+// write sends the response, or 304 Not Modified if the client already has it
+func (resp *cachedResponse) write(w http.ResponseWriter, r *http.Request) {
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+
+	if tag := resp.Header.Get("ETag"); tag != "" && etagMatches(r.Header.Get("If-None-Match"), tag) {
+		w.Header().Del("Content-Length")
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(resp.Body)
+	}
+}
+
+// responseRecorder captures a response so that it can be stored before it is sent
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+// etag returns a strong ETag for body
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches tag, using weak comparison
+func etagMatches(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasDirective reports whether a Cache-Control header contains directive
+func hasDirective(cacheControl, directive string) bool {
+	for _, d := range strings.Split(cacheControl, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == directive || strings.HasPrefix(d, directive+"=") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testResponseHandler(calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = fmt.Fprintf(w, "%s %s", r.URL.Path, r.Header.Get("Accept-Language"))
+	})
+}
+
+func TestResponseCache_Middleware(t *testing.T) {
+	for name, c := range map[string]Cache{"memory": NewMemoryCache(100, 0), "redis": &testRedisCache} {
+		_ = c.Empty()
+
+		calls := 0
+		handler := NewResponseCache(c, 60).Middleware(testResponseHandler(&calls))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/products?page=1", nil))
+
+		if rr.Header().Get("X-Cache") != "MISS" || rr.Body.String() != "/products " {
+			t.Errorf("%s: unexpected first response: %s %s", name, rr.Header().Get("X-Cache"), rr.Body.String())
+		}
+
+		tag := rr.Header().Get("ETag")
+		if tag == "" {
+			t.Errorf("%s: no ETag on response", name)
+		}
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/products?page=1", nil))
+
+		if rr.Header().Get("X-Cache") != "HIT" || calls != 1 {
+			t.Errorf("%s: second request was not served from the cache; handler called %d times", name, calls)
+		}
+		if rr.Header().Get("Content-Type") != "text/plain" {
+			t.Errorf("%s: cached headers were not restored", name)
+		}
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/products?page=2", nil))
+		if calls != 2 {
+			t.Errorf("%s: a different query was served from the cache", name)
+		}
+
+		req := httptest.NewRequest("GET", "/products?page=1", nil)
+		req.Header.Set("If-None-Match", tag)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("%s: expected 304 with no body, got %d", name, rr.Code)
+		}
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("HEAD", "/products?page=1", nil))
+		if rr.Header().Get("X-Cache") != "HIT" || rr.Body.Len() != 0 {
+			t.Errorf("%s: HEAD request was not answered from the cache without a body", name)
+		}
+
+		err := InvalidateResponses(c, "/products")
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/products?page=1", nil))
+		if rr.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("%s: response was served from the cache after it was invalidated", name)
+		}
+	}
+}
+
+func TestResponseCache_Vary(t *testing.T) {
+	calls := 0
+	handler := NewResponseCache(NewMemoryCache(100, 0), 60, WithVary("Accept-Language")).Middleware(testResponseHandler(&calls))
+
+	for _, lang := range []string{"en", "el", "en"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", lang)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Body.String() != "/ "+lang {
+			t.Errorf("wrong response for %s: %s", lang, rr.Body.String())
+		}
+		if rr.Header().Get("Vary") != "Accept-Language" {
+			t.Error("Vary header not set")
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 calls to the handler, got %d", calls)
+	}
+}
+
+func TestResponseCache_NoStore(t *testing.T) {
+	c := NewMemoryCache(100, 0)
+	calls := 0
+
+	handler := NewResponseCache(c, 60, WithTags("pages")).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/private", nil))
+	}
+	if calls != 2 {
+		t.Error("response with Cache-Control: private was cached")
+	}
+
+	req := httptest.NewRequest("GET", "/public", nil)
+	req.Header.Set("Cache-Control", "no-store")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if c.Len() != 0 {
+		t.Error("request with Cache-Control: no-store was cached")
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/public", nil))
+	if c.Len() != 1 {
+		t.Error("response was not cached")
+	}
+
+	_ = c.FlushTags("pages")
+	if c.Len() != 0 {
+		t.Error("response was not removed by its tag")
+	}
+}
+
+func TestResponseCache_PerUser(t *testing.T) {
+	c := NewMemoryCache(100, 0)
+	calls := 0
+
+	handler := NewResponseCache(c, 60, WithoutCookies("session")).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = fmt.Fprintf(w, "shared=%v", IsShared(r.Context()))
+	}))
+
+	req := httptest.NewRequest("GET", "/page", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "user-a"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if c.Len() != 0 || rr.Body.String() != "shared=false" {
+		t.Errorf("request with a session cookie was cached: %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/page", nil))
+	if c.Len() != 1 || rr.Body.String() != "shared=true" {
+		t.Errorf("expected a shared, cached response, got %s", rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/page", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "user-a"})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if calls != 3 {
+		t.Error("request with a session cookie was served from the cache")
+	}
+}
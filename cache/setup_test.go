@@ -14,6 +14,8 @@ import (
 var (
 	testRedisCache  RedisCache
 	testBadgerCache BadgerCache
+	testMemoryCache = NewMemoryCache(1000, 0)
+	testRedisAddr   string
 )
 
 func TestMain(m *testing.M) {
@@ -22,6 +24,7 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 	defer s.Close()
+	testRedisAddr = s.Addr()
 
 	pool := redis.Pool{
 		MaxIdle:     50,
@@ -41,7 +44,7 @@ func TestMain(m *testing.M) {
 
 	// create a badger DB
 	if _, err := os.Stat("./testdata/tmp"); os.IsNotExist(err) {
-		err := os.Mkdir("./testdata/tmp", 0755)
+		err := os.MkdirAll("./testdata/tmp", 0755)
 		if err != nil {
 			log.Fatal(err)
 		}
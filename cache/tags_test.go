@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestCache_FlushTags(t *testing.T) {
+	caches := map[string]Cache{
+		"redis":  &testRedisCache,
+		"badger": &testBadgerCache,
+		"memory": NewMemoryCache(100, 0),
+		"tiered": NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60),
+	}
+
+	for name, c := range caches {
+		_ = c.Empty()
+
+		err := c.SetWithTags("user:42:profile", "profile", []string{"user:42"})
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		err = c.SetWithTags("product:1", "product", []string{"products"}, 60)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		err = c.SetWithTags("user:42:orders", "orders", []string{"user:42", "orders"})
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		_ = c.Set("untagged", "value")
+
+		err = c.FlushTags("user:42")
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		for _, key := range []string{"user:42:profile", "user:42:orders"} {
+			if inCache, _ := c.Has(key); inCache {
+				t.Errorf("%s: %s found in cache after its tag was flushed", name, key)
+			}
+		}
+
+		for _, key := range []string{"product:1", "untagged"} {
+			if inCache, _ := c.Has(key); !inCache {
+				t.Errorf("%s: %s not found in cache, and it should be there", name, key)
+			}
+		}
+
+		x, err := c.Get("product:1")
+		if err != nil || x != "product" {
+			t.Errorf("%s: did not get correct value for tagged entry: %v %v", name, x, err)
+		}
+	}
+}
+
+func TestTieredCache_FlushTagsBroadcast(t *testing.T) {
+	a := NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60)
+	b := NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60)
+	go func() {
+		_ = b.Listen()
+	}()
+
+	waitFor(t, func() bool {
+		_ = b.Local.Set("ready", true)
+		_ = a.publish("forget", "ready")
+		ok, _ := b.Local.Has("ready")
+		return !ok
+	})
+
+	_ = a.SetWithTags("tagged", "value", []string{"group"})
+
+	// b reads the entry from redis, so its local copy does not know about the tag
+	_ = b.Local.Forget("tagged")
+	_, _ = b.Get("tagged")
+	if inLocal, _ := b.Local.Has("tagged"); !inLocal {
+		t.Fatal("tagged not in local cache")
+	}
+
+	err := a.FlushTags("group")
+	if err != nil {
+		t.Error(err)
+	}
+
+	waitFor(t, func() bool {
+		ok, _ := b.Local.Has("tagged")
+		return !ok
+	})
+}
+
+func TestRedisCache_TagCleanup(t *testing.T) {
+	c := &testRedisCache
+	_ = c.Empty()
+
+	conn := c.Conn.Get()
+	defer conn.Close()
+
+	_ = c.SetWithTags("short", "value", []string{"group", "other"}, 10)
+	_ = c.SetWithTags("long", "value", []string{"group"}, 60)
+
+	ttl, _ := redis.Int(conn.Do("TTL", c.tagKey("group")))
+	if ttl <= 10 || ttl > 60 {
+		t.Error("expected the tag set to expire with its last entry, but its ttl is", ttl)
+	}
+
+	_ = c.SetWithTags("forever", "value", []string{"group"})
+	ttl, _ = redis.Int(conn.Do("TTL", c.tagKey("group")))
+	if ttl != -1 {
+		t.Error("expected the tag set of an entry without expiry to persist, but its ttl is", ttl)
+	}
+
+	err := c.Forget("short")
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, tag := range []string{"group", "other"} {
+		members, _ := c.tagMembers(tag)
+		for _, member := range members {
+			if member == "short" {
+				t.Errorf("forgotten entry is still a member of %s", tag)
+			}
+		}
+	}
+
+	_ = c.SetWithTags("both", "value", []string{"group", "other"})
+	err = c.FlushTags("group")
+	if err != nil {
+		t.Error(err)
+	}
+
+	members, _ := c.tagMembers("other")
+	if len(members) != 0 {
+		t.Error("flushed entries are still members of another tag:", members)
+	}
+}
+
+func TestCache_FlushTagsStaleIndex(t *testing.T) {
+	caches := map[string]Cache{
+		"badger": &testBadgerCache,
+		"memory": NewMemoryCache(100, 0),
+	}
+
+	for name, c := range caches {
+		_ = c.Empty()
+
+		// stored again without tags
+		_ = c.SetWithTags("retagged", "value", []string{"old"})
+		_ = c.Set("retagged", "value")
+
+		// forgotten, and stored again without tags
+		_ = c.SetWithTags("recreated", "value", []string{"old"})
+		_ = c.Forget("recreated")
+		_ = c.Set("recreated", "value")
+
+		// stored again with another tag
+		_ = c.SetWithTags("moved", "value", []string{"old"})
+		_ = c.SetWithTags("moved", "value", []string{"new"})
+
+		err := c.FlushTags("old")
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		for _, key := range []string{"retagged", "recreated", "moved"} {
+			if inCache, _ := c.Has(key); !inCache {
+				t.Errorf("%s: %s was flushed with a tag it no longer has", name, key)
+			}
+		}
+
+		_ = c.FlushTags("new")
+		if inCache, _ := c.Has("moved"); inCache {
+			t.Errorf("%s: moved was not flushed with its new tag", name)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// TieredCache keeps recently used entries in a process-local MemoryCache in front of
+// a RedisCache. Every change is broadcast over redis pub/sub, so that every instance
+// of the application evicts its local copy. Local entries also expire after LocalTTL
+// seconds, which bounds how stale a local copy can get if a broadcast is missed.
+type TieredCache struct {
+	Local    *MemoryCache
+	Remote   *RedisCache
+	LocalTTL int
+	nodeID   string
+}
+
+// invalidation is the message broadcast to other instances when the cache changes
+type invalidation struct {
+	Node string   `json:"node"`
+	Op   string   `json:"op"`
+	Key  string   `json:"key,omitempty"`
+	Keys []string `json:"keys,omitempty"`
+}
+
+// NewTieredCache returns a two tier cache. Call ListenForInvalidations in a goroutine
+// to evict local entries changed by other instances.
+func NewTieredCache(local *MemoryCache, remote *RedisCache, localTTL int) *TieredCache {
+	return &TieredCache{
+		Local:    local,
+		Remote:   remote,
+		LocalTTL: localTTL,
+		nodeID:   randomToken(),
+	}
+}
+
+func (c *TieredCache) Has(s string) (bool, error) {
+	if ok, _ := c.Local.Has(s); ok {
+		return true, nil
+	}
+
+	return c.Remote.Has(s)
+}
+
+func (c *TieredCache) Get(s string) (interface{}, error) {
+	if value, err := c.Local.Get(s); err == nil {
+		return value, nil
+	}
+
+	value, err := c.Remote.Get(s)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setLocal(s, value, c.LocalTTL)
+
+	return value, nil
+}
+
+// getInto gets an item into target, a pointer, from the local tier when it holds a value
+// of the right type, and otherwise from redis, decoding it into the type target points to
+func (c *TieredCache) getInto(s string, target interface{}) error {
+	if value, err := c.Local.Get(s); err == nil && assign(value, target) == nil {
+		return nil
+	}
+
+	err := c.Remote.getInto(s, target)
+	if err != nil {
+		return err
+	}
+
+	c.setLocal(s, reflect.ValueOf(target).Elem().Interface(), c.LocalTTL)
+
+	return nil
+}
+
+func (c *TieredCache) Set(s string, value interface{}, expires ...int) error {
+	err := c.Remote.Set(s, value, expires...)
+	if err != nil {
+		return err
+	}
+
+	c.setLocal(s, value, c.localTTL(expires...))
+
+	return c.publish("forget", s)
+}
+
+// SetWithTags stores value like Set, with tags in both tiers
+func (c *TieredCache) SetWithTags(s string, value interface{}, tags []string, expires ...int) error {
+	err := c.Remote.SetWithTags(s, value, tags, expires...)
+	if err != nil {
+		return err
+	}
+
+	ttl := c.localTTL(expires...)
+	if ttl > 0 {
+		_ = c.Local.SetWithTags(s, value, tags, ttl)
+	} else {
+		_ = c.Local.SetWithTags(s, value, tags)
+	}
+
+	return c.publish("forget", s)
+}
+
+// FlushTags removes every entry stored with any of tags. Since other instances may hold
+// local copies without knowing their tags, the keys removed from redis are broadcast.
+func (c *TieredCache) FlushTags(tags ...string) error {
+	_ = c.Local.FlushTags(tags...)
+
+	keys, err := c.Remote.flushTags(tags...)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		_ = c.Local.Forget(key)
+	}
+
+	return c.publishInvalidation(invalidation{Op: "keys", Keys: keys})
+}
+
+// Increment atomically adds delta to the counter in redis. Counters are not kept in the
+// local tier, since they change too often for local copies to be useful.
+func (c *TieredCache) Increment(s string, delta int64, expires ...int) (int64, error) {
+	_ = c.Local.Forget(s)
+
+	n, err := c.Remote.Increment(s, delta, expires...)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, c.publish("forget", s)
+}
+
+// Decrement atomically subtracts delta from the counter in redis
+func (c *TieredCache) Decrement(s string, delta int64, expires ...int) (int64, error) {
+	return c.Increment(s, -delta, expires...)
+}
+
+// Add stores value only if s is not already in redis, and reports whether it was stored
+func (c *TieredCache) Add(s string, value interface{}, expires ...int) (bool, error) {
+	ok, err := c.Remote.Add(s, value, expires...)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	c.setLocal(s, value, c.localTTL(expires...))
+
+	return true, c.publish("forget", s)
+}
+
+// GetMany gets several items, from the local tier where possible, and from redis for the rest
+func (c *TieredCache) GetMany(keys ...string) (map[string]interface{}, error) {
+	items, _ := c.Local.GetMany(keys...)
+
+	var missing []string
+	for _, key := range keys {
+		if _, ok := items[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) == 0 {
+		return items, nil
+	}
+
+	remote, err := c.Remote.GetMany(missing...)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range remote {
+		items[key] = value
+		c.setLocal(key, value, c.LocalTTL)
+	}
+
+	return items, nil
+}
+
+// SetMany stores several items in both tiers
+func (c *TieredCache) SetMany(items map[string]interface{}, expires ...int) error {
+	err := c.Remote.SetMany(items, expires...)
+	if err != nil {
+		return err
+	}
+
+	ttl := c.localTTL(expires...)
+	keys := make([]string, 0, len(items))
+	for key, value := range items {
+		c.setLocal(key, value, ttl)
+		keys = append(keys, key)
+	}
+
+	return c.publishInvalidation(invalidation{Op: "keys", Keys: keys})
+}
+
+// CompareAndSwap stores new in redis only if the value stored at s is currently old, and
+// reports whether it was stored. The comparison is always made against redis, never
+// against a possibly stale local copy.
+func (c *TieredCache) CompareAndSwap(s string, old, new interface{}, expires ...int) (bool, error) {
+	ok, err := c.Remote.CompareAndSwap(s, old, new, expires...)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	c.setLocal(s, new, c.localTTL(expires...))
+
+	return true, c.publish("forget", s)
+}
+
+func (c *TieredCache) Forget(s string) error {
+	_ = c.Local.Forget(s)
+
+	err := c.Remote.Forget(s)
+	if err != nil {
+		return err
+	}
+
+	return c.publish("forget", s)
+}
+
+func (c *TieredCache) EmptyByMatch(s string) error {
+	_ = c.Local.EmptyByMatch(s)
+
+	err := c.Remote.EmptyByMatch(s)
+	if err != nil {
+		return err
+	}
+
+	return c.publish("match", s)
+}
+
+func (c *TieredCache) Empty() error {
+	_ = c.Local.Empty()
+
+	err := c.Remote.Empty()
+	if err != nil {
+		return err
+	}
+
+	return c.publish("empty", "")
+}
+
+// ListenForInvalidations subscribes to invalidations broadcast by other instances, and
+// applies them to the local cache. It runs continually, reconnecting if the connection
+// to redis is lost, so it should be started in its own goroutine. Since broadcasts may
+// have been missed while disconnected, the local cache is emptied after reconnecting.
+func (c *TieredCache) ListenForInvalidations() {
+	for {
+		_ = c.Listen()
+		_ = c.Local.Empty()
+		time.Sleep(time.Second)
+	}
+}
+
+// Listen subscribes to invalidations and applies them to the local cache, until the
+// connection to redis fails
+func (c *TieredCache) Listen() error {
+	psc := redis.PubSubConn{Conn: c.Remote.pubSubConn()}
+	defer psc.Close()
+
+	err := psc.Subscribe(c.channel())
+	if err != nil {
+		return err
+	}
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			c.apply(v.Data)
+		case error:
+			return v
+		}
+	}
+}
+
+// apply evicts the local entries named by a broadcast invalidation
+func (c *TieredCache) apply(data []byte) {
+	var msg invalidation
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Node == c.nodeID {
+		return
+	}
+
+	switch msg.Op {
+	case "forget":
+		_ = c.Local.Forget(msg.Key)
+	case "match":
+		_ = c.Local.EmptyByMatch(msg.Key)
+	case "keys":
+		for _, key := range msg.Keys {
+			_ = c.Local.Forget(key)
+		}
+	case "empty":
+		_ = c.Local.Empty()
+	}
+}
+
+// setLocal stores value in the local cache for ttl seconds, or with no expiry if ttl is not positive
+func (c *TieredCache) setLocal(s string, value interface{}, ttl int) {
+	if ttl > 0 {
+		_ = c.Local.Set(s, value, ttl)
+	} else {
+		_ = c.Local.Set(s, value)
+	}
+}
+
+// localTTL returns how long to keep a local copy of an entry that expires after expires
+// seconds in redis
+func (c *TieredCache) localTTL(expires ...int) int {
+	ttl := c.LocalTTL
+	if len(expires) > 0 && (ttl <= 0 || expires[0] < ttl) {
+		ttl = expires[0]
+	}
+	return ttl
+}
+
+func (c *TieredCache) publish(op, key string) error {
+	return c.publishInvalidation(invalidation{Op: op, Key: key})
+}
+
+func (c *TieredCache) publishInvalidation(msg invalidation) error {
+	msg.Node = c.nodeID
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	conn := c.Remote.conn()
+	defer conn.Close()
+
+	_, err = conn.Do("PUBLISH", c.channel(), data)
+	return err
+}
+
+func (c *TieredCache) channel() string {
+	return fmt.Sprintf("%s:cache-invalidations", c.Remote.Prefix)
+}
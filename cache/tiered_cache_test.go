@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTieredCache_Get(t *testing.T) {
+	c := NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60)
+
+	err := c.Set("tiered-foo", "bar")
+	if err != nil {
+		t.Error(err)
+	}
+
+	_ = c.Local.Forget("tiered-foo")
+
+	x, err := c.Get("tiered-foo")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if x != "bar" {
+		t.Error("did not get correct value from cache")
+	}
+
+	if inLocal, _ := c.Local.Has("tiered-foo"); !inLocal {
+		t.Error("value read from redis was not stored in the local cache")
+	}
+}
+
+func TestTieredCache_Invalidation(t *testing.T) {
+	a := NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60)
+	b := NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60)
+	go func() {
+		_ = b.Listen()
+	}()
+
+	// wait for b to subscribe
+	waitFor(t, func() bool {
+		_ = b.Local.Set("ready", true)
+		_ = a.publish("forget", "ready")
+		ok, _ := b.Local.Has("ready")
+		return !ok
+	})
+
+	var tests = []struct {
+		name   string
+		key    string
+		change func() error
+	}{
+		{"set", "tiered-alpha", func() error { return a.Set("tiered-alpha", "new") }},
+		{"forget", "tiered-alpha", func() error { return a.Forget("tiered-alpha") }},
+		{"empty_by_match", "tiered-beta", func() error { return a.EmptyByMatch("tiered-b") }},
+		{"empty", "tiered-gamma", func() error { return a.Empty() }},
+	}
+
+	for _, e := range tests {
+		_ = b.Set(e.key, "old")
+		if inLocal, _ := b.Local.Has(e.key); !inLocal {
+			t.Errorf("%s: %s not in local cache", e.name, e.key)
+		}
+
+		err := e.change()
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+		}
+
+		waitFor(t, func() bool {
+			ok, _ := b.Local.Has(e.key)
+			return !ok
+		})
+	}
+}
+
+func TestTieredCache_IgnoresOwnInvalidations(t *testing.T) {
+	c := NewTieredCache(NewMemoryCache(100, 0), &testRedisCache, 60)
+	_ = c.Local.Set("mine", "value")
+
+	c.apply([]byte(`{"node":"` + c.nodeID + `","op":"forget","key":"mine"}`))
+
+	if inLocal, _ := c.Local.Has("mine"); !inLocal {
+		t.Error("local entry evicted by an invalidation from the same instance")
+	}
+}
+
+// waitFor fails the test if condition does not become true within a second
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Error("timed out waiting for condition")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/petrostrak/sokudo/assets"
+)
+
+func doAssets(arg2 string) (string, error) {
+	switch arg2 {
+	case "build":
+		manifest, err := assets.Build(skd.RootPath + "/public")
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Built %d assets into public/%s", len(manifest), assets.BuildDir), nil
+	default:
+		return "", errors.New("assets requires a subcommand: (build)")
+	}
+}
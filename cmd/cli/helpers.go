@@ -72,8 +72,16 @@ func showHelp() {
 	make auth                       - creates and runs migrations for authentication tables, and creates models and middleware
 	make handler <name>             - creates a stub handler in the handlers directory
 	make model <name>               - creates a new model in the data directory
-	make session                    - creates a table in the database as a session store
+	make session                    - creates the tables in the database for the session store and its index by user
+	make session-index              - creates the table indexing sessions by user, for sessions tables made before it existed
 	make mail <name>                - creates two starter mail templates in the mail directory
+	make outbox                     - creates a table in the database for the transactional outbox
+	make resource <name> <field:type>... [--api]
+	                                - creates a model, migration, handlers, views and routes for a resource;
+	                                  type=string/text/int/float/bool/date; --api creates json handlers instead of views
+	assets build                    - fingerprints and compresses the files in public into public/build, and writes a manifest
+	views check [func,...]          - parses every template in views and mail, and reports syntax errors and missing
+	                                  blocks, partials and functions; funcs names those the application adds
 	
 	`)
 }
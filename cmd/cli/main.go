@@ -48,14 +48,24 @@ func main() {
 			exitGracefully(err)
 		}
 		message = "Migrations complete"
+	case "assets":
+		message, err = doAssets(arg2)
+		if err != nil {
+			exitGracefully(err)
+		}
 	case "make":
 		if arg2 == "" {
-			exitGracefully(errors.New("make requires a subcommand: (migration|handler|model|session)"))
+			exitGracefully(errors.New("make requires a subcommand: (migration|handler|model|session|session-index|outbox|resource)"))
 		}
 		err = doMake(arg2, arg3, arg4)
 		if err != nil {
 			exitGracefully(err)
 		}
+	case "views":
+		message, err = doViews(arg2, arg3)
+		if err != nil {
+			exitGracefully(err)
+		}
 	default:
 		showHelp()
 	}
@@ -95,6 +105,8 @@ func exitGracefully(err error, msg ...string) {
 
 	if err != nil {
 		color.Red("Error: %v\n", err)
+		// a non-zero status lets scripts, such as builds, stop on the error
+		os.Exit(1)
 	}
 
 	if len(message) > 0 {
@@ -6,7 +6,6 @@ import (
 	"strings"
 
 	"github.com/fatih/color"
-	"github.com/gertd/go-pluralize"
 	"github.com/iancoleman/strcase"
 )
 
@@ -85,17 +84,7 @@ func doMake(arg2, arg3, arg4 string) error {
 
 		model := string(data)
 
-		plur := pluralize.NewClient()
-
-		var modelName = arg3
-		var tableName = arg3
-
-		if plur.IsPlural(arg3) {
-			modelName = plur.Singular(arg3)
-			tableName = strings.ToLower(tableName)
-		} else {
-			tableName = strings.ToLower(plur.Plural(arg3))
-		}
+		modelName, tableName := modelAndTableNames(arg3)
 
 		fileName := skd.RootPath + "/data/" + strings.ToLower(modelName) + ".go"
 		if fileExists(fileName) {
@@ -132,6 +121,28 @@ func doMake(arg2, arg3, arg4 string) error {
 		if err != nil {
 			exitGracefully(err)
 		}
+
+	case "session-index":
+		err := doSessionIndexTable()
+		if err != nil {
+			exitGracefully(err)
+		}
+
+	case "outbox":
+		err := doOutboxTable()
+		if err != nil {
+			exitGracefully(err)
+		}
+
+	case "resource":
+		if arg3 == "" {
+			exitGracefully(errors.New("you must give the resource a name"))
+		}
+
+		err := doResource(arg3, resourceArgs())
+		if err != nil {
+			exitGracefully(err)
+		}
 	}
 
 	return nil
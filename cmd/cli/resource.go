@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/gertd/go-pluralize"
+	"github.com/iancoleman/strcase"
+)
+
+// resourceField describes one field passed to make resource as name:type
+type resourceField struct {
+	Column string
+	GoName string
+	Kind   string
+}
+
+// goTypes maps the field types accepted by make resource to go types
+var goTypes = map[string]string{
+	"string": "string",
+	"text":   "string",
+	"int":    "int",
+	"float":  "float64",
+	"bool":   "bool",
+	"date":   "time.Time",
+}
+
+// fizzTypes maps the field types accepted by make resource to fizz column types
+var fizzTypes = map[string]string{
+	"string": "string",
+	"text":   "text",
+	"int":    "integer",
+	"float":  "float",
+	"bool":   "bool",
+	"date":   "date",
+}
+
+// doResource creates a model, migration, handlers, views and a routes snippet for a resource.
+// args holds name:type field definitions, and optionally --api to create json handlers
+// instead of handlers that render views
+func doResource(name string, args []string) error {
+	checkForDB()
+
+	var fields []resourceField
+	api := false
+
+	for _, arg := range args {
+		if arg == "--api" {
+			api = true
+			continue
+		}
+
+		exploded := strings.Split(arg, ":")
+		if len(exploded) != 2 || exploded[0] == "" {
+			return fmt.Errorf("invalid field %s; fields must be in the form name:type", arg)
+		}
+
+		kind := strings.ToLower(exploded[1])
+		switch kind {
+		case "integer":
+			kind = "int"
+		case "boolean":
+			kind = "bool"
+		}
+
+		if _, ok := goTypes[kind]; !ok {
+			return fmt.Errorf("invalid type %s for field %s; must be one of string, text, int, float, bool or date", exploded[1], exploded[0])
+		}
+
+		fields = append(fields, resourceField{
+			Column: strcase.ToSnake(exploded[0]),
+			GoName: strcase.ToCamel(exploded[0]),
+			Kind:   kind,
+		})
+	}
+
+	if len(fields) == 0 {
+		return errors.New("you must give the resource at least one field, e.g. title:string")
+	}
+
+	modelName, tableName := modelAndTableNames(name)
+
+	replacer := strings.NewReplacer(
+		"$MODELNAME$", modelName,
+		"$MODELVAR$", strcase.ToLowerCamel(modelName),
+		"$PLURALNAME$", strcase.ToCamel(tableName),
+		"$TABLENAME$", tableName,
+	)
+
+	// model
+	modelFile := skd.RootPath + "/data/" + strcase.ToSnake(modelName) + ".go"
+	handlerFile := skd.RootPath + "/handlers/" + tableName + ".go"
+	viewDir := skd.RootPath + "/views/" + tableName
+
+	for _, f := range []string{modelFile, handlerFile} {
+		if fileExists(f) {
+			return errors.New(f + " already exists!")
+		}
+	}
+
+	err := writeResourceFile("templates/resource/model.go.txt", modelFile, replacer, map[string]string{
+		"$FIELDS$": resourceStructFields(fields),
+	})
+	if err != nil {
+		return err
+	}
+
+	// migration
+	up, down := resourceMigration(tableName, fields)
+	err = skd.CreatePopMigration([]byte(up), []byte(down), "create_"+tableName+"_table", "fizz")
+	if err != nil {
+		return err
+	}
+
+	// handlers, and views if we are not building an api
+	if api {
+		err = writeResourceFile("templates/resource/handlers-api.go.txt", handlerFile, replacer, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		validation, assignments, imports := resourceFormCode(fields, strcase.ToLowerCamel(modelName))
+		err = writeResourceFile("templates/resource/handlers.go.txt", handlerFile, replacer, map[string]string{
+			"$IMPORTS$":     imports,
+			"$VALIDATION$":  validation,
+			"$ASSIGNMENTS$": assignments,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = skd.CreateDirIfNotExist(viewDir)
+		if err != nil {
+			return err
+		}
+
+		head, row, detail, form := resourceViewFragments(fields, strcase.ToLowerCamel(modelName))
+		views := map[string]map[string]string{
+			"index": {"$TABLEHEAD$": head, "$TABLEROW$": row},
+			"show":  {"$DETAILFIELDS$": detail},
+			"form":  {"$FORMFIELDS$": form},
+		}
+
+		for view, fragments := range views {
+			err = writeResourceFile("templates/resource/"+view+".jet", viewDir+"/"+view+".jet", replacer, fragments)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	color.Yellow("  - %s model created", modelName)
+	color.Yellow("  - %s migration created", tableName)
+	color.Yellow("  - %s handlers created", tableName)
+	if !api {
+		color.Yellow("  - %s views created", tableName)
+	}
+	color.Yellow("")
+	color.Yellow("Run sokudo migrate, then add the following to your routes:")
+	color.Yellow("")
+	fmt.Println(resourceRoutes(replacer, api))
+
+	return nil
+}
+
+// modelAndTableNames returns the singular, camel case model name and the plural, snake case
+// table name for name, so that BlogPost gives BlogPost and blog_posts
+func modelAndTableNames(name string) (string, string) {
+	plur := pluralize.NewClient()
+
+	snake := strcase.ToSnake(name)
+	if plur.IsPlural(snake) {
+		return strcase.ToCamel(plur.Singular(snake)), snake
+	}
+
+	return strcase.ToCamel(snake), plur.Plural(snake)
+}
+
+// writeResourceFile reads a template, replaces the common placeholders and any extra
+// fragments, and writes the result to targetFile
+func writeResourceFile(templatePath, targetFile string, replacer *strings.Replacer, fragments map[string]string) error {
+	if fileExists(targetFile) {
+		return errors.New(targetFile + " already exists!")
+	}
+
+	data, err := templateFS.ReadFile(templatePath)
+	if err != nil {
+		return err
+	}
+
+	content := string(data)
+	for placeholder, value := range fragments {
+		content = strings.ReplaceAll(content, placeholder, value)
+	}
+	content = replacer.Replace(content)
+
+	return copyDataToFile([]byte(content), targetFile)
+}
+
+// resourceStructFields returns the struct fields for the model
+func resourceStructFields(fields []resourceField) string {
+	var lines []string
+	for _, f := range fields {
+		lines = append(lines, fmt.Sprintf("    %s %s `db:\"%s\" json:\"%s\"`", f.GoName, goTypes[f.Kind], f.Column, f.Column))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resourceMigration returns the up and down fizz migrations for the resource table
+func resourceMigration(tableName string, fields []resourceField) (string, string) {
+	var up strings.Builder
+
+	up.WriteString(fmt.Sprintf("create_table(\"%s\") {\n", tableName))
+	up.WriteString("  t.Column(\"id\", \"integer\", {primary: true})\n")
+	for _, f := range fields {
+		switch f.Kind {
+		case "string":
+			up.WriteString(fmt.Sprintf("  t.Column(\"%s\", \"string\", {\"size\": 255})\n", f.Column))
+		case "bool":
+			up.WriteString(fmt.Sprintf("  t.Column(\"%s\", \"bool\", {\"default\": false})\n", f.Column))
+		default:
+			up.WriteString(fmt.Sprintf("  t.Column(\"%s\", \"%s\", {})\n", f.Column, fizzTypes[f.Kind]))
+		}
+	}
+	up.WriteString("}")
+
+	return up.String(), fmt.Sprintf("drop_table(\"%s\")", tableName)
+}
+
+// resourceFormCode returns the validation and assignment statements used by the generated
+// handlers to read a form into the model, along with any extra imports they need
+func resourceFormCode(fields []resourceField, modelVar string) (string, string, string) {
+	var required, checks, assignments []string
+	imports := ""
+
+	for _, f := range fields {
+		value := fmt.Sprintf("r.Form.Get(\"%s\")", f.Column)
+
+		switch f.Kind {
+		case "string", "text":
+			required = append(required, fmt.Sprintf("%q", f.Column))
+			assignments = append(assignments, fmt.Sprintf("\t%s.%s = %s", modelVar, f.GoName, value))
+		case "int":
+			required = append(required, fmt.Sprintf("%q", f.Column))
+			checks = append(checks, fmt.Sprintf("\tform.IsInt(%q, %s)", f.Column, value))
+			assignments = append(assignments, fmt.Sprintf("\t%s.%s, _ = strconv.Atoi(%s)", modelVar, f.GoName, value))
+		case "float":
+			required = append(required, fmt.Sprintf("%q", f.Column))
+			checks = append(checks, fmt.Sprintf("\tform.IsFloat(%q, %s)", f.Column, value))
+			assignments = append(assignments, fmt.Sprintf("\t%s.%s, _ = strconv.ParseFloat(%s, 64)", modelVar, f.GoName, value))
+		case "date":
+			required = append(required, fmt.Sprintf("%q", f.Column))
+			checks = append(checks, fmt.Sprintf("\tform.IsDateISO(%q, %s)", f.Column, value))
+			assignments = append(assignments, fmt.Sprintf("\t%s.%s, _ = time.Parse(\"2006-01-02\", %s)", modelVar, f.GoName, value))
+			imports = "\n\t\"time\""
+		case "bool":
+			assignments = append(assignments, fmt.Sprintf("\t%s.%s = %s != \"\"", modelVar, f.GoName, value))
+		}
+	}
+
+	var validation []string
+	if len(required) > 0 {
+		validation = append(validation, fmt.Sprintf("\tform.Required(r, %s)", strings.Join(required, ", ")))
+	}
+	validation = append(validation, checks...)
+
+	return strings.Join(validation, "\n"), strings.Join(assignments, "\n") + "\n", imports
+}
+
+// resourceViewFragments returns the table header and row for the index view, the
+// detail list for the show view and the inputs for the form view
+func resourceViewFragments(fields []resourceField, modelVar string) (string, string, string, string) {
+	var head, row, detail, form []string
+
+	display := func(v string, f resourceField) string {
+		switch f.Kind {
+		case "date":
+			return fmt.Sprintf("{{%s.%s.Format(\"2006-01-02\")}}", v, f.GoName)
+		case "bool":
+			return fmt.Sprintf("{{%s.%s ? \"Yes\" : \"No\"}}", v, f.GoName)
+		default:
+			return fmt.Sprintf("{{%s.%s}}", v, f.GoName)
+		}
+	}
+
+	for _, f := range fields {
+		label := strcase.ToDelimited(f.GoName, ' ')
+		label = strings.ToUpper(label[:1]) + label[1:]
+
+		if f.Kind != "text" {
+			head = append(head, fmt.Sprintf("        <th>%s</th>", label))
+			row = append(row, fmt.Sprintf("        <td>%s</td>", display("item", f)))
+		}
+
+		detail = append(detail, fmt.Sprintf("    <dt class=\"col-sm-3\">%s</dt>\n    <dd class=\"col-sm-9\">%s</dd>", label, display(modelVar, f)))
+
+		// the posted value, if the form was submitted, otherwise the value of the model
+		posted := func(current string) string {
+			return fmt.Sprintf("{{isset(values[\"%s\"]) ? values[\"%s\"] : %s}}", f.Column, f.Column, current)
+		}
+
+		value := posted(fmt.Sprintf("%s.%s", modelVar, f.GoName))
+		var input string
+		switch f.Kind {
+		case "text":
+			input = fmt.Sprintf("<textarea class=\"form-control\" id=\"%s\" name=\"%s\" rows=\"5\">%s</textarea>", f.Column, f.Column, value)
+		case "int":
+			input = fmt.Sprintf("<input type=\"number\" class=\"form-control\" id=\"%s\" name=\"%s\" value=\"%s\">", f.Column, f.Column, value)
+		case "float":
+			input = fmt.Sprintf("<input type=\"number\" step=\"any\" class=\"form-control\" id=\"%s\" name=\"%s\" value=\"%s\">", f.Column, f.Column, value)
+		case "date":
+			value = posted(fmt.Sprintf("(%s.%s.IsZero() ? \"\" : %s.%s.Format(\"2006-01-02\"))", modelVar, f.GoName, modelVar, f.GoName))
+			input = fmt.Sprintf("<input type=\"date\" class=\"form-control\" id=\"%s\" name=\"%s\" value=\"%s\">", f.Column, f.Column, value)
+		case "bool":
+			input = fmt.Sprintf("<input type=\"checkbox\" class=\"form-check-input\" id=\"%s\" name=\"%s\" value=\"1\"{{if %s.%s}} checked{{end}}>", f.Column, f.Column, modelVar, f.GoName)
+		default:
+			input = fmt.Sprintf("<input type=\"text\" class=\"form-control\" id=\"%s\" name=\"%s\" value=\"%s\">", f.Column, f.Column, value)
+		}
+
+		form = append(form, fmt.Sprintf(`    <div class="mb-3">
+        <label for="%s" class="form-label">%s</label>
+        %s
+        {{if isset(errors["%s"])}}
+        <div class="text-danger">{{errors["%s"]}}</div>
+        {{end}}
+    </div>`, f.Column, label, input, f.Column, f.Column))
+	}
+
+	return strings.Join(head, "\n"), strings.Join(row, "\n"), strings.Join(detail, "\n"), strings.Join(form, "\n\n")
+}
+
+// resourceRoutes returns the routes snippet for the generated handlers
+func resourceRoutes(replacer *strings.Replacer, api bool) string {
+	routes := `	a.App.Routes.Get("/$TABLENAME$", a.Handlers.$PLURALNAME$Index)
+	a.App.Routes.Get("/$TABLENAME$/new", a.Handlers.$PLURALNAME$New)
+	a.App.Routes.Post("/$TABLENAME$", a.Handlers.$PLURALNAME$Create)
+	a.App.Routes.Get("/$TABLENAME$/{id}", a.Handlers.$PLURALNAME$Show)
+	a.App.Routes.Get("/$TABLENAME$/{id}/edit", a.Handlers.$PLURALNAME$Edit)
+	a.App.Routes.Post("/$TABLENAME$/{id}", a.Handlers.$PLURALNAME$Update)
+	a.App.Routes.Post("/$TABLENAME$/{id}/delete", a.Handlers.$PLURALNAME$Delete)`
+
+	if api {
+		routes = `	a.App.Routes.Get("/api/$TABLENAME$", a.Handlers.$PLURALNAME$Index)
+	a.App.Routes.Post("/api/$TABLENAME$", a.Handlers.$PLURALNAME$Create)
+	a.App.Routes.Get("/api/$TABLENAME$/{id}", a.Handlers.$PLURALNAME$Show)
+	a.App.Routes.Put("/api/$TABLENAME$/{id}", a.Handlers.$PLURALNAME$Update)
+	a.App.Routes.Delete("/api/$TABLENAME$/{id}", a.Handlers.$PLURALNAME$Delete)`
+	}
+
+	return replacer.Replace(routes)
+}
+
+// resourceArgs returns every argument following make resource <name>
+func resourceArgs() []string {
+	if len(os.Args) > 4 {
+		return os.Args[4:]
+	}
+	return nil
+}
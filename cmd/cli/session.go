@@ -6,27 +6,43 @@ import (
 )
 
 func doSessionTable() error {
-	dbType := skd.DB.DataType
+	dbType := sessionDBType()
 
-	if dbType == "mariadb" {
-		dbType = "mysql"
+	fileName := fmt.Sprintf("%d_create_sessions_table", time.Now().UnixMicro())
+
+	upFile := skd.RootPath + "/migrations/" + fileName + "." + dbType + ".up.sql"
+	downFile := skd.RootPath + "/migrations/" + fileName + "." + dbType + ".down.sql"
+
+	err := copyFilefromTemplate("templates/migrations/"+dbType+"_session.sql", upFile)
+	if err != nil {
+		exitGracefully(err)
 	}
 
-	if dbType == "postgresql" {
-		dbType = "postgres"
+	err = copyDataToFile([]byte("drop table sessions"), downFile)
+	if err != nil {
+		exitGracefully(err)
 	}
 
-	fileName := fmt.Sprintf("%d_create_sessions_table", time.Now().UnixMicro())
+	return doSessionIndexTable()
+}
+
+// doSessionIndexTable creates the sessions_users table, which indexes the sessions of
+// every user. Applications whose sessions table was created before the index existed
+// run it on its own, with make session-index.
+func doSessionIndexTable() error {
+	dbType := sessionDBType()
+
+	fileName := fmt.Sprintf("%d_create_sessions_users_table", time.Now().UnixMicro())
 
 	upFile := skd.RootPath + "/migrations/" + fileName + "." + dbType + ".up.sql"
 	downFile := skd.RootPath + "/migrations/" + fileName + "." + dbType + ".down.sql"
 
-	err := copyFilefromTemplate("templates/migrations/"+dbType+"_session.sql", upFile)
+	err := copyFilefromTemplate("templates/migrations/"+dbType+"_sessions_users.sql", upFile)
 	if err != nil {
 		exitGracefully(err)
 	}
 
-	err = copyDataToFile([]byte("drop table sessions"), downFile)
+	err = copyDataToFile([]byte("drop table sessions_users"), downFile)
 	if err != nil {
 		exitGracefully(err)
 	}
@@ -38,3 +54,18 @@ func doSessionTable() error {
 
 	return nil
 }
+
+// sessionDBType returns the name of the migration templates for the database of the application
+func sessionDBType() string {
+	dbType := skd.DB.DataType
+
+	if dbType == "mariadb" {
+		dbType = "mysql"
+	}
+
+	if dbType == "postgresql" {
+		dbType = "postgres"
+	}
+
+	return dbType
+}
@@ -0,0 +1,14 @@
+CREATE TABLE outbox (
+	id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	dedup_key VARCHAR(255) NULL,
+	payload BLOB NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	last_error TEXT NULL,
+	available_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+	created_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+	delivered_at TIMESTAMP(6) NULL,
+	UNIQUE KEY outbox_dedup_key_unique (dedup_key)
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (delivered_at, available_at);
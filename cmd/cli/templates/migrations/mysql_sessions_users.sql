@@ -0,0 +1,7 @@
+CREATE TABLE sessions_users (
+	token CHAR(43) PRIMARY KEY,
+	user_id INT NOT NULL,
+	expiry TIMESTAMP(6) NOT NULL
+);
+
+CREATE INDEX sessions_users_user_id_idx ON sessions_users (user_id);
@@ -0,0 +1,7 @@
+CREATE TABLE sessions_users (
+	token TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	expiry TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_users_user_id_idx ON sessions_users (user_id);
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/fatih/color"
+	"github.com/petrostrak/sokudo/mailer"
+	"github.com/petrostrak/sokudo/render"
+)
+
+func doViews(arg2, arg3 string) (string, error) {
+	switch arg2 {
+	case "check":
+		return checkViews(arg3)
+	default:
+		return "", errors.New("views requires a subcommand: (check)")
+	}
+}
+
+// checkViews checks the templates in views and mail. The functions an application adds
+// to its templates are only known when it runs, so their names are given in funcs,
+// separated by commas.
+func checkViews(funcs string) (string, error) {
+	views := jet.NewSet(
+		jet.NewOSFileSystemLoader(skd.RootPath+"/views"),
+		jet.InDevelopmentMode(),
+	)
+
+	r := &render.Render{
+		RootPath: skd.RootPath,
+		JetViews: views,
+	}
+	r.AddDefaultFuncs()
+	for _, name := range strings.Split(funcs, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			r.AddFunc(name, func(...interface{}) string { return "" })
+		}
+	}
+
+	var problems []render.Problem
+	for _, p := range r.Check() {
+		p.File = "views/" + p.File
+		problems = append(problems, p)
+	}
+
+	mailFiles, err := filepath.Glob(skd.RootPath + "/mail/*.tmpl")
+	if err != nil {
+		return "", err
+	}
+
+	m := &mailer.Mail{}
+	for _, p := range render.CheckGoTemplates(skd.RootPath+"/mail", mailFiles, nil, m.FuncMap("")) {
+		p.File = "mail/" + p.File
+		problems = append(problems, p)
+	}
+
+	if len(problems) > 0 {
+		for _, p := range problems {
+			color.Red("%s", p)
+		}
+		return "", fmt.Errorf("found %d problems in templates", len(problems))
+	}
+
+	return "Templates are fine", nil
+}
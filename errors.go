@@ -0,0 +1,339 @@
+package sokudo
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/petrostrak/sokudo/render"
+)
+
+// QueryError describes a failed database query. Wrap errors from the database in it, for
+// example
+//
+//	return &sokudo.QueryError{Query: query, Args: args, Err: err}
+//
+// so that the debug error page shows the query that failed.
+type QueryError struct {
+	Query string
+	Args  []interface{}
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// stackError records where an error was reported, or where a panic happened
+type stackError struct {
+	err   error
+	stack []byte
+}
+
+func (e *stackError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stackError) Unwrap() error {
+	return e.err
+}
+
+// ServerError logs err, and sends a 500 Internal Server Error response, which shows err in
+// debug mode
+func (s *Sokudo) ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	if s.ErrorLog != nil {
+		_ = s.ErrorLog.Output(2, err.Error())
+	}
+	s.ErrorPage(w, r, http.StatusInternalServerError, &stackError{err: err, stack: debug.Stack()})
+}
+
+// ErrorPage sends an error response with status. API requests, for urls under /api/ or
+// from clients that prefer json, get a json body. Otherwise the view errors/<status>, such
+// as views/errors/404.jet or views/errors/404.page.tmpl, is rendered when there is one,
+// with the variables status and message, or .Data.status and .Data.message in Go
+// templates, and plain text is sent when there is not.
+//
+// In debug mode, server errors get a page with the details of err and the request.
+func (s *Sokudo) ErrorPage(w http.ResponseWriter, r *http.Request, status int, err error) {
+	message := http.StatusText(status)
+
+	if isAPIRequest(r) {
+		payload := map[string]interface{}{
+			"error":   true,
+			"status":  status,
+			"message": message,
+		}
+		if s.Debug && err != nil {
+			payload["detail"] = err.Error()
+		}
+
+		_ = s.WriteJSON(w, status, payload)
+		return
+	}
+
+	if s.Debug && err != nil && status >= http.StatusInternalServerError {
+		s.debugErrorPage(w, r, status, err)
+		return
+	}
+
+	if s.Render != nil {
+		view := fmt.Sprintf("errors/%d", status)
+		if s.errorViewExists(view) {
+			td := &render.TemplateData{Data: map[string]interface{}{"status": status, "message": message}}
+			vars := make(jet.VarMap)
+			vars.Set("status", status)
+			vars.Set("message", message)
+
+			buf := &bufferedResponse{header: w.Header()}
+			renderErr := s.Render.Page(buf, r, view, vars, td)
+			if renderErr == nil {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(status)
+				_, _ = w.Write(buf.body.Bytes())
+				return
+			}
+
+			if s.ErrorLog != nil {
+				s.ErrorLog.Println("rendering error page:", renderErr)
+			}
+		}
+	}
+
+	http.Error(w, message, status)
+}
+
+// errorViewExists reports whether the view for an error page exists for the configured
+// renderer
+func (s *Sokudo) errorViewExists(view string) bool {
+	ext := ".jet"
+	if strings.ToLower(s.Render.Renderer) == "go" {
+		ext = ".page.tmpl"
+	}
+
+	_, err := os.Stat(fmt.Sprintf("%s/views/%s%s", s.RootPath, view, ext))
+	return err == nil
+}
+
+// isAPIRequest reports whether r is for an api url, or from a client that prefers json
+// to html
+func isAPIRequest(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+
+	return acceptQuality(accept, "application/json") > acceptQuality(accept, "text/html")
+}
+
+// RecoverPanic recovers from panics in handlers, logs them with their stack trace, and
+// sends a 500 Internal Server Error response
+func (s *Sokudo) RecoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+
+			// the server aborts the response quietly for this one
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			stack := debug.Stack()
+			err, ok := rvr.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rvr)
+			}
+			err = fmt.Errorf("panic: %w", err)
+
+			if s.ErrorLog != nil {
+				s.ErrorLog.Printf("%v\n%s", err, stack)
+			}
+
+			s.ErrorPage(w, r, http.StatusInternalServerError, &stackError{err: err, stack: stack})
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// debugErrorPage sends a page with the details of err and r, for developers
+func (s *Sokudo) debugErrorPage(w http.ResponseWriter, r *http.Request, status int, err error) {
+	data := debugPageData{
+		Status:    status,
+		Message:   http.StatusText(status),
+		Error:     err.Error(),
+		Method:    r.Method,
+		URL:       redactedURL(r),
+		Proto:     r.Proto,
+		Remote:    r.RemoteAddr,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+
+	var se *stackError
+	if errors.As(err, &se) {
+		data.Stack = string(se.stack)
+	}
+
+	var te *render.TemplateError
+	if errors.As(err, &te) {
+		data.Template = te
+		data.Source = te.Source(s.RootPath, 5)
+	}
+
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		data.Query = qe
+	}
+
+	for name, values := range r.Header {
+		value := strings.Join(values, ", ")
+		switch name {
+		case "Authorization", "Cookie", "Proxy-Authorization":
+			value = "[hidden]"
+		}
+		data.Headers = append(data.Headers, debugPair{name, value})
+	}
+	sort.Slice(data.Headers, func(i, j int) bool { return data.Headers[i].Name < data.Headers[j].Name })
+
+	if r.Form != nil {
+		for name, values := range r.Form {
+			data.Form = append(data.Form, debugPair{name, redactedValue(name, strings.Join(values, ", "))})
+		}
+		sort.Slice(data.Form, func(i, j int) bool { return data.Form[i].Name < data.Form[j].Name })
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := debugPage.Execute(w, data); err != nil && s.ErrorLog != nil {
+		s.ErrorLog.Println("rendering debug error page:", err)
+	}
+}
+
+// redactedURL returns the url of r, with the values of secret query parameters hidden
+func redactedURL(r *http.Request) string {
+	u := *r.URL
+	query := u.Query()
+	for name, values := range query {
+		for i := range values {
+			values[i] = redactedValue(name, values[i])
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// redactedValue hides value if the form field or query parameter name holds a secret
+func redactedValue(name, value string) string {
+	lower := strings.ToLower(name)
+	if strings.Contains(lower, "password") || strings.Contains(lower, "token") || strings.Contains(lower, "secret") {
+		return "[hidden]"
+	}
+
+	return value
+}
+
+type debugPair struct {
+	Name  string
+	Value string
+}
+
+type debugPageData struct {
+	Status    int
+	Message   string
+	Error     string
+	Stack     string
+	Template  *render.TemplateError
+	Source    []render.SourceLine
+	Query     *QueryError
+	Method    string
+	URL       string
+	Proto     string
+	Remote    string
+	RequestID string
+	Headers   []debugPair
+	Form      []debugPair
+}
+
+var debugPage = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.Message}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 0; color: #222; }
+header { background: #b3261e; color: #fff; padding: 1.5rem 2rem; }
+header h1 { margin: 0 0 .5rem; font-size: 1.25rem; }
+header p { margin: 0; font-family: monospace; font-size: 1.1rem; white-space: pre-wrap; }
+section { padding: 1rem 2rem; border-bottom: 1px solid #ddd; }
+h2 { font-size: 1rem; text-transform: uppercase; color: #666; }
+pre { background: #f6f6f6; padding: 1rem; overflow-x: auto; font-size: .85rem; }
+table { border-collapse: collapse; font-size: .9rem; }
+td { padding: .25rem 1rem .25rem 0; vertical-align: top; font-family: monospace; }
+.current { background: #fde2e1; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Status}} {{.Message}}</h1>
+<p>{{.Error}}</p>
+</header>
+{{with .Template}}
+<section>
+<h2>Template</h2>
+<p>views/{{.File}}{{if .Line}}, line {{.Line}}{{end}}{{if ne .File .View}} (rendering {{.View}}){{end}}</p>
+{{with $.Source}}<pre>{{range .}}<span{{if .Current}} class="current"{{end}}>{{printf "%4d" .Number}}  {{.Text}}</span>
+{{end}}</pre>{{end}}
+</section>
+{{end}}
+{{with .Query}}
+<section>
+<h2>Query</h2>
+<pre>{{.Query}}</pre>
+{{with .Args}}<table>{{range $i, $arg := .}}<tr><td>{{inc $i}}</td><td>{{printf "%#v" $arg}}</td></tr>{{end}}</table>{{end}}
+</section>
+{{end}}
+{{with .Stack}}
+<section>
+<h2>Stack trace</h2>
+<pre>{{.}}</pre>
+</section>
+{{end}}
+<section>
+<h2>Request</h2>
+<table>
+<tr><td>Method</td><td>{{.Method}}</td></tr>
+<tr><td>URL</td><td>{{.URL}}</td></tr>
+<tr><td>Protocol</td><td>{{.Proto}}</td></tr>
+<tr><td>Remote address</td><td>{{.Remote}}</td></tr>
+{{with .RequestID}}<tr><td>Request ID</td><td>{{.}}</td></tr>{{end}}
+</table>
+<h2>Headers</h2>
+<table>{{range .Headers}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+{{with .Form}}
+<h2>Form</h2>
+<table>{{range .}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+{{end}}
+</section>
+</body>
+</html>
+`))
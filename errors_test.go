@@ -0,0 +1,117 @@
+package sokudo
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/petrostrak/sokudo/render"
+)
+
+func TestSokudo_ErrorPage(t *testing.T) {
+	s := &Sokudo{
+		RootPath: "./testdata",
+		Render:   &render.Render{Renderer: "go", RootPath: "./testdata"},
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"view", "/missing", "text/html", http.StatusNotFound, "text/html", "<h1>404 Not Found</h1>"},
+		{"no view", "/private", "text/html", http.StatusForbidden, "text/plain", "Forbidden"},
+		{"api url", "/api/missing", "", http.StatusNotFound, "application/json", `"message": "Not Found"`},
+		{"json client", "/missing", "application/json", http.StatusNotFound, "application/json", `"status": 404`},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.url, nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+
+		s.ErrorPage(w, r, test.status, nil)
+
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, w.Code)
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), test.contentType) {
+			t.Errorf("%s: wrong Content-Type %q", test.name, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s: expected %q in %q", test.name, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestSokudo_RecoverPanic(t *testing.T) {
+	s := &Sokudo{Debug: true}
+	handler := s.RecoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	}))
+
+	r := httptest.NewRequest("GET", "/?password=secret", nil)
+	r.Header.Set("Cookie", "session=abc")
+	_ = r.ParseForm()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	body := w.Body.String()
+	if w.Code != http.StatusInternalServerError {
+		t.Error("wrong status:", w.Code)
+	}
+	for _, expected := range []string{"panic: something broke", "Stack trace", "TestSokudo_RecoverPanic"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("debug page has no %q", expected)
+		}
+	}
+	if strings.Contains(body, "secret") || strings.Contains(body, "session=abc") {
+		t.Error("debug page shows secrets")
+	}
+
+	// without debug mode, nothing about the panic is shown
+	s.Debug = false
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "something broke") {
+		t.Error("panic shown outside debug mode:", w.Body.String())
+	}
+}
+
+func TestSokudo_ServerErrorDebug(t *testing.T) {
+	s := &Sokudo{
+		Debug:    true,
+		RootPath: "./testdata",
+		Render:   &render.Render{Renderer: "go", RootPath: "./testdata"},
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	td := &render.TemplateData{Data: map[string]interface{}{"items": []string{"one"}}}
+	err := s.Render.Page(httptest.NewRecorder(), r, "broken", nil, td)
+
+	var te *render.TemplateError
+	if !errors.As(err, &te) {
+		t.Fatal("expected a template error, got", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServerError(w, r, err)
+
+	body := w.Body.String()
+	for _, expected := range []string{"views/broken.page.tmpl, line 2", `class="current">   2    &lt;li&gt;{{index .Data.items 5}}&lt;/li&gt;`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("debug page has no %q", expected)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.ServerError(w, r, &QueryError{Query: "select * from users where id = $1", Args: []interface{}{7}, Err: errors.New("no such table")})
+	if !strings.Contains(w.Body.String(), "select * from users where id = $1") {
+		t.Error("debug page has no query")
+	}
+}
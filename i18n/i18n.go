@@ -0,0 +1,175 @@
+// Package i18n translates the messages of an application, using catalogs loaded from
+// JSON, TOML or gettext PO files, and detects the locale of each request.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Message is a translated message, by plural category: zero, one, two, few, many or
+// other. Messages without plural forms only have other.
+type Message map[string]string
+
+// Bundle holds the catalogs of every locale
+type Bundle struct {
+	// DefaultLocale is used when a message is missing from the catalog of a locale
+	DefaultLocale string
+
+	mu       sync.RWMutex
+	catalogs map[string]map[string]Message
+}
+
+// New returns an empty bundle, which falls back to defaultLocale
+func New(defaultLocale string) *Bundle {
+	return &Bundle{
+		DefaultLocale: normalize(defaultLocale),
+		catalogs:      make(map[string]map[string]Message),
+	}
+}
+
+// Add adds messages to the catalog of locale, replacing any messages with the same keys
+func (b *Bundle) Add(locale string, messages map[string]Message) {
+	locale = normalize(locale)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	catalog, ok := b.catalogs[locale]
+	if !ok {
+		catalog = make(map[string]Message)
+		b.catalogs[locale] = catalog
+	}
+
+	for key, message := range messages {
+		catalog[key] = message
+	}
+}
+
+// Locales returns the locales that have catalogs, sorted
+func (b *Bundle) Locales() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var locales []string
+	for locale := range b.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+// Supported returns the locale with a catalog that best matches locale: the locale
+// itself, or its language, such as el for el-GR, or an empty string if there is none
+func (b *Bundle) Supported(locale string) string {
+	locale = normalize(locale)
+	if locale == "" {
+		return ""
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, ok := b.catalogs[locale]; ok {
+		return locale
+	}
+
+	if _, ok := b.catalogs[language(locale)]; ok {
+		return language(locale)
+	}
+
+	return ""
+}
+
+// T returns the translation of key in locale, formatted with args as by fmt.Sprintf. If
+// neither locale, its language nor the default locale has the message, key is returned.
+func (b *Bundle) T(locale, key string, args ...interface{}) string {
+	message, _, _ := b.lookup(locale, key)
+
+	text, ok := message["other"]
+	if !ok {
+		return key
+	}
+
+	return format(text, args)
+}
+
+// N returns the translation of key in locale, in the plural form for count, formatted
+// with count followed by args as by fmt.Sprintf. A zero form, if the message has one, is
+// used for a count of 0 in every language.
+func (b *Bundle) N(locale, key string, count int, args ...interface{}) string {
+	message, found, ok := b.lookup(locale, key)
+	if !ok {
+		return key
+	}
+
+	category := PluralCategory(found, count)
+	if count == 0 {
+		if _, ok := message["zero"]; ok {
+			category = "zero"
+		}
+	}
+
+	text, ok := message[category]
+	if !ok {
+		text, ok = message["other"]
+		if !ok {
+			return key
+		}
+	}
+
+	return format(text, append([]interface{}{count}, args...))
+}
+
+// lookup finds key in the catalog of locale, its language, or the default locale, and
+// returns the locale it was found in
+func (b *Bundle) lookup(locale, key string) (Message, string, bool) {
+	locale = normalize(locale)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, candidate := range []string{locale, language(locale), b.DefaultLocale} {
+		if candidate == "" {
+			continue
+		}
+
+		if message, ok := b.catalogs[candidate][key]; ok {
+			return message, candidate, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// format formats text with args, unless text has no verbs to format them with
+func format(text string, args []interface{}) string {
+	if len(args) == 0 || !strings.Contains(text, "%") {
+		return text
+	}
+
+	return fmt.Sprintf(text, args...)
+}
+
+// normalize returns locale in the form en or en-US
+func normalize(locale string) string {
+	locale = strings.TrimSpace(strings.ReplaceAll(locale, "_", "-"))
+	if locale == "" {
+		return ""
+	}
+
+	parts := strings.SplitN(locale, "-", 2)
+	if len(parts) == 1 {
+		return strings.ToLower(parts[0])
+	}
+
+	return strings.ToLower(parts[0]) + "-" + strings.ToUpper(parts[1])
+}
+
+// language returns the language of locale, such as en for en-US
+func language(locale string) string {
+	return strings.SplitN(locale, "-", 2)[0]
+}
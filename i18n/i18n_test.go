@@ -0,0 +1,103 @@
+package i18n
+
+import "testing"
+
+func testBundle(t *testing.T) *Bundle {
+	b := New("en")
+	if err := b.LoadDir("./testdata"); err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestBundle_T(t *testing.T) {
+	b := testBundle(t)
+
+	var tests = []struct {
+		locale   string
+		key      string
+		args     []interface{}
+		expected string
+	}{
+		{"en", "users.title", nil, "Users"},
+		{"el", "users.title", nil, "Χρήστες"},
+		{"el-GR", "greeting", []interface{}{"Petros"}, "Γεια σου, Petros"},
+		{"ru", "greeting", []interface{}{"Petros"}, "Hello, Petros"},
+		{"de", "users.title", nil, "Users"},
+		{"el", "missing.key", nil, "missing.key"},
+	}
+
+	for _, e := range tests {
+		if got := b.T(e.locale, e.key, e.args...); got != e.expected {
+			t.Errorf("%s %s: expected %q, got %q", e.locale, e.key, e.expected, got)
+		}
+	}
+}
+
+func TestBundle_N(t *testing.T) {
+	b := testBundle(t)
+
+	var tests = []struct {
+		locale   string
+		count    int
+		expected string
+	}{
+		{"en", 0, "No users"},
+		{"en", 1, "1 user"},
+		{"en", 5, "5 users"},
+		{"el", 0, "0 χρήστες"},
+		{"el", 1, "1 χρήστης"},
+		{"ru", 1, "1 пользователь"},
+		{"ru", 3, "3 пользователя"},
+		{"ru", 11, "11 пользователей"},
+		{"ru", 21, "21 пользователь"},
+	}
+
+	for _, e := range tests {
+		if got := b.N(e.locale, "users.count", e.count); got != e.expected {
+			t.Errorf("%s %d: expected %q, got %q", e.locale, e.count, e.expected, got)
+		}
+	}
+}
+
+func TestBundle_Supported(t *testing.T) {
+	b := testBundle(t)
+
+	var tests = map[string]string{
+		"el":    "el",
+		"el-GR": "el",
+		"en_us": "en",
+		"de":    "",
+		"":      "",
+	}
+
+	for locale, expected := range tests {
+		if got := b.Supported(locale); got != expected {
+			t.Errorf("%q: expected %q, got %q", locale, expected, got)
+		}
+	}
+}
+
+func TestPluralCategory(t *testing.T) {
+	var tests = []struct {
+		locale   string
+		n        int
+		expected string
+	}{
+		{"en", 1, "one"},
+		{"en", 0, "other"},
+		{"fr", 0, "one"},
+		{"ja", 1, "other"},
+		{"pl", 22, "few"},
+		{"pl", 25, "many"},
+		{"cs", 4, "few"},
+		{"cs", 5, "other"},
+	}
+
+	for _, e := range tests {
+		if got := PluralCategory(e.locale, e.n); got != e.expected {
+			t.Errorf("%s %d: expected %s, got %s", e.locale, e.n, e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package i18n
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// pluralKeys are the keys which make an object in a JSON or TOML catalog a plural message
+var pluralKeys = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+// LoadDir adds the catalogs in dir to the bundle. Each file holds the messages of the
+// locale it is named after, such as el.json, en-US.toml or fr.po.
+func (b *Bundle) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		ext := filepath.Ext(entry.Name())
+		switch ext {
+		case ".json", ".toml", ".po":
+		default:
+			continue
+		}
+
+		err := b.LoadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadFile adds the catalog in path to the bundle, for the locale the file is named after.
+//
+// JSON and TOML catalogs hold messages by key, and may nest them, in which case their keys
+// are joined with dots. An object whose keys are all plural categories is a message with
+// plural forms:
+//
+//	{"users": {"count": {"one": "%d user", "other": "%d users"}}}
+//
+// PO catalogs use msgid as the key, and msgid_plural with indexed msgstr for plural forms.
+func (b *Bundle) LoadFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(path)
+	locale := strings.TrimSuffix(filepath.Base(path), ext)
+
+	var messages map[string]Message
+	switch ext {
+	case ".json":
+		var tree map[string]interface{}
+		err = json.Unmarshal(contents, &tree)
+		if err == nil {
+			messages, err = flatten(tree)
+		}
+	case ".toml":
+		var tree map[string]interface{}
+		err = toml.Unmarshal(contents, &tree)
+		if err == nil {
+			messages, err = flatten(tree)
+		}
+	case ".po":
+		messages, err = parsePO(contents, PluralCategories(locale))
+	default:
+		return fmt.Errorf("unsupported catalog format %s", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	b.Add(locale, messages)
+
+	return nil
+}
+
+// flatten turns a tree of messages into messages keyed by their dotted paths
+func flatten(tree map[string]interface{}) (map[string]Message, error) {
+	messages := make(map[string]Message)
+	err := flattenInto(messages, "", tree)
+	return messages, err
+}
+
+func flattenInto(messages map[string]Message, prefix string, tree map[string]interface{}) error {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case string:
+			messages[key] = Message{"other": v}
+		case map[string]interface{}:
+			if isPlural(v) {
+				message := make(Message)
+				for category, text := range v {
+					s, ok := text.(string)
+					if !ok {
+						return fmt.Errorf("plural form %s of %s is not a string", category, key)
+					}
+					message[category] = s
+				}
+				messages[key] = message
+				continue
+			}
+
+			err := flattenInto(messages, key, v)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %s is not a string", key)
+		}
+	}
+
+	return nil
+}
+
+func isPlural(tree map[string]interface{}) bool {
+	if len(tree) == 0 {
+		return false
+	}
+
+	for key := range tree {
+		if !pluralKeys[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parsePO reads the messages of a gettext PO file. The msgstr[n] of a plural message is
+// given the nth of categories.
+func parsePO(contents []byte, categories []string) (map[string]Message, error) {
+	messages := make(map[string]Message)
+
+	var (
+		msgid    string
+		plural   bool
+		forms    map[int]string
+		field    string
+		index    int
+		inEntry  bool
+		lineNo   int
+		scanner  = bufio.NewScanner(bytes.NewReader(contents))
+		setField = func(value string) {
+			switch field {
+			case "msgid":
+				msgid += value
+			case "msgstr":
+				forms[index] += value
+			}
+		}
+	)
+
+	flush := func() {
+		if inEntry && msgid != "" {
+			message := make(Message)
+			if plural {
+				for i, text := range forms {
+					if text != "" && i < len(categories) {
+						message[categories[i]] = text
+					}
+				}
+			} else if forms[0] != "" {
+				message["other"] = forms[0]
+			}
+
+			if len(message) > 0 {
+				messages[msgid] = message
+			}
+		}
+
+		msgid, plural, forms, field, index, inEntry = "", false, make(map[int]string), "", 0, false
+	}
+	flush()
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "msgid_plural "):
+			plural, field = true, ""
+		case strings.HasPrefix(line, "msgid "):
+			flush()
+			inEntry, field = true, "msgid"
+			value, err := strconv.Unquote(strings.TrimPrefix(line, "msgid "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			setField(value)
+		case strings.HasPrefix(line, "msgstr["):
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: malformed msgstr", lineNo)
+			}
+			i, err := strconv.Atoi(line[len("msgstr["):end])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			value, err := strconv.Unquote(strings.TrimSpace(line[end+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			field, index = "msgstr", i
+			setField(value)
+		case strings.HasPrefix(line, "msgstr "):
+			value, err := strconv.Unquote(strings.TrimPrefix(line, "msgstr "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			field, index = "msgstr", 0
+			setField(value)
+		case strings.HasPrefix(line, `"`):
+			// a continuation of the previous string
+			value, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			setField(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return messages, nil
+}
@@ -0,0 +1,131 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type contextKey struct{}
+
+// LocaleKey is the name of the cookie, and the session key, which hold a locale chosen by
+// the user
+const LocaleKey = "lang"
+
+// WithLocale returns a copy of ctx which carries locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// Locale returns the locale ctx carries, or an empty string if it carries none
+func Locale(ctx context.Context) string {
+	locale, _ := ctx.Value(contextKey{}).(string)
+	return locale
+}
+
+// Detector detects the locale of each request, from the first of these that names a
+// locale with a catalog in Bundle:
+//
+//  1. a prefix of the url path, such as /el/users, which is stripped from r.URL.Path
+//  2. the lang key of the session, if Session is set
+//  3. the lang cookie
+//  4. the Accept-Language header
+//
+// and otherwise uses the default locale of Bundle.
+type Detector struct {
+	Bundle *Bundle
+	// URLPrefix enables detection from a prefix of the url path
+	URLPrefix bool
+	// Session returns the locale stored in the session of the request, if any
+	Session func(r *http.Request) string
+}
+
+// Middleware stores the locale of each request in its context, where Locale finds it, and
+// sets the Content-Language header of the response
+func (d *Detector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := d.detect(r)
+
+		w.Header().Set("Content-Language", locale)
+		next.ServeHTTP(w, r.WithContext(WithLocale(r.Context(), locale)))
+	})
+}
+
+func (d *Detector) detect(r *http.Request) string {
+	if d.URLPrefix {
+		segments := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		// only a locale with a catalog of its own, so that /el-foo is not taken for el
+		if locale := d.Bundle.Supported(segments[0]); locale != "" && locale == normalize(segments[0]) {
+			r.URL.Path = "/"
+			if len(segments) == 2 {
+				r.URL.Path += segments[1]
+			}
+			r.URL.RawPath = ""
+			return locale
+		}
+	}
+
+	if d.Session != nil {
+		if locale := d.Bundle.Supported(d.Session(r)); locale != "" {
+			return locale
+		}
+	}
+
+	if cookie, err := r.Cookie(LocaleKey); err == nil {
+		if locale := d.Bundle.Supported(cookie.Value); locale != "" {
+			return locale
+		}
+	}
+
+	for _, accepted := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if locale := d.Bundle.Supported(accepted); locale != "" {
+			return locale
+		}
+	}
+
+	return d.Bundle.DefaultLocale
+}
+
+// parseAcceptLanguage returns the languages in an Accept-Language header, most preferred
+// first
+func parseAcceptLanguage(header string) []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			languages = append(languages, language{tag, q})
+		}
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+
+	return tags
+}
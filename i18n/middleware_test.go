@@ -0,0 +1,65 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetector_Middleware(t *testing.T) {
+	b := testBundle(t)
+
+	var tests = []struct {
+		name     string
+		path     string
+		session  string
+		cookie   string
+		accept   string
+		locale   string
+		wantPath string
+	}{
+		{"default", "/users", "", "", "", "en", "/users"},
+		{"url prefix", "/el/users", "ru", "ru", "ru", "el", "/users"},
+		{"url prefix only", "/el", "", "", "", "el", "/"},
+		{"not a prefix", "/el-foo/users", "", "", "", "en", "/el-foo/users"},
+		{"session", "/users", "ru", "el", "el", "ru", "/users"},
+		{"cookie", "/users", "", "el", "ru", "el", "/users"},
+		{"accept language", "/users", "", "", "de-DE,ru;q=0.8,el;q=0.9", "el", "/users"},
+		{"unsupported", "/users", "de", "de", "de", "en", "/users"},
+	}
+
+	for _, e := range tests {
+		detector := Detector{
+			Bundle:    b,
+			URLPrefix: true,
+			Session: func(r *http.Request) string {
+				return e.session
+			},
+		}
+
+		var locale, path string
+		handler := detector.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale, path = Locale(r.Context()), r.URL.Path
+		}))
+
+		r := httptest.NewRequest("GET", e.path, nil)
+		if e.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: LocaleKey, Value: e.cookie})
+		}
+		if e.accept != "" {
+			r.Header.Set("Accept-Language", e.accept)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if locale != e.locale {
+			t.Errorf("%s: expected locale %s, got %s", e.name, e.locale, locale)
+		}
+		if path != e.wantPath {
+			t.Errorf("%s: expected path %s, got %s", e.name, e.wantPath, path)
+		}
+		if w.Header().Get("Content-Language") != e.locale {
+			t.Errorf("%s: wrong Content-Language %s", e.name, w.Header().Get("Content-Language"))
+		}
+	}
+}
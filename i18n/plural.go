@@ -0,0 +1,75 @@
+package i18n
+
+// pluralRules lists, for languages whose plural forms differ from English, the plural
+// categories they use in the order of gettext's msgstr indexes
+var pluralRules = map[string][]string{
+	// no plural forms
+	"ja": {"other"}, "zh": {"other"}, "ko": {"other"}, "th": {"other"}, "vi": {"other"},
+	"id": {"other"}, "ms": {"other"},
+	// one for 0 and 1
+	"fr": {"one", "other"}, "pt": {"one", "other"},
+	// one, few and many, by the last digits
+	"ru": {"one", "few", "many"}, "uk": {"one", "few", "many"}, "be": {"one", "few", "many"},
+	"sr": {"one", "few", "many"}, "hr": {"one", "few", "many"}, "bs": {"one", "few", "many"},
+	"pl": {"one", "few", "many"},
+	// one, few (2 to 4) and other
+	"cs": {"one", "few", "other"}, "sk": {"one", "few", "other"},
+}
+
+// PluralCategories returns the plural categories locale uses, in the order of gettext's
+// msgstr indexes
+func PluralCategories(locale string) []string {
+	if categories, ok := pluralRules[language(normalize(locale))]; ok {
+		return categories
+	}
+
+	return []string{"one", "other"}
+}
+
+// PluralCategory returns the plural category of n in locale. Languages without rules of
+// their own follow English: one for 1, and other for everything else.
+func PluralCategory(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch language(normalize(locale)) {
+	case "ja", "zh", "ko", "th", "vi", "id", "ms":
+		return "other"
+	case "fr", "pt":
+		if n <= 1 {
+			return "one"
+		}
+	case "ru", "uk", "be", "sr", "hr", "bs":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "pl":
+		switch {
+		case n == 1:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "cs", "sk":
+		switch {
+		case n == 1:
+			return "one"
+		case n >= 2 && n <= 4:
+			return "few"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+
+	return "other"
+}
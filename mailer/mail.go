@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	apimail "github.com/ainsleyclark/go-mail"
+	"github.com/petrostrak/sokudo/i18n"
 	"github.com/vanng822/go-premailer/premailer"
 	mail "github.com/xhit/go-simple-mail/v2"
 )
@@ -29,6 +32,8 @@ type Mail struct {
 	API         string
 	APIKey      string
 	APIUrl      string
+	// I18n provides the t and tn functions to templates, and is optional
+	I18n *i18n.Bundle
 }
 
 // Message is the type for an email message
@@ -40,6 +45,9 @@ type Message struct {
 	Template    string
 	Attachments []string
 	Data        interface{}
+	// Locale picks a translated template, such as password-reset.el.html.tmpl, when
+	// there is one, and the language of the t and tn template functions
+	Locale string
 }
 
 // Result contains information regarding the status of the sent email message
@@ -229,9 +237,9 @@ func (m *Mail) getEncryption(e string) mail.Encryption {
 
 // buildHTMLMessage creates the html version of the message
 func (m *Mail) buildHTMLMessage(msg Message) (string, error) {
-	templateToRender := fmt.Sprintf("%s/%s.html.tmpl", m.Templates, msg.Template)
+	templateToRender := m.templateFile(msg, "html")
 
-	t, err := template.New("email-html").ParseFiles(templateToRender)
+	t, err := template.New("email-html").Funcs(m.FuncMap(msg.Locale)).ParseFiles(templateToRender)
 	if err != nil {
 		return "", err
 	}
@@ -252,9 +260,9 @@ func (m *Mail) buildHTMLMessage(msg Message) (string, error) {
 
 // buildPlainTextMessage creates the plaintext version of the message
 func (m *Mail) buildPlainTextMessage(msg Message) (string, error) {
-	templateToRender := fmt.Sprintf("%s/%s.plain.tmpl", m.Templates, msg.Template)
+	templateToRender := m.templateFile(msg, "plain")
 
-	t, err := template.New("email-html").ParseFiles(templateToRender)
+	t, err := template.New("email-html").Funcs(m.FuncMap(msg.Locale)).ParseFiles(templateToRender)
 	if err != nil {
 		return "", err
 	}
@@ -269,6 +277,49 @@ func (m *Mail) buildPlainTextMessage(msg Message) (string, error) {
 	return plainMessage, nil
 }
 
+// templateFile returns the template of msg in the given format, html or plain, preferring
+// one for the locale of msg, such as welcome.el-GR.html.tmpl or welcome.el.html.tmpl
+func (m *Mail) templateFile(msg Message, format string) string {
+	if msg.Locale != "" {
+		locale := strings.ReplaceAll(msg.Locale, "_", "-")
+		candidates := []string{locale}
+		if lang := strings.SplitN(locale, "-", 2)[0]; lang != locale {
+			candidates = append(candidates, lang)
+		}
+
+		for _, candidate := range candidates {
+			file := fmt.Sprintf("%s/%s.%s.%s.tmpl", m.Templates, msg.Template, candidate, format)
+			if _, err := os.Stat(file); err == nil {
+				return file
+			}
+		}
+	}
+
+	return fmt.Sprintf("%s/%s.%s.tmpl", m.Templates, msg.Template, format)
+}
+
+// FuncMap returns the functions mail templates have, translating to locale
+func (m *Mail) FuncMap(locale string) template.FuncMap {
+	if locale == "" && m.I18n != nil {
+		locale = m.I18n.DefaultLocale
+	}
+
+	return template.FuncMap{
+		"t": func(key string, args ...interface{}) string {
+			if m.I18n == nil {
+				return key
+			}
+			return m.I18n.T(locale, key, args...)
+		},
+		"tn": func(key string, count int, args ...interface{}) string {
+			if m.I18n == nil {
+				return key
+			}
+			return m.I18n.N(locale, key, count, args...)
+		},
+	}
+}
+
 // inlineCSS takes html input as a string, and inlines css where possible
 func (m *Mail) inlineCSS(s string) (string, error) {
 	options := premailer.Options{
@@ -7,11 +7,20 @@ import (
 	"strings"
 
 	"github.com/justinas/nosurf"
+	"github.com/petrostrak/sokudo/cache"
+	"github.com/petrostrak/sokudo/i18n"
+	"github.com/petrostrak/sokudo/session"
 )
 
 func (s *Sokudo) SessionLoad(next http.Handler) http.Handler {
 	s.InfoLog.Println("SessionLoad called")
-	return s.Session.LoadAndSave(next)
+	if s.sessionGuard != nil {
+		next = s.sessionGuard.Middleware(session.Track(s.Session, next))
+	} else {
+		next = session.Track(s.Session, next)
+	}
+
+	return session.LoadAndSave(s.Session, next)
 }
 
 func (s *Sokudo) NoSurf(next http.Handler) http.Handler {
@@ -31,6 +40,28 @@ func (s *Sokudo) NoSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
+// DetectLocale stores the locale of each request in its context, for the translation
+// functions of templates, validation messages and i18n.Locale. It passes requests straight
+// through when the application has no catalogs in its lang folder.
+func (s *Sokudo) DetectLocale(next http.Handler) http.Handler {
+	if s.I18n == nil {
+		return next
+	}
+
+	detector := i18n.Detector{
+		Bundle:    s.I18n,
+		URLPrefix: s.config.localeURLPrefix,
+		Session: func(r *http.Request) string {
+			if s.Session == nil {
+				return ""
+			}
+			return s.Session.GetString(r.Context(), i18n.LocaleKey)
+		},
+	}
+
+	return detector.Middleware(next)
+}
+
 func (s *Sokudo) CheckForMaintenanceMode(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if maintenanceMode {
@@ -46,3 +77,29 @@ func (s *Sokudo) CheckForMaintenanceMode(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// CacheResponse returns middleware which caches the responses of the routes it is used on
+// in the application cache for ttl seconds, for example
+//
+//	a.App.Routes.With(a.App.CacheResponse(300, cache.WithTags("products"))).Get("/products", a.Handlers.Products)
+//
+// Only use it for routes whose responses are the same for every user. Requests with a
+// session cookie are not cached, and pages rendered for the cache leave out the CSRF token
+// and flash messages, so forms which post to the application do not belong on cached
+// pages. If no cache is configured, requests are passed straight through.
+func (s *Sokudo) CacheResponse(ttl int, options ...cache.ResponseOption) func(http.Handler) http.Handler {
+	if s.Session != nil {
+		options = append([]cache.ResponseOption{cache.WithoutCookies(s.Session.Cookie.Name)}, options...)
+	}
+
+	return cache.NewResponseCache(s.Cache, ttl, options...).Middleware
+}
+
+// InvalidateResponses removes every cached response for a path starting with prefix
+func (s *Sokudo) InvalidateResponses(prefix string) error {
+	if s.Cache == nil {
+		return nil
+	}
+
+	return cache.InvalidateResponses(s.Cache, prefix)
+}
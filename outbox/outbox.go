@@ -0,0 +1,340 @@
+package outbox
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/petrostrak/sokudo/mailer"
+)
+
+const (
+	// TopicMail is the topic for messages delivered by the mailer
+	TopicMail = "mail"
+	// TopicWebhook is the topic for messages delivered as http requests
+	TopicWebhook = "webhook"
+)
+
+// Handler delivers a single message. Returning an error means the message
+// will be retried later, so handlers must be safe to call more than once for
+// the same message; DedupKey can be used to detect repeats.
+type Handler func(msg Message) error
+
+// Outbox stores messages in the database, in the same transaction as the
+// changes that caused them, and delivers them later. Delivery is at-least-once.
+type Outbox struct {
+	DB          *sql.DB
+	DataType    string
+	BatchSize   int
+	MaxAttempts int
+	// ClaimTimeout is how long a dispatcher has to deliver the messages it has claimed,
+	// after which they may be claimed again
+	ClaimTimeout time.Duration
+	ErrorLog     *log.Logger
+	handlers     map[string]Handler
+}
+
+// Message is the type for a message stored in the outbox
+type Message struct {
+	ID       int64
+	Topic    string
+	DedupKey string
+	Payload  []byte
+	Attempts int
+}
+
+// Webhook is the payload for messages with the webhook topic
+type Webhook struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// New returns an outbox for db, where dataType is one of postgres, postgresql,
+// mysql or mariadb
+func New(db *sql.DB, dataType string, errorLog *log.Logger) *Outbox {
+	return &Outbox{
+		DB:           db,
+		DataType:     dataType,
+		BatchSize:    50,
+		MaxAttempts:  10,
+		ClaimTimeout: 5 * time.Minute,
+		ErrorLog:     errorLog,
+		handlers:     make(map[string]Handler),
+	}
+}
+
+// Register sets the handler used to deliver messages for topic
+func (o *Outbox) Register(topic string, h Handler) {
+	if o.handlers == nil {
+		o.handlers = make(map[string]Handler)
+	}
+	o.handlers[topic] = h
+}
+
+// Enqueue adds a message to the outbox inside the caller's transaction, so it is only
+// stored if the transaction commits. payload is encoded as json. If dedupKey is not empty
+// and a message with the same key has already been enqueued, the message is ignored.
+func (o *Outbox) Enqueue(tx *sql.Tx, topic, dedupKey string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	key := sql.NullString{String: dedupKey, Valid: dedupKey != ""}
+
+	var query string
+	if o.isPostgres() {
+		query = `insert into outbox (topic, dedup_key, payload, available_at, created_at)
+			values (?, ?, ?, ?, ?) on conflict (dedup_key) do nothing`
+	} else {
+		query = `insert into outbox (topic, dedup_key, payload, available_at, created_at)
+			values (?, ?, ?, ?, ?) on duplicate key update id = id`
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(o.bind(query), topic, key, data, now, now)
+	return err
+}
+
+// EnqueueMail adds a mail message to the outbox inside the caller's transaction
+func (o *Outbox) EnqueueMail(tx *sql.Tx, dedupKey string, msg mailer.Message) error {
+	return o.Enqueue(tx, TopicMail, dedupKey, msg)
+}
+
+// EnqueueWebhook adds a webhook to the outbox inside the caller's transaction
+func (o *Outbox) EnqueueWebhook(tx *sql.Tx, dedupKey string, hook Webhook) error {
+	return o.Enqueue(tx, TopicWebhook, dedupKey, hook)
+}
+
+// Dispatch delivers one batch of pending messages, and returns the number delivered.
+// Messages are claimed for ClaimTimeout before they are delivered, so several instances
+// may dispatch at the same time without sending the same message twice, and a message
+// claimed by an instance which stops is delivered once the claim runs out. A message that
+// fails is retried with an increasing delay, until it has been tried MaxAttempts times.
+func (o *Outbox) Dispatch() (int, error) {
+	messages, err := o.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	// every message is marked on its own, so that a failure to mark one does not undo
+	// the others, which have been sent
+	delivered := 0
+	for _, msg := range messages {
+		err = o.deliver(msg)
+		if err != nil {
+			o.logError(fmt.Sprintf("outbox: delivering message %d (%s): %s", msg.ID, msg.Topic, err))
+			_, err = o.DB.Exec(o.bind("update outbox set last_error = ?, available_at = ? where id = ?"),
+				err.Error(), time.Now().Add(backoff(msg.Attempts)), msg.ID)
+			if err != nil {
+				o.logError(fmt.Sprintf("outbox: scheduling message %d for a retry: %s", msg.ID, err))
+			}
+			continue
+		}
+
+		delivered++
+		_, err = o.DB.Exec(o.bind("update outbox set delivered_at = ? where id = ?"), time.Now(), msg.ID)
+		if err != nil {
+			// the message is sent again once the claim runs out, as delivery is at-least-once
+			o.logError(fmt.Sprintf("outbox: marking message %d delivered: %s", msg.ID, err))
+		}
+	}
+
+	return delivered, nil
+}
+
+// claim takes up to BatchSize pending messages, in a short transaction which counts the
+// attempt and keeps them from being claimed again until ClaimTimeout has passed. The
+// attempts of the messages returned include this one.
+func (o *Outbox) claim() ([]Message, error) {
+	tx, err := o.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `select id, topic, coalesce(dedup_key, ''), payload, attempts from outbox
+		where delivered_at is null and attempts < ? and available_at <= ?
+		order by id limit ? for update skip locked`
+
+	rows, err := tx.Query(o.bind(query), o.MaxAttempts, time.Now(), o.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	var ids []interface{}
+	for rows.Next() {
+		var msg Message
+		err = rows.Scan(&msg.ID, &msg.Topic, &msg.DedupKey, &msg.Payload, &msg.Attempts)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		msg.Attempts++
+		messages = append(messages, msg)
+		ids = append(ids, msg.ID)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	query = "update outbox set attempts = attempts + 1, available_at = ? where id in (?" +
+		strings.Repeat(", ?", len(ids)-1) + ")"
+	args := append([]interface{}{time.Now().Add(o.ClaimTimeout)}, ids...)
+	_, err = tx.Exec(o.bind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, tx.Commit()
+}
+
+// ListenForMessages dispatches pending messages every interval. It runs continually
+// in the background, so it should be started in its own goroutine.
+func (o *Outbox) ListenForMessages(interval time.Duration) {
+	for {
+		n, err := o.Dispatch()
+		if err != nil {
+			o.logError("outbox:", err)
+		}
+
+		// keep going while there is a backlog
+		if err == nil && n == o.BatchSize {
+			continue
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// Purge deletes messages delivered more than age ago, and messages which failed their
+// last attempt more than age ago, having been tried MaxAttempts times
+func (o *Outbox) Purge(age time.Duration) error {
+	query := `delete from outbox where (delivered_at is not null and delivered_at < ?)
+		or (delivered_at is null and attempts >= ? and available_at < ?)`
+
+	before := time.Now().Add(-age)
+	_, err := o.DB.Exec(o.bind(query), before, o.MaxAttempts, before)
+	return err
+}
+
+// deliver passes msg to the handler registered for its topic
+func (o *Outbox) deliver(msg Message) error {
+	h, ok := o.handlers[msg.Topic]
+	if !ok {
+		return fmt.Errorf("no handler registered for topic %s", msg.Topic)
+	}
+
+	return h(msg)
+}
+
+// MailHandler returns a handler that sends mail messages using m
+func MailHandler(m *mailer.Mail) Handler {
+	return func(msg Message) error {
+		var mail mailer.Message
+		err := json.Unmarshal(msg.Payload, &mail)
+		if err != nil {
+			return err
+		}
+
+		return m.Send(mail)
+	}
+}
+
+// WebhookHandler returns a handler that sends webhooks using client. The dedup key, if any,
+// is sent in the Idempotency-Key header so that receivers can ignore repeats.
+func WebhookHandler(client *http.Client) Handler {
+	return func(msg Message) error {
+		var hook Webhook
+		err := json.Unmarshal(msg.Payload, &hook)
+		if err != nil {
+			return err
+		}
+
+		method := hook.Method
+		if method == "" {
+			method = http.MethodPost
+		}
+
+		req, err := http.NewRequest(method, hook.URL, bytes.NewReader(hook.Body))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range hook.Headers {
+			req.Header.Set(key, value)
+		}
+		if msg.DedupKey != "" {
+			req.Header.Set("Idempotency-Key", msg.DedupKey)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return errors.New("webhook returned " + resp.Status)
+		}
+
+		return nil
+	}
+}
+
+// isPostgres reports whether the outbox is stored in postgres
+func (o *Outbox) isPostgres() bool {
+	return o.DataType == "postgres" || o.DataType == "postgresql" || o.DataType == "pgx"
+}
+
+// bind rewrites ? placeholders as $1, $2... when the database is postgres
+func (o *Outbox) bind(query string) string {
+	if !o.isPostgres() {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// backoff returns how long to wait before retrying a message that has failed attempts times
+func backoff(attempts int) time.Duration {
+	d := time.Duration(attempts*attempts) * 10 * time.Second
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+func (o *Outbox) logError(v ...interface{}) {
+	if o.ErrorLog != nil {
+		o.ErrorLog.Println(v...)
+	}
+}
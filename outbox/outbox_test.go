@@ -0,0 +1,220 @@
+package outbox
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestOutbox_bind(t *testing.T) {
+	var tests = []struct {
+		name     string
+		dataType string
+		query    string
+		expected string
+	}{
+		{"postgres", "postgres", "update outbox set a = ? where id = ?", "update outbox set a = $1 where id = $2"},
+		{"pgx", "pgx", "select ?", "select $1"},
+		{"mysql", "mysql", "update outbox set a = ? where id = ?", "update outbox set a = ? where id = ?"},
+	}
+
+	for _, e := range tests {
+		o := New(nil, e.dataType, nil)
+		if got := o.bind(e.query); got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if backoff(1) != 10*time.Second {
+		t.Error("wrong backoff for first attempt:", backoff(1))
+	}
+
+	if backoff(2) <= backoff(1) {
+		t.Error("backoff does not increase")
+	}
+
+	if backoff(100) != time.Hour {
+		t.Error("backoff is not capped at one hour:", backoff(100))
+	}
+}
+
+func TestOutbox_deliver(t *testing.T) {
+	o := New(nil, "postgres", nil)
+
+	err := o.deliver(Message{Topic: "jobs"})
+	if err == nil {
+		t.Error("no error delivering message without a handler")
+	}
+
+	called := false
+	o.Register("jobs", func(msg Message) error {
+		called = true
+		return nil
+	})
+
+	err = o.deliver(Message{Topic: "jobs"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("handler was not called")
+	}
+}
+
+// newMockOutbox returns an outbox on a mock postgres database
+func newMockOutbox(t *testing.T) (*Outbox, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return New(db, "postgres", nil), mock
+}
+
+// within matches a time within a second of d from now
+type within time.Duration
+
+func (d within) Match(v driver.Value) bool {
+	at, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+
+	diff := time.Until(at) - time.Duration(d)
+	return diff > -time.Second && diff < time.Second
+}
+
+var outboxColumns = []string{"id", "topic", "dedup_key", "payload", "attempts"}
+
+func TestOutbox_Enqueue(t *testing.T) {
+	for _, dataType := range []string{"postgres", "mysql"} {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := New(db, dataType, nil)
+
+		// a repeated dedup key is ignored by the database, rather than failing the transaction
+		ignore := "on conflict (dedup_key) do nothing"
+		if dataType == "mysql" {
+			ignore = "on duplicate key update id = id"
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(ignore)).
+			WithArgs(TopicWebhook, "order-7", []byte(`{"n":1}`), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(ignore)).
+			WithArgs(TopicWebhook, nil, []byte(`{"n":2}`), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		tx, _ := db.Begin()
+		if err := o.Enqueue(tx, TopicWebhook, "order-7", map[string]int{"n": 1}); err != nil {
+			t.Error(dataType, err)
+		}
+		// messages without a dedup key are stored with a null key, which never conflicts
+		if err := o.Enqueue(tx, TopicWebhook, "", map[string]int{"n": 2}); err != nil {
+			t.Error(dataType, err)
+		}
+		_ = tx.Commit()
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(dataType, err)
+		}
+		_ = db.Close()
+	}
+}
+
+func TestOutbox_Dispatch(t *testing.T) {
+	o, mock := newMockOutbox(t)
+	o.MaxAttempts = 5
+
+	var sent []int64
+	o.Register("jobs", func(msg Message) error {
+		if msg.ID == 2 {
+			return errors.New("unavailable")
+		}
+		sent = append(sent, msg.ID)
+		return nil
+	})
+
+	// messages are claimed, and their attempt counted, in a transaction of their own,
+	// and only those with attempts left are claimed
+	mock.ExpectBegin()
+	mock.ExpectQuery("select .* from outbox").
+		WithArgs(5, sqlmock.AnyArg(), o.BatchSize).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(1, "jobs", "", []byte("{}"), 0).
+			AddRow(2, "jobs", "", []byte("{}"), 2))
+	mock.ExpectExec(regexp.QuoteMeta("update outbox set attempts = attempts + 1, available_at = $1 where id in ($2, $3)")).
+		WithArgs(within(o.ClaimTimeout), 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	// after the transaction, each message is marked on its own, and a failed message is
+	// retried after the backoff for its third attempt
+	mock.ExpectExec(regexp.QuoteMeta("update outbox set delivered_at = $1 where id = $2")).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnError(errors.New("connection lost"))
+	mock.ExpectExec(regexp.QuoteMeta("update outbox set last_error = $1, available_at = $2 where id = $3")).
+		WithArgs("unavailable", within(backoff(3)), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	n, err := o.Dispatch()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// a failure to mark a message does not undo the delivery of the others
+	if n != 1 || len(sent) != 1 || sent[0] != 1 {
+		t.Errorf("expected message 1 to be delivered, got %d delivered: %v", n, sent)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOutbox_DispatchNothing(t *testing.T) {
+	o, mock := newMockOutbox(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("select .* from outbox").WillReturnRows(sqlmock.NewRows(outboxColumns))
+	mock.ExpectRollback()
+
+	n, err := o.Dispatch()
+	if err != nil || n != 0 {
+		t.Error("expected nothing to be dispatched, got", n, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOutbox_Purge(t *testing.T) {
+	o, mock := newMockOutbox(t)
+	o.MaxAttempts = 3
+
+	// messages which have used up their attempts are purged as well as delivered ones
+	mock.ExpectExec(regexp.QuoteMeta("or (delivered_at is null and attempts >= $2 and available_at < $3)")).
+		WithArgs(within(-24*time.Hour), 3, within(-24*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	if err := o.Purge(24 * time.Hour); err != nil {
+		t.Error(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,184 @@
+package sokudo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/petrostrak/sokudo/cache"
+	"github.com/petrostrak/sokudo/sse"
+	"github.com/petrostrak/sokudo/ws"
+)
+
+// StreamEvents streams server-sent events to the client of r until it disconnects: the
+// events published to topics, and, when a user is logged in, the events published to
+// them with s.Events.PublishToUser. For example
+//
+//	a.App.Routes.Get("/events", func(w http.ResponseWriter, r *http.Request) {
+//		_ = a.App.StreamEvents(w, r, "dashboard")
+//	})
+func (s *Sokudo) StreamEvents(w http.ResponseWriter, r *http.Request, topics ...string) error {
+	if s.Session != nil {
+		if userID := s.Session.GetInt(r.Context(), "userID"); userID != 0 {
+			topics = append(topics, sse.UserTopic(userID))
+		}
+	}
+
+	return s.Events.Stream(w, r, topics...)
+}
+
+// createEventBroker returns the broker for server-sent events, which publishes them
+// through redis when the cache is in redis, so that they reach every instance
+func (s *Sokudo) createEventBroker() *sse.Broker {
+	broker := sse.NewBroker()
+
+	if heartbeat, err := strconv.Atoi(os.Getenv("SSE_HEARTBEAT")); err == nil && heartbeat > 0 {
+		broker.Heartbeat = time.Duration(heartbeat) * time.Second
+	}
+
+	if myRedisCache != nil && (os.Getenv("CACHE") == "redis" || os.Getenv("CACHE") == "tiered") {
+		broker.PubSub = myRedisCache
+		go broker.ListenForEvents()
+	}
+
+	return broker
+}
+
+// WebSocketHandler returns a handler which upgrades requests to WebSocket connections in
+// s.WebSockets, calling onConnect, if it is not nil, with each new connection. For example
+//
+//	a.App.Routes.Get("/ws", a.App.WebSocketHandler(func(c *ws.Conn, r *http.Request) {
+//		c.Join("dashboard")
+//	}).ServeHTTP)
+//
+// Clients authenticate with their session, or with an API token checked by s.TokenAuth
+// in the Authorization header. Browsers cannot set headers on WebSocket requests, so
+// clients using API tokens may instead fetch a ticket from WebSocketTicketHandler, and
+// send it as the ticket query parameter. Anonymous clients are rejected.
+func (s *Sokudo) WebSocketHandler(onConnect func(c *ws.Conn, r *http.Request)) *ws.Handler {
+	return &ws.Handler{
+		Hub:          s.WebSockets,
+		Authenticate: s.authenticateWebSocket,
+		OnConnect:    onConnect,
+	}
+}
+
+// wsTicketTTL is the number of seconds a WebSocket ticket can be used for
+const wsTicketTTL = 30
+
+// errNoTicketCache is returned when a WebSocket ticket is requested without a cache to keep it in
+var errNoTicketCache = errors.New("websocket tickets need a cache")
+
+// WebSocketTicket returns a ticket which opens one WebSocket connection for the user with
+// userID, as the ticket query parameter, within 30 seconds. Unlike API tokens, tickets
+// are harmless in access and proxy logs, since they cannot be used again. Tickets are kept
+// in s.Cache, so that every instance sharing the cache accepts them.
+func (s *Sokudo) WebSocketTicket(userID int) (string, error) {
+	if s.Cache == nil {
+		return "", errNoTicketCache
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(b)
+
+	if err := s.Cache.Set(wsTicketKey(ticket), userID, wsTicketTTL); err != nil {
+		return "", err
+	}
+
+	return ticket, nil
+}
+
+// WebSocketTicketHandler responds with a WebSocket ticket, as {"ticket": "..."}, for the
+// client of r, authenticated with its session or its API token. For example
+//
+//	a.App.Routes.Post("/ws-ticket", a.App.WebSocketTicketHandler)
+func (s *Sokudo) WebSocketTicketHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.authenticateRequest(r)
+	if err != nil || userID == 0 {
+		s.ErrorUnauthorized(w, r)
+		return
+	}
+
+	ticket, err := s.WebSocketTicket(userID)
+	if err != nil {
+		s.ServerError(w, r, err)
+		return
+	}
+
+	_ = s.WriteJSON(w, http.StatusOK, map[string]string{"ticket": ticket})
+}
+
+// authenticateWebSocket returns the user logged in to the session of r, the user of the
+// ticket of r, or the user of the API token of r
+func (s *Sokudo) authenticateWebSocket(r *http.Request) (int, error) {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		if userID, err := s.redeemWebSocketTicket(ticket); err != nil || userID != 0 {
+			return userID, err
+		}
+	}
+
+	return s.authenticateRequest(r)
+}
+
+// authenticateRequest returns the user logged in to the session of r, or the user of the
+// API token in the Authorization header of r
+func (s *Sokudo) authenticateRequest(r *http.Request) (int, error) {
+	if s.Session != nil {
+		if userID := s.Session.GetInt(r.Context(), "userID"); userID != 0 {
+			return userID, nil
+		}
+	}
+
+	if s.TokenAuth == nil || r.Header.Get("Authorization") == "" {
+		return 0, nil
+	}
+
+	return s.TokenAuth(r)
+}
+
+// redeemWebSocketTicket returns the user of ticket, or 0 if the ticket is unknown, has
+// expired or has been used. The ticket is marked as used by swapping its user for 0, so
+// that only one connection can redeem it, even across instances.
+func (s *Sokudo) redeemWebSocketTicket(ticket string) (int, error) {
+	if s.Cache == nil {
+		return 0, nil
+	}
+
+	key := wsTicketKey(ticket)
+	userID, err := cache.GetAs[int](s.Cache, key)
+	if err != nil || userID == 0 {
+		return 0, nil
+	}
+
+	redeemed, err := s.Cache.CompareAndSwap(key, userID, 0, wsTicketTTL)
+	if err != nil || !redeemed {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// wsTicketKey returns the cache key a WebSocket ticket is kept under
+func wsTicketKey(ticket string) string {
+	return "ws-ticket:" + ticket
+}
+
+// createWebSocketHub returns the hub for WebSocket connections, which broadcasts through
+// redis when the cache is in redis, so that broadcasts reach every instance
+func (s *Sokudo) createWebSocketHub() *ws.Hub {
+	hub := ws.NewHub()
+
+	if myRedisCache != nil && (os.Getenv("CACHE") == "redis" || os.Getenv("CACHE") == "tiered") {
+		hub.PubSub = myRedisCache
+		go hub.ListenForBroadcasts()
+	}
+
+	return hub
+}
@@ -0,0 +1,141 @@
+package sokudo
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/petrostrak/sokudo/cache"
+	"github.com/petrostrak/sokudo/session"
+	"github.com/petrostrak/sokudo/ws"
+)
+
+func TestSokudo_WebSocketHandler(t *testing.T) {
+	sm := scs.New()
+	sm.Store = session.NewMemoryStore(0)
+
+	s := &Sokudo{
+		InfoLog:    log.New(io.Discard, "", 0),
+		Session:    sm,
+		Cache:      cache.NewMemoryCache(100, 0),
+		WebSockets: ws.NewHub(),
+		TokenAuth: func(r *http.Request) (int, error) {
+			if r.Header.Get("Authorization") != "Bearer good-token" {
+				return 0, errors.New("invalid token")
+			}
+			return 9, nil
+		},
+	}
+
+	// the same middleware as the application's routes
+	mux := chi.NewRouter()
+	mux.Use(s.SessionLoad)
+	mux.Use(s.NoSurf)
+	mux.Get("/login", func(w http.ResponseWriter, r *http.Request) {
+		s.Session.Put(r.Context(), "userID", 7)
+	})
+	mux.Get("/ws", s.WebSocketHandler(func(c *ws.Conn, r *http.Request) {
+		_ = c.Send([]byte("hello"))
+	}).ServeHTTP)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	resp, err := http.Get(srv.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	header := http.Header{}
+	for _, cookie := range resp.Cookies() {
+		header.Add("Cookie", cookie.String())
+	}
+
+	ticket, err := s.WebSocketTicket(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		header http.Header
+		userID int
+	}{
+		{"session", wsURL, header, 7},
+		{"token", wsURL, http.Header{"Authorization": {"Bearer good-token"}}, 9},
+		{"bad token", wsURL, http.Header{"Authorization": {"Bearer bad-token"}}, 0},
+		{"token in url", wsURL + "?token=good-token", nil, 0},
+		{"ticket", wsURL + "?ticket=" + ticket, nil, 9},
+		{"used ticket", wsURL + "?ticket=" + ticket, nil, 0},
+		{"unknown ticket", wsURL + "?ticket=made-up", nil, 0},
+		{"anonymous", wsURL, nil, 0},
+	}
+
+	for _, test := range tests {
+		conn, resp, err := websocket.DefaultDialer.Dial(test.url, test.header)
+		if test.userID == 0 {
+			if err == nil || resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("%s: client was not rejected", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil || string(data) != "hello" {
+			t.Errorf("%s: no message from the server: %v", test.name, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestSokudo_WebSocketTicketHandler(t *testing.T) {
+	s := &Sokudo{
+		Cache: cache.NewMemoryCache(100, 0),
+		TokenAuth: func(r *http.Request) (int, error) {
+			if r.Header.Get("Authorization") != "Bearer good-token" {
+				return 0, errors.New("invalid token")
+			}
+			return 9, nil
+		},
+	}
+
+	r := httptest.NewRequest("POST", "/ws-ticket", nil)
+	r.Header.Set("Authorization", "Bearer good-token")
+	w := httptest.NewRecorder()
+	s.WebSocketTicketHandler(w, r)
+
+	var body struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Ticket == "" {
+		t.Fatal("no ticket in the response:", w.Body.String())
+	}
+
+	if userID, _ := s.redeemWebSocketTicket(body.Ticket); userID != 9 {
+		t.Error("ticket was not issued for the user of the token, got", userID)
+	}
+
+	r = httptest.NewRequest("POST", "/ws-ticket", nil)
+	w = httptest.NewRecorder()
+	s.WebSocketTicketHandler(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Error("issued a ticket to an anonymous client:", w.Code)
+	}
+}
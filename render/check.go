@@ -0,0 +1,657 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// Problem is an error found in a template by Check. File is relative to the folder that
+// was checked, and Line is 0 when the error is not on a particular line.
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// goBuiltins are the functions every Go template has
+var goBuiltins = []string{
+	"and", "call", "html", "index", "slice", "js", "len", "not", "or", "print", "printf",
+	"println", "urlquery", "eq", "ge", "gt", "le", "lt", "ne",
+}
+
+// jetBuiltins are the functions every Jet template has
+var jetBuiltins = []string{
+	"lower", "upper", "hasPrefix", "hasSuffix", "repeat", "replace", "split", "trimSpace",
+	"html", "url", "safeHtml", "safeJs", "raw", "unsafe", "writeJson", "json", "map",
+	"slice", "array", "isset", "len", "includeIfExists", "exec", "ints", "dump",
+}
+
+// jetExtensions are the extensions Jet tries when it looks up a template
+var jetExtensions = []string{"", ".jet", ".html.jet", ".jet.html"}
+
+// Check parses every Jet and Go template in the views folder, including layouts and
+// partials, without rendering them. Besides syntax errors, it finds uses of functions
+// which are neither built in nor in Funcs, of blocks which no template defines, and of
+// partials which do not exist.
+func (c *Render) Check() []Problem {
+	viewsPath := filepath.Join(c.RootPath, "views")
+
+	var jetFiles, goFiles []string
+	err := filepath.WalkDir(viewsPath, func(file string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+		case strings.HasSuffix(file, ".jet"):
+			jetFiles = append(jetFiles, file)
+		case strings.HasSuffix(file, ".tmpl"):
+			goFiles = append(goFiles, file)
+		}
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return []Problem{{File: "views", Message: err.Error()}}
+	}
+
+	funcs := c.funcMap()
+	problems := c.checkJet(viewsPath, jetFiles, funcs)
+
+	// pages are checked together with the layouts and partials, which they may use
+	var pages, shared []string
+	for _, file := range goFiles {
+		if strings.HasSuffix(file, ".page.tmpl") {
+			pages = append(pages, file)
+		} else {
+			shared = append(shared, file)
+		}
+	}
+	problems = append(problems, CheckGoTemplates(viewsPath, pages, shared, funcs)...)
+
+	return sortProblems(problems)
+}
+
+// CheckGoTemplates parses the Go templates in files, each together with the templates in
+// shared, and reports their syntax errors, their uses of functions which are neither
+// built in nor in funcs, and the templates they use which are not defined. File names in
+// the problems are relative to dir.
+func CheckGoTemplates(dir string, files, shared []string, funcs template.FuncMap) []Problem {
+	known := make(map[string]bool)
+	for _, name := range goBuiltins {
+		known[name] = true
+	}
+	for name := range funcs {
+		known[name] = true
+	}
+
+	rel := func(file string) string {
+		if r, err := filepath.Rel(dir, file); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return file
+	}
+
+	var problems []Problem
+	trees := make(map[string]map[string]*parse.Tree)
+	for _, file := range append(append([]string{}, shared...), files...) {
+		if _, parsed := trees[file]; parsed {
+			continue
+		}
+
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			problems = append(problems, Problem{File: rel(file), Message: err.Error()})
+			continue
+		}
+
+		treeSet := make(map[string]*parse.Tree)
+		tree := parse.New(filepath.Base(file))
+		tree.Mode = parse.SkipFuncCheck
+		_, err = tree.Parse(string(contents), "", "", treeSet)
+		if err != nil {
+			_, line, msg, _ := splitTemplateError(err.Error())
+			problems = append(problems, Problem{File: rel(file), Line: line, Message: msg})
+			continue
+		}
+		trees[file] = treeSet
+
+		for _, t := range treeSet {
+			for _, ident := range goIdentifiers(t.Root) {
+				if !known[ident.Ident] {
+					problems = append(problems, Problem{
+						File:    rel(file),
+						Line:    goLine(t, ident),
+						Message: fmt.Sprintf("function %q not defined", ident.Ident),
+					})
+				}
+			}
+		}
+	}
+
+	// the templates a file uses must be defined by it or the shared templates
+	sharedDefs := make(map[string]bool)
+	for _, file := range shared {
+		for name := range trees[file] {
+			sharedDefs[name] = true
+		}
+	}
+
+	for _, file := range files {
+		treeSet, ok := trees[file]
+		if !ok {
+			continue
+		}
+
+		defined := func(name string) bool {
+			_, own := treeSet[name]
+			return own || sharedDefs[name]
+		}
+
+		// follow the templates used from those the file defines, so that a layout's
+		// template is only required of the pages which use the layout
+		seen := make(map[string]bool)
+		var pending []string
+		for name := range treeSet {
+			pending = append(pending, name)
+		}
+		for len(pending) > 0 {
+			name := pending[0]
+			pending = pending[1:]
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			tree, owner := treeSet[name], file
+			if tree == nil {
+				for _, s := range shared {
+					if t, ok := trees[s][name]; ok {
+						tree, owner = t, s
+						break
+					}
+				}
+			}
+			if tree == nil {
+				continue
+			}
+
+			for _, used := range goTemplateUses(tree.Root) {
+				if !defined(used.Name) {
+					msg := fmt.Sprintf("template %q not defined", used.Name)
+					if owner != file {
+						msg += fmt.Sprintf(" for %s", rel(file))
+					}
+					problems = append(problems, Problem{File: rel(owner), Line: goLine(tree, used), Message: msg})
+					continue
+				}
+				pending = append(pending, used.Name)
+			}
+		}
+	}
+
+	return sortProblems(dedupeProblems(problems))
+}
+
+// checkJet parses the Jet templates in files
+func (c *Render) checkJet(viewsPath string, files []string, funcs template.FuncMap) []Problem {
+	// a set of its own parses the files as they are now, rather than as JetViews cached them
+	loader := jet.NewOSFileSystemLoader(viewsPath)
+	set := jet.NewSet(loader, jet.InDevelopmentMode())
+
+	known := make(map[string]bool)
+	for _, name := range jetBuiltins {
+		known[name] = true
+	}
+	for name := range funcs {
+		known[name] = true
+	}
+
+	var problems []Problem
+	var templates []*jet.Template
+	names := make(map[*jet.Template]string)
+	for _, file := range files {
+		rel, err := filepath.Rel(viewsPath, file)
+		if err != nil {
+			continue
+		}
+		name := "/" + filepath.ToSlash(rel)
+
+		t, err := set.GetTemplate(name)
+		if err != nil {
+			problems = append(problems, jetProblem(name, err))
+			continue
+		}
+		templates = append(templates, t)
+		names[t] = name
+	}
+
+	// blocks may be defined by any template, and yielded by any other which extends,
+	// imports or includes it
+	blocks := make(map[string]bool)
+	for _, t := range templates {
+		walkJet(t.Root, func(n jet.Node) {
+			if block, ok := n.(*jet.BlockNode); ok {
+				blocks[block.Name] = true
+			}
+		})
+	}
+
+	for _, t := range templates {
+		name := names[t]
+		file := strings.TrimPrefix(name, "/")
+
+		// variables may hold functions, so every name the template declares is known
+		declared := make(map[string]bool)
+		walkJet(t.Root, func(n jet.Node) {
+			for _, ident := range jetDeclarations(n) {
+				declared[ident] = true
+			}
+		})
+
+		walkJet(t.Root, func(n jet.Node) {
+			switch n := n.(type) {
+			case *jet.YieldNode:
+				if !n.IsContent && !blocks[n.Name] {
+					problems = append(problems, Problem{File: file, Line: n.Line, Message: fmt.Sprintf("block %q not defined", n.Name)})
+				}
+			case *jet.IncludeNode:
+				if s, ok := n.Name.(*jet.StringNode); ok && !jetTemplateExists(loader, s.Text, name) {
+					problems = append(problems, Problem{File: file, Line: n.Line, Message: fmt.Sprintf("included template %q not found", s.Text)})
+				}
+			case *jet.CallExprNode:
+				problems = append(problems, jetCallProblem(file, n.BaseExpr, known, declared, c.JetViews)...)
+			case *jet.PipeNode:
+				// a command with arguments, or after a pipe, is a call; the first command on
+				// its own, such as {{ name }}, is a value
+				for i, cmd := range n.Cmds {
+					if i > 0 || len(cmd.Exprs) > 0 {
+						problems = append(problems, jetCallProblem(file, cmd.BaseExpr, known, declared, c.JetViews)...)
+					}
+				}
+			}
+		})
+	}
+
+	return dedupeProblems(problems)
+}
+
+// jetCallProblem reports a call of fn, when it names a function which is neither known
+// nor a global of globals
+func jetCallProblem(file string, fn jet.Expression, known, declared map[string]bool, globals *jet.Set) []Problem {
+	ident, ok := fn.(*jet.IdentifierNode)
+	if !ok || known[ident.Ident] || declared[ident.Ident] {
+		return nil
+	}
+
+	if globals != nil {
+		if _, found := globals.LookupGlobal(ident.Ident); found {
+			return nil
+		}
+	}
+
+	return []Problem{{File: file, Line: ident.Line, Message: fmt.Sprintf("function %q not defined", ident.Ident)}}
+}
+
+// jetProblem turns a Jet parse error into a problem
+func jetProblem(name string, err error) Problem {
+	p := Problem{File: strings.TrimPrefix(name, "/"), Message: err.Error()}
+
+	// the error may be in a template which name extends or imports
+	if file, line, msg, ok := splitTemplateError(err.Error()); ok {
+		p.File, p.Line, p.Message = strings.TrimPrefix(file, "/"), line, msg
+	}
+
+	return p
+}
+
+// jetTemplateExists reports whether the template which from includes as name exists
+func jetTemplateExists(loader jet.Loader, name, from string) bool {
+	if !path.IsAbs(name) {
+		name = path.Join(path.Dir(from), name)
+	}
+
+	for _, ext := range jetExtensions {
+		if loader.Exists(name + ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jetDeclarations returns the names of the variables n declares
+func jetDeclarations(n jet.Node) []string {
+	var names []string
+
+	addSet := func(set *jet.SetNode) {
+		if set == nil {
+			return
+		}
+		for _, left := range set.Left {
+			if ident, ok := left.(*jet.IdentifierNode); ok {
+				names = append(names, ident.Ident)
+			}
+		}
+	}
+
+	addParams := func(params *jet.BlockParameterList) {
+		if params == nil {
+			return
+		}
+		for _, param := range params.List {
+			names = append(names, param.Identifier)
+		}
+	}
+
+	switch n := n.(type) {
+	case *jet.ActionNode:
+		addSet(n.Set)
+	case *jet.IfNode:
+		addSet(n.Set)
+	case *jet.RangeNode:
+		addSet(n.Set)
+	case *jet.BlockNode:
+		addParams(n.Parameters)
+	case *jet.TryNode:
+		if n.Catch != nil && n.Catch.Err != nil {
+			names = append(names, n.Catch.Err.Ident)
+		}
+	}
+
+	return names
+}
+
+// walkJet calls fn with n and every node below it
+func walkJet(n jet.Node, fn func(jet.Node)) {
+	if n == nil {
+		return
+	}
+
+	// typed nil pointers in interfaces
+	switch v := n.(type) {
+	case *jet.ListNode:
+		if v == nil {
+			return
+		}
+	case *jet.PipeNode:
+		if v == nil {
+			return
+		}
+	case *jet.SetNode:
+		if v == nil {
+			return
+		}
+	case *jet.BlockParameterList:
+		if v == nil {
+			return
+		}
+	}
+
+	fn(n)
+
+	walkAll := func(exprs []jet.Expression) {
+		for _, e := range exprs {
+			walkJet(e, fn)
+		}
+	}
+
+	walkBranch := func(b *jet.BranchNode) {
+		if b.Set != nil {
+			walkJet(b.Set, fn)
+		}
+		walkJet(b.Expression, fn)
+		if b.List != nil {
+			walkJet(b.List, fn)
+		}
+		if b.ElseList != nil {
+			walkJet(b.ElseList, fn)
+		}
+	}
+
+	walkParams := func(params *jet.BlockParameterList) {
+		if params == nil {
+			return
+		}
+		for _, param := range params.List {
+			walkJet(param.Expression, fn)
+		}
+	}
+
+	switch n := n.(type) {
+	case *jet.ListNode:
+		for _, child := range n.Nodes {
+			walkJet(child, fn)
+		}
+	case *jet.ActionNode:
+		if n.Set != nil {
+			walkJet(n.Set, fn)
+		}
+		if n.Pipe != nil {
+			walkJet(n.Pipe, fn)
+		}
+	case *jet.PipeNode:
+		for _, cmd := range n.Cmds {
+			walkJet(cmd, fn)
+		}
+	case *jet.CommandNode:
+		walkJet(n.BaseExpr, fn)
+		walkAll(n.Exprs)
+	case *jet.CallExprNode:
+		walkJet(n.BaseExpr, fn)
+		walkAll(n.Exprs)
+	case *jet.SetNode:
+		walkAll(n.Left)
+		walkAll(n.Right)
+	case *jet.IfNode:
+		walkBranch(&n.BranchNode)
+	case *jet.RangeNode:
+		walkBranch(&n.BranchNode)
+	case *jet.BlockNode:
+		walkParams(n.Parameters)
+		walkJet(n.Expression, fn)
+		if n.List != nil {
+			walkJet(n.List, fn)
+		}
+		if n.Content != nil {
+			walkJet(n.Content, fn)
+		}
+	case *jet.YieldNode:
+		walkParams(n.Parameters)
+		walkJet(n.Expression, fn)
+		if n.Content != nil {
+			walkJet(n.Content, fn)
+		}
+	case *jet.IncludeNode:
+		walkJet(n.Name, fn)
+		walkJet(n.Context, fn)
+	case *jet.ReturnNode:
+		walkJet(n.Value, fn)
+	case *jet.TryNode:
+		if n.List != nil {
+			walkJet(n.List, fn)
+		}
+		if n.Catch != nil && n.Catch.List != nil {
+			walkJet(n.Catch.List, fn)
+		}
+	case *jet.ChainNode:
+		walkJet(n.Node, fn)
+	case *jet.NotExprNode:
+		walkJet(n.Expr, fn)
+	case *jet.TernaryExprNode:
+		walkJet(n.Boolean, fn)
+		walkJet(n.Left, fn)
+		walkJet(n.Right, fn)
+	case *jet.IndexExprNode:
+		walkJet(n.Base, fn)
+		walkJet(n.Index, fn)
+	case *jet.SliceExprNode:
+		walkJet(n.Base, fn)
+		walkJet(n.Index, fn)
+		walkJet(n.EndIndex, fn)
+	case *jet.AdditiveExprNode:
+		walkJet(n.Left, fn)
+		walkJet(n.Right, fn)
+	case *jet.MultiplicativeExprNode:
+		walkJet(n.Left, fn)
+		walkJet(n.Right, fn)
+	case *jet.LogicalExprNode:
+		walkJet(n.Left, fn)
+		walkJet(n.Right, fn)
+	case *jet.ComparativeExprNode:
+		walkJet(n.Left, fn)
+		walkJet(n.Right, fn)
+	case *jet.NumericComparativeExprNode:
+		walkJet(n.Left, fn)
+		walkJet(n.Right, fn)
+	}
+}
+
+// goIdentifiers returns the functions used below n
+func goIdentifiers(n parse.Node) []*parse.IdentifierNode {
+	var idents []*parse.IdentifierNode
+	walkGo(n, func(n parse.Node) {
+		if ident, ok := n.(*parse.IdentifierNode); ok {
+			idents = append(idents, ident)
+		}
+	})
+	return idents
+}
+
+// goTemplateUses returns the {{template}} actions below n
+func goTemplateUses(n parse.Node) []*parse.TemplateNode {
+	var uses []*parse.TemplateNode
+	walkGo(n, func(n parse.Node) {
+		if t, ok := n.(*parse.TemplateNode); ok {
+			uses = append(uses, t)
+		}
+	})
+	return uses
+}
+
+// walkGo calls fn with n and every node below it
+func walkGo(n parse.Node, fn func(parse.Node)) {
+	switch v := n.(type) {
+	case nil:
+		return
+	case *parse.ListNode:
+		if v == nil {
+			return
+		}
+	case *parse.PipeNode:
+		if v == nil {
+			return
+		}
+	}
+
+	fn(n)
+
+	walkBranch := func(b *parse.BranchNode) {
+		walkGo(b.Pipe, fn)
+		walkGo(b.List, fn)
+		walkGo(b.ElseList, fn)
+	}
+
+	switch n := n.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			walkGo(child, fn)
+		}
+	case *parse.ActionNode:
+		walkGo(n.Pipe, fn)
+	case *parse.PipeNode:
+		for _, cmd := range n.Cmds {
+			walkGo(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkGo(arg, fn)
+		}
+	case *parse.ChainNode:
+		walkGo(n.Node, fn)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		walkGo(n.Pipe, fn)
+	}
+}
+
+// goLine returns the line of n in tree
+func goLine(tree *parse.Tree, n parse.Node) int {
+	location, _ := tree.ErrorContext(n)
+	parts := strings.Split(location, ":")
+	if len(parts) < 3 {
+		return 0
+	}
+
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+	return line
+}
+
+// splitTemplateError splits a template error, such as template: x.tmpl:3: ..., into the
+// file and line it names and the message. When the error names several locations, as
+// when a template fails to parse the template it extends, the last is the one at fault.
+func splitTemplateError(msg string) (file string, line int, message string, ok bool) {
+	matches := templateErrorLocation.FindAllStringSubmatchIndex(msg, -1)
+	if matches == nil {
+		return "", 0, msg, false
+	}
+
+	match := matches[len(matches)-1]
+	file = msg[match[2]:match[3]]
+	line, _ = strconv.Atoi(msg[match[4]:match[5]])
+
+	rest := msg[match[1]:]
+	// skip a column, and the separator before the message
+	if i := strings.Index(rest, ": "); i >= 0 && i < 8 {
+		rest = rest[i+2:]
+	}
+
+	return file, line, strings.TrimSpace(rest), true
+}
+
+func dedupeProblems(problems []Problem) []Problem {
+	seen := make(map[Problem]bool)
+	var unique []Problem
+	for _, p := range problems {
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+
+	return unique
+}
+
+func sortProblems(problems []Problem) []Problem {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+
+	return problems
+}
@@ -0,0 +1,68 @@
+package render
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRender_Check(t *testing.T) {
+	c := &Render{RootPath: "./testdata"}
+	c.AddDefaultFuncs()
+
+	if problems := c.Check(); len(problems) != 0 {
+		t.Errorf("expected no problems in testdata views, got %v", problems)
+	}
+
+	c = &Render{RootPath: "./testdata/check"}
+	c.AddDefaultFuncs()
+
+	expected := []Problem{
+		{"broken.jet", 4, "unexpected EOF"},
+		{"users/broken.page.tmpl", 4, "unexpected EOF"},
+		{"users/edit.page.tmpl", 3, `function "shout" not defined`},
+		{"users/edit.page.tmpl", 4, `template "sidebar" not defined`},
+		{"users/show.jet", 3, `function "shout" not defined`},
+		{"users/show.jet", 4, `block "sidebar" not defined`},
+		{"users/show.jet", 5, `included template "../partials/missing.jet" not found`},
+	}
+
+	problems := c.Check()
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+
+	for i, p := range problems {
+		if p != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], p)
+		}
+	}
+
+	// functions added by the application are known
+	c.AddFunc("shout", func(s string) string { return s })
+	for _, p := range c.Check() {
+		if p.Message == `function "shout" not defined` {
+			t.Errorf("expected shout to be known, got %s", p)
+		}
+	}
+}
+
+func TestCheckGoTemplates(t *testing.T) {
+	dir := "./testdata/check/views"
+	pages := []string{filepath.Join(dir, "home.page.tmpl")}
+	shared := []string{
+		filepath.Join(dir, "layouts", "base.layout.tmpl"),
+		filepath.Join(dir, "partials", "footer.partial.tmpl"),
+	}
+
+	// date is not a function without the default functions
+	problems := CheckGoTemplates(dir, pages, shared, nil)
+	if len(problems) != 1 || problems[0].File != "partials/footer.partial.tmpl" || problems[0].Line != 1 {
+		t.Errorf("expected date to be reported in the footer, got %v", problems)
+	}
+
+	// without the layout, the page's template is missing
+	problems = CheckGoTemplates(dir, pages, nil, nil)
+	if len(problems) != 1 || problems[0].Message != `template "base" not defined` {
+		t.Errorf("expected base to be reported, got %v", problems)
+	}
+}
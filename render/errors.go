@@ -0,0 +1,107 @@
+package render
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// templateErrorLocation finds the file and line in the errors of Go templates, such as
+// template: show.page.tmpl:3:5: ..., and of Jet, such as Jet Runtime Error ("/show.jet":3)
+var templateErrorLocation = regexp.MustCompile(`(?:template: |Jet Runtime Error \(")([^:"]+)"?:(\d+)`)
+
+// TemplateError is returned by Page when a view fails to parse or render. File is the
+// template the error is in, relative to the views folder, which may be a layout or
+// partial rather than the view itself, and Line its line, when the error names them.
+type TemplateError struct {
+	View string
+	File string
+	Line int
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// templateError wraps err, from rendering view with the Jet or Go renderer, in a
+// TemplateError
+func (c *Render) templateError(view, renderer string, err error) error {
+	var te *TemplateError
+	if err == nil || errors.As(err, &te) {
+		return err
+	}
+
+	te = &TemplateError{View: view, Err: err}
+	if renderer == "jet" {
+		te.File = view + ".jet"
+	} else {
+		te.File = view + ".page.tmpl"
+	}
+
+	match := templateErrorLocation.FindStringSubmatch(err.Error())
+	if match == nil {
+		return te
+	}
+
+	te.Line, _ = strconv.Atoi(match[2])
+	name := strings.TrimPrefix(match[1], "/")
+	if renderer == "jet" {
+		te.File = name
+		return te
+	}
+
+	// Go templates are named after the base name of their file, which may be a layout or
+	// partial in any folder under views
+	if filepath.Base(te.File) == name {
+		return te
+	}
+	files, _ := c.templateFiles()
+	for _, file := range files {
+		if filepath.Base(file) == name {
+			if rel, err := filepath.Rel(filepath.Join(c.RootPath, "views"), file); err == nil {
+				te.File = filepath.ToSlash(rel)
+			}
+			break
+		}
+	}
+
+	return te
+}
+
+// SourceLine is a line of a template, for showing where an error is
+type SourceLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+// Source returns the lines of the template around the line of the error, or nil if the
+// template cannot be read or the error has no line
+func (e *TemplateError) Source(rootPath string, context int) []SourceLine {
+	if e.Line == 0 {
+		return nil
+	}
+
+	contents, err := os.ReadFile(filepath.Join(rootPath, "views", filepath.FromSlash(e.File)))
+	if err != nil {
+		return nil
+	}
+
+	var lines []SourceLine
+	for i, text := range strings.Split(string(contents), "\n") {
+		number := i + 1
+		if number >= e.Line-context && number <= e.Line+context {
+			lines = append(lines, SourceLine{Number: number, Text: text, Current: number == e.Line})
+		}
+	}
+
+	return lines
+}
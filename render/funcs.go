@@ -0,0 +1,288 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/petrostrak/sokudo/i18n"
+	"github.com/petrostrak/sokudo/urlsigner"
+)
+
+// AddFunc makes fn available to both Jet and Go templates as name, for example
+//
+//	app.Render.AddFunc("upper", strings.ToUpper)
+//
+// Jet escapes the output of every function, so functions returning template.HTML must be
+// piped through raw in Jet templates. The csrf_field function writes its field itself in
+// Jet, so it needs no raw.
+func (c *Render) AddFunc(name string, fn interface{}) {
+	c.funcsMu.Lock()
+	if c.Funcs == nil {
+		c.Funcs = template.FuncMap{}
+	}
+	c.Funcs[name] = fn
+	c.funcsMu.Unlock()
+
+	if c.JetViews != nil {
+		c.JetViews.AddGlobal(name, fn)
+	}
+
+	// Go templates look up functions when they are parsed, so the cache is rebuilt
+	c.cache.mu.Lock()
+	c.cache.templates = nil
+	c.cache.localized = nil
+	c.cache.mu.Unlock()
+}
+
+// AddDefaultFuncs registers the functions the framework provides to templates:
+//
+//	signed_url(url)                  url signed with the application key
+//	csrf_field(token)                hidden form field holding the CSRF token
+//	asset(path)                      url of a file in public, with a version hash
+//	route(name, key, value, ...)     url of a named route, with its parameters filled in
+//	date(t, layout)                  t formatted with a Go time layout
+//	number(n, decimals)              n with thousands separators and decimals places
+//	t(key, args...)                  translation of key
+//	tn(key, count, args...)          translation of key, in the plural form for count
+//
+// t and tn translate into the locale of the request when I18n is set, and otherwise
+// return the key.
+func (c *Render) AddDefaultFuncs() {
+	c.AddFunc("signed_url", c.signedURL)
+	c.AddFunc("csrf_field", csrfField)
+	if c.JetViews != nil {
+		c.JetViews.AddGlobal("csrf_field", jetCSRFField)
+	}
+	c.AddFunc("asset", c.Asset)
+	c.AddFunc("route", c.routeURL)
+	c.AddFunc("date", formatDate)
+	c.AddFunc("number", formatNumber)
+	t, tn := c.translators("")
+	c.AddFunc("t", t)
+	c.AddFunc("tn", tn)
+}
+
+// NameRoute gives the route with pattern, such as /users/{id}, a name that templates can
+// build urls for
+func (c *Render) NameRoute(name, pattern string) {
+	c.funcsMu.Lock()
+	defer c.funcsMu.Unlock()
+
+	if c.routes == nil {
+		c.routes = make(map[string]string)
+	}
+	c.routes[name] = pattern
+}
+
+// URL returns the url of the route named name, with the parameters in the pattern replaced
+// by the values following their keys in params, for example
+//
+//	c.URL("users.show", "id", 7) // "/users/7"
+//
+// Parameters which are not in the pattern are added as a query string.
+func (c *Render) URL(name string, params ...interface{}) (string, error) {
+	c.funcsMu.RLock()
+	pattern, ok := c.routes[name]
+	c.funcsMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("no route named %s", name)
+	}
+
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("route %s: parameters must be pairs of keys and values", name)
+	}
+
+	query := url.Values{}
+	for i := 0; i < len(params); i += 2 {
+		key := fmt.Sprint(params[i])
+		value := fmt.Sprint(params[i+1])
+
+		placeholder := "{" + key + "}"
+		if start := strings.Index(pattern, "{"+key+":"); start >= 0 {
+			// a parameter with a regular expression, such as {id:[0-9]+}
+			end := strings.Index(pattern[start:], "}")
+			placeholder = pattern[start : start+end+1]
+		}
+
+		if strings.Contains(pattern, placeholder) {
+			pattern = strings.Replace(pattern, placeholder, url.PathEscape(value), 1)
+		} else {
+			query.Add(key, value)
+		}
+	}
+
+	if strings.Contains(pattern, "{") {
+		return "", fmt.Errorf("route %s: missing parameters in %s", name, pattern)
+	}
+
+	if len(query) > 0 {
+		pattern += "?" + query.Encode()
+	}
+
+	return pattern, nil
+}
+
+func (c *Render) routeURL(name string, params ...interface{}) (string, error) {
+	return c.URL(name, params...)
+}
+
+// Asset returns the url of the file at path in the public folder. Outside debug mode,
+// the url of its fingerprinted copy is returned, if assets have been built. Otherwise a
+// hash of its contents is added, so that browsers fetch it again when it changes; hashes
+// are computed once, or on every call in debug mode.
+func (c *Render) Asset(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	assetURL := "/public/" + path
+
+	if !c.Debug {
+		if fingerprinted, ok := c.Assets[path]; ok {
+			return "/public/" + fingerprinted
+		}
+
+		if hash, ok := c.assetHashes.Load(path); ok {
+			return assetURL + "?v=" + hash.(string)
+		}
+	}
+
+	contents, err := os.ReadFile(filepath.Join(c.RootPath, "public", filepath.FromSlash(path)))
+	if err != nil {
+		return assetURL
+	}
+
+	sum := sha256.Sum256(contents)
+	hash := hex.EncodeToString(sum[:])[:8]
+	c.assetHashes.Store(path, hash)
+
+	return assetURL + "?v=" + hash
+}
+
+func (c *Render) signedURL(link string) string {
+	signer := urlsigner.Signer{Secret: []byte(c.SigningKey)}
+	return signer.GenerateTokenFromString(link)
+}
+
+// translators returns the t and tn template functions for locale, or for the default
+// locale if locale is empty
+func (c *Render) translators(locale string) (t func(string, ...interface{}) string, tn func(string, int, ...interface{}) string) {
+	t = func(key string, args ...interface{}) string {
+		if c.I18n == nil {
+			return key
+		}
+		return c.I18n.T(c.localeOrDefault(locale), key, args...)
+	}
+
+	tn = func(key string, count int, args ...interface{}) string {
+		if c.I18n == nil {
+			return key
+		}
+		return c.I18n.N(c.localeOrDefault(locale), key, count, args...)
+	}
+
+	return t, tn
+}
+
+// locale returns the locale of r, as detected by the i18n middleware
+func (c *Render) locale(r *http.Request) string {
+	return c.localeOrDefault(i18n.Locale(r.Context()))
+}
+
+func (c *Render) localeOrDefault(locale string) string {
+	if locale == "" && c.I18n != nil {
+		return c.I18n.DefaultLocale
+	}
+
+	return locale
+}
+
+// csrfField returns a hidden form field holding token, which nosurf checks on submission
+func csrfField(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="csrf_token" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+// jetCSRFField is csrfField for Jet, which escapes the template.HTML returned by
+// csrfField, but lets a RendererFunc write straight to the output
+func jetCSRFField(token string) jet.RendererFunc {
+	return func(r *jet.Runtime) {
+		_, _ = io.WriteString(r.Writer, string(csrfField(token)))
+	}
+}
+
+// formatDate formats t with layout, or as 2006-01-02 if layout is empty. Zero times are
+// formatted as an empty string.
+func formatDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+
+	return t.Format(layout)
+}
+
+// formatNumber formats n, which may be any integer or float, with commas between
+// thousands and decimals digits after the point
+func formatNumber(n interface{}, decimals int) string {
+	var f float64
+	switch v := n.(type) {
+	case int:
+		f = float64(v)
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case uint:
+		f = float64(v)
+	case uint32:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	case float32:
+		f = float64(v)
+	case float64:
+		f = v
+	default:
+		return fmt.Sprint(n)
+	}
+
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i:]
+	}
+
+	var b strings.Builder
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	b.WriteString(fraction)
+
+	return b.String()
+}
+
+// funcRegistry holds the state behind the template functions
+type funcRegistry struct {
+	funcsMu     sync.RWMutex
+	routes      map[string]string
+	assetHashes sync.Map
+}
@@ -0,0 +1,168 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/petrostrak/sokudo/i18n"
+)
+
+func TestRender_AddFunc(t *testing.T) {
+	rnd := &Render{
+		RootPath: "./testdata/funcs",
+		JetViews: jet.NewSet(jet.NewOSFileSystemLoader("./testdata/funcs/views"), jet.InDevelopmentMode()),
+		Session:  testSession,
+	}
+	rnd.AddDefaultFuncs()
+	rnd.AddFunc("upper", strings.ToUpper)
+	rnd.NameRoute("users.show", "/users/{id}")
+
+	expected := `SHOUT /users/7 1,234,567.89 <input type="hidden" name="csrf_token" value="">`
+
+	for _, renderer := range []string{"go", "jet"} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r = r.WithContext(getCtx(r))
+		w := httptest.NewRecorder()
+
+		rnd.Renderer = renderer
+		err := rnd.Page(w, r, "funcs", nil, nil)
+		if err != nil {
+			t.Error(renderer, err)
+			continue
+		}
+
+		if strings.TrimSpace(w.Body.String()) != expected {
+			t.Errorf("%s: expected %q, got %q", renderer, expected, w.Body.String())
+		}
+	}
+}
+
+func TestRender_URL(t *testing.T) {
+	rnd := &Render{}
+	rnd.NameRoute("posts.show", "/posts/{year:[0-9]+}/{slug}")
+
+	u, err := rnd.URL("posts.show", "year", 2022, "slug", "hello world", "page", 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if u != "/posts/2022/hello%20world?page=2" {
+		t.Error("wrong url:", u)
+	}
+
+	_, err = rnd.URL("posts.show", "year", 2022)
+	if err == nil {
+		t.Error("no error for a missing parameter")
+	}
+
+	_, err = rnd.URL("nope")
+	if err == nil {
+		t.Error("no error for an unknown route")
+	}
+}
+
+func TestRender_Asset(t *testing.T) {
+	rnd := &Render{RootPath: "./testdata"}
+
+	if u := rnd.Asset("css/app.css"); !strings.HasPrefix(u, "/public/css/app.css?v=") || len(u) != len("/public/css/app.css?v=")+8 {
+		t.Error("wrong asset url:", u)
+	}
+
+	if u := rnd.Asset("/missing.js"); u != "/public/missing.js" {
+		t.Error("wrong url for a missing asset:", u)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		n        interface{}
+		decimals int
+		expected string
+	}{
+		{0, 0, "0"},
+		{999, 0, "999"},
+		{1000, 0, "1,000"},
+		{-1234567, 0, "-1,234,567"},
+		{1234.5, 2, "1,234.50"},
+		{-0.001, 2, "0.00"},
+		{"foo", 2, "foo"},
+	}
+
+	for _, test := range tests {
+		if got := formatNumber(test.n, test.decimals); got != test.expected {
+			t.Errorf("formatNumber(%v, %d): expected %s, got %s", test.n, test.decimals, test.expected, got)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	d := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	if got := formatDate(d, ""); got != "2022-03-04" {
+		t.Error("wrong default format:", got)
+	}
+
+	if got := formatDate(d, "02/01/2006 15:04"); got != "04/03/2022 05:06" {
+		t.Error("wrong format:", got)
+	}
+
+	if got := formatDate(time.Time{}, ""); got != "" {
+		t.Error("zero time was formatted:", got)
+	}
+}
+
+func TestRender_AssetManifest(t *testing.T) {
+	rnd := &Render{RootPath: "./testdata", Assets: map[string]string{"css/app.css": "build/css/app.3f9a1c.css"}}
+
+	if u := rnd.Asset("css/app.css"); u != "/public/build/css/app.3f9a1c.css" {
+		t.Error("asset was not resolved through the manifest:", u)
+	}
+
+	rnd.Debug = true
+	if u := rnd.Asset("css/app.css"); !strings.HasPrefix(u, "/public/css/app.css?v=") {
+		t.Error("manifest was used in debug mode:", u)
+	}
+}
+
+func TestRender_Translate(t *testing.T) {
+	bundle := i18n.New("en")
+	bundle.Add("en", map[string]i18n.Message{
+		"title": {"other": "Items"},
+		"items": {"one": "%d item", "other": "%d items"},
+	})
+	bundle.Add("el", map[string]i18n.Message{
+		"title": {"other": "Αντικείμενα"},
+		"items": {"one": "%d αντικείμενο", "other": "%d αντικείμενα"},
+	})
+
+	rnd := &Render{
+		RootPath: "./testdata/i18n",
+		JetViews: jet.NewSet(jet.NewOSFileSystemLoader("./testdata/i18n/views"), jet.InDevelopmentMode()),
+		Session:  testSession,
+		I18n:     bundle,
+	}
+	rnd.AddDefaultFuncs()
+
+	for _, renderer := range []string{"go", "jet"} {
+		rnd.Renderer = renderer
+
+		for locale, expected := range map[string]string{"": "Items 3 items", "el": "Αντικείμενα 3 αντικείμενα"} {
+			r, _ := http.NewRequest("GET", "/", nil)
+			r = r.WithContext(i18n.WithLocale(getCtx(r), locale))
+			w := httptest.NewRecorder()
+
+			err := rnd.Page(w, r, "i18n", nil, nil)
+			if err != nil {
+				t.Error(renderer, err)
+				continue
+			}
+
+			if strings.TrimSpace(w.Body.String()) != expected {
+				t.Errorf("%s %q: expected %q, got %q", renderer, locale, expected, w.Body.String())
+			}
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/CloudyKit/jet/v6"
 	"github.com/alexedwards/scs/v2"
 	"github.com/justinas/nosurf"
+	"github.com/petrostrak/sokudo/cache"
+	"github.com/petrostrak/sokudo/i18n"
 )
 
 type Render struct {
@@ -21,6 +23,22 @@ type Render struct {
 	ServerName string
 	JetViews   *jet.Set
 	Session    *scs.SessionManager
+	// Debug rebuilds the Go template cache whenever a template changes
+	Debug bool
+	// Funcs are the functions available to Go templates; add to them with AddFunc, so
+	// that Jet templates get them too
+	Funcs template.FuncMap
+	// SigningKey signs the urls made by the signed_url template function
+	SigningKey string
+	// Assets maps the files in public to their fingerprinted copies, for the asset
+	// template function
+	Assets map[string]string
+	// I18n looks up the translations for the t and tn template functions, in the locale
+	// of each request
+	I18n *i18n.Bundle
+
+	cache templateCache
+	funcRegistry
 }
 
 type TemplateData struct {
@@ -35,13 +53,26 @@ type TemplateData struct {
 	Secure          bool
 	Error           string
 	Flash           string
+	Locale          string
 }
 
 func (c *Render) defaultData(td *TemplateData, r *http.Request) *TemplateData {
 	td.Secure = c.Secure
 	td.ServerName = c.ServerName
-	td.CSRFToken = nosurf.Token(r)
 	td.Port = c.Port
+	if td.Locale == "" {
+		td.Locale = c.locale(r)
+	}
+	// a page stored in a response cache is served to everyone, so it gets nothing of the
+	// user's, and the flash messages stay in the session for the next page
+	if cache.IsShared(r.Context()) {
+		return td
+	}
+	td.CSRFToken = nosurf.Token(r)
+	if c.Session == nil {
+		return td
+	}
+
 	if c.Session.Exists(r.Context(), "userID") {
 		td.IsAuthenticated = true
 	}
@@ -50,21 +81,24 @@ func (c *Render) defaultData(td *TemplateData, r *http.Request) *TemplateData {
 	return td
 }
 
+// Page renders view with the configured renderer. Errors from parsing or rendering the
+// view are returned as a *TemplateError.
 func (c *Render) Page(w http.ResponseWriter, r *http.Request, view string, variables, data interface{}) error {
 	switch strings.ToLower(c.Renderer) {
 	case "go":
-		return c.GoPage(w, r, view, data)
+		return c.templateError(view, "go", c.GoPage(w, r, view, data))
 	case "jet":
-		return c.JetPage(w, r, view, variables, data)
+		return c.templateError(view, "jet", c.JetPage(w, r, view, variables, data))
 	default:
 
 	}
 	return errors.New("no rendering engine specified")
 }
 
-// GoPage renders a standard Go template
+// GoPage renders a standard Go template, from the template cache, together with the
+// layouts and partials in the views folder
 func (c *Render) GoPage(w http.ResponseWriter, r *http.Request, view string, data interface{}) error {
-	tmpl, err := template.ParseFiles(fmt.Sprintf("%s/views/%s.page.tmpl", c.RootPath, view))
+	tmpl, err := c.goTemplate(view, c.locale(r))
 	if err != nil {
 		return err
 	}
@@ -74,7 +108,9 @@ func (c *Render) GoPage(w http.ResponseWriter, r *http.Request, view string, dat
 		td = data.(*TemplateData)
 	}
 
-	err = tmpl.Execute(w, &td)
+	td = c.defaultData(td, r)
+
+	err = tmpl.Execute(w, td)
 	if err != nil {
 		return err
 	}
@@ -99,6 +135,24 @@ func (c *Render) JetPage(w http.ResponseWriter, r *http.Request, templateName st
 
 	td = c.defaultData(td, r)
 
+	// the translation functions of the request's locale override the global ones; vars
+	// is copied, as callers may share it between requests
+	if c.I18n != nil {
+		localized := make(jet.VarMap, len(vars)+2)
+		for name, value := range vars {
+			localized[name] = value
+		}
+
+		t, tn := c.translators(td.Locale)
+		if _, ok := vars["t"]; !ok {
+			localized.Set("t", t)
+		}
+		if _, ok := vars["tn"]; !ok {
+			localized.Set("tn", tn)
+		}
+		vars = localized
+	}
+
 	t, err := c.JetViews.GetTemplate(fmt.Sprintf("%s.jet", templateName))
 	if err != nil {
 		log.Println(err)
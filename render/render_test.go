@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/petrostrak/sokudo/cache"
 )
 
 var (
@@ -29,6 +31,7 @@ func TestRender_Page(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
+		r = r.WithContext(getCtx(r))
 
 		w := httptest.NewRecorder()
 
@@ -54,6 +57,7 @@ func TestRender_GoPage(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	r = r.WithContext(getCtx(r))
 
 	testRenderer.Renderer = "go"
 	testRenderer.RootPath = "./testdata"
@@ -70,6 +74,7 @@ func TestRender_JetPage(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	r = r.WithContext(getCtx(r))
 
 	testRenderer.Renderer = "jet"
 
@@ -78,3 +83,25 @@ func TestRender_JetPage(t *testing.T) {
 		t.Error("error rendering page", err)
 	}
 }
+
+func TestRender_DefaultDataShared(t *testing.T) {
+	var td *TemplateData
+	handler := cache.NewResponseCache(cache.NewMemoryCache(100, 0), 60).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		td = testRenderer.defaultData(&TemplateData{}, r)
+	}))
+
+	r := httptest.NewRequest("GET", "/shared", nil)
+	r = r.WithContext(getCtx(r))
+	testSession.Put(r.Context(), "flash", "saved")
+
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if td.Flash != "" || td.CSRFToken != "" {
+		t.Errorf("expected no per-user data in a shared page, got flash %q and token %q", td.Flash, td.CSRFToken)
+	}
+
+	// the flash message waits for a page of the user's own
+	td = testRenderer.defaultData(&TemplateData{}, r)
+	if td.Flash != "saved" {
+		t.Errorf("expected the flash message to be kept, got %q", td.Flash)
+	}
+}
@@ -1,10 +1,13 @@
 package render
 
 import (
+	"context"
+	"net/http"
 	"os"
 	"testing"
 
 	"github.com/CloudyKit/jet/v6"
+	"github.com/alexedwards/scs/v2"
 )
 
 var (
@@ -13,13 +16,26 @@ var (
 		jet.InDevelopmentMode(),
 	)
 
+	testSession = scs.New()
+
 	testRenderer = Render{
 		Renderer: "",
 		RootPath: "",
 		JetViews: views,
+		Session:  testSession,
 	}
 )
 
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
+
+// getCtx returns the context of r with a session loaded into it
+func getCtx(r *http.Request) context.Context {
+	ctx, err := testSession.Load(r.Context(), "")
+	if err != nil {
+		panic(err)
+	}
+
+	return ctx
+}
@@ -0,0 +1,205 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// templateCache holds the compiled Go templates of every page, by view name
+type templateCache struct {
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+	files     int
+	builtAt   time.Time
+	// localized holds copies of templates with the translation functions of a locale, by
+	// locale and view name. An html/template cannot be copied once it has run, so the
+	// templates themselves are never run when I18n is set.
+	localized map[string]map[string]*template.Template
+}
+
+// BuildTemplateCache compiles every views/*.page.tmpl file, together with every
+// views/*.layout.tmpl and views/*.partial.tmpl file and the functions in Funcs, so that
+// GoPage does not parse templates on every request. Pages, layouts and partials may be in
+// sub folders of views; a page in views/users/show.page.tmpl is the view "users/show".
+func (c *Render) BuildTemplateCache() error {
+	builtAt := time.Now()
+
+	files, err := c.templateFiles()
+	if err != nil {
+		return err
+	}
+
+	templates, err := c.compileTemplates(files)
+	if err != nil {
+		return err
+	}
+
+	c.cache.mu.Lock()
+	c.cache.templates = templates
+	c.cache.localized = nil
+	c.cache.files = len(files)
+	c.cache.builtAt = builtAt
+	c.cache.mu.Unlock()
+
+	return nil
+}
+
+// compileTemplates parses every page in files with the layouts and partials in files
+func (c *Render) compileTemplates(files []string) (map[string]*template.Template, error) {
+	var shared []string
+	for _, file := range files {
+		if strings.HasSuffix(file, ".layout.tmpl") || strings.HasSuffix(file, ".partial.tmpl") {
+			shared = append(shared, file)
+		}
+	}
+
+	viewsPath := filepath.Join(c.RootPath, "views")
+	templates := make(map[string]*template.Template)
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".page.tmpl") {
+			continue
+		}
+
+		// the page is parsed last, so that its definitions override the blocks of layouts
+		tmpl, err := template.New(filepath.Base(file)).Funcs(c.funcMap()).ParseFiles(append(shared, file)...)
+		if err != nil {
+			return nil, err
+		}
+
+		rel, err := filepath.Rel(viewsPath, file)
+		if err != nil {
+			return nil, err
+		}
+		templates[filepath.ToSlash(strings.TrimSuffix(rel, ".page.tmpl"))] = tmpl
+	}
+
+	return templates, nil
+}
+
+// templateFiles returns every Go template file in the views folder and its sub folders
+func (c *Render) templateFiles() ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(filepath.Join(c.RootPath, "views"), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && strings.HasSuffix(path, ".tmpl") {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return files, err
+}
+
+// goTemplate returns the compiled template for view, with the translation functions of
+// locale. The cache is built on first use, and in debug mode it is rebuilt whenever a
+// template file has changed since it was built.
+func (c *Render) goTemplate(view, locale string) (*template.Template, error) {
+	c.cache.mu.RLock()
+	templates, builtAt := c.cache.templates, c.cache.builtAt
+	c.cache.mu.RUnlock()
+
+	if templates == nil || (c.Debug && c.templatesChangedSince(builtAt)) {
+		if err := c.BuildTemplateCache(); err != nil {
+			return nil, err
+		}
+
+		c.cache.mu.RLock()
+		templates = c.cache.templates
+		c.cache.mu.RUnlock()
+	}
+
+	tmpl, ok := templates[view]
+	if !ok {
+		return nil, fmt.Errorf("template %s.page.tmpl not found", view)
+	}
+
+	if c.I18n == nil {
+		return tmpl, nil
+	}
+
+	return c.localizedTemplate(tmpl, view, locale)
+}
+
+// localizedTemplate returns a copy of tmpl, the template for view, whose t and tn
+// functions translate into locale
+func (c *Render) localizedTemplate(tmpl *template.Template, view, locale string) (*template.Template, error) {
+	c.cache.mu.RLock()
+	localized, ok := c.cache.localized[locale][view]
+	c.cache.mu.RUnlock()
+	if ok {
+		return localized, nil
+	}
+
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+
+	if localized, ok := c.cache.localized[locale][view]; ok {
+		return localized, nil
+	}
+
+	localized, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t, tn := c.translators(locale)
+	localized.Funcs(template.FuncMap{"t": t, "tn": tn})
+
+	if c.cache.localized == nil {
+		c.cache.localized = make(map[string]map[string]*template.Template)
+	}
+	if c.cache.localized[locale] == nil {
+		c.cache.localized[locale] = make(map[string]*template.Template)
+	}
+	c.cache.localized[locale][view] = localized
+
+	return localized, nil
+}
+
+// templatesChangedSince reports whether any template file has been added, removed or
+// modified since t
+func (c *Render) templatesChangedSince(t time.Time) bool {
+	files, err := c.templateFiles()
+	if err != nil {
+		return true
+	}
+
+	c.cache.mu.RLock()
+	cached := c.cache.files
+	c.cache.mu.RUnlock()
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || info.ModTime().After(t) {
+			return true
+		}
+	}
+
+	// a removed file leaves no newer file behind
+	return len(files) != cached
+}
+
+// funcMap returns the functions available to Go templates
+func (c *Render) funcMap() template.FuncMap {
+	c.funcsMu.RLock()
+	defer c.funcsMu.RUnlock()
+
+	funcs := template.FuncMap{}
+	for name, fn := range c.Funcs {
+		funcs[name] = fn
+	}
+
+	return funcs
+}
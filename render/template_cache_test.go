@@ -0,0 +1,89 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender_GoPageLayout(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/users/1", nil)
+	ctx := getCtx(r)
+	r = r.WithContext(ctx)
+	testSession.Put(ctx, "flash", "Saved")
+
+	w := httptest.NewRecorder()
+
+	rnd := &Render{RootPath: "./testdata", Session: testSession}
+	err := rnd.GoPage(w, r, "users/show", &TemplateData{StringMap: map[string]string{"name": "Petros"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "<html><title>User</title><body><p>Petros</p><footer>Saved</footer></body></html>"
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("expected %q in %q", expected, w.Body.String())
+	}
+}
+
+func TestRender_BuildTemplateCache(t *testing.T) {
+	rnd := &Render{RootPath: "./testdata"}
+
+	err := rnd.BuildTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, view := range []string{"home", "users/show"} {
+		if _, ok := rnd.cache.templates[view]; !ok {
+			t.Error("view not in the template cache:", view)
+		}
+	}
+
+	if _, ok := rnd.cache.templates["base"]; ok {
+		t.Error("layout was cached as a page")
+	}
+}
+
+func TestRender_GoPageRebuildsInDebug(t *testing.T) {
+	root := t.TempDir()
+	_ = os.Mkdir(filepath.Join(root, "views"), 0755)
+	page := filepath.Join(root, "views", "home.page.tmpl")
+	_ = os.WriteFile(page, []byte("first"), 0644)
+
+	rnd := &Render{RootPath: root, Debug: true}
+
+	render := func() string {
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		if err := rnd.GoPage(w, r, "home", nil); err != nil {
+			t.Fatal(err)
+		}
+		return w.Body.String()
+	}
+
+	if body := render(); body != "first" {
+		t.Error("wrong page rendered:", body)
+	}
+
+	_ = os.WriteFile(page, []byte("second"), 0644)
+	later := time.Now().Add(time.Second)
+	_ = os.Chtimes(page, later, later)
+
+	if body := render(); body != "second" {
+		t.Error("changed template was not rebuilt in debug mode:", body)
+	}
+
+	rnd.Debug = false
+	_ = os.WriteFile(page, []byte("third"), 0644)
+	later = later.Add(time.Second)
+	_ = os.Chtimes(page, later, later)
+
+	if body := render(); body != "second" {
+		t.Error("template was rebuilt outside debug mode:", body)
+	}
+}
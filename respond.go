@@ -0,0 +1,231 @@
+package sokudo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/petrostrak/sokudo/render"
+)
+
+// formats are the formats Respond can send, in order of preference when the client
+// accepts any of them, by their ?format= name
+var formats = []struct {
+	name      string
+	mediaType string
+}{
+	{"html", "text/html"},
+	{"json", "application/json"},
+	{"xml", "application/xml"},
+	{"csv", "text/csv"},
+}
+
+// Respond sends data in the format the client asks for, in the Accept header or with a
+// ?format= query parameter: html, rendered with view through the configured renderer,
+// json, xml, or csv. HTML is only available when view is not empty, xml when data is not
+// a map, and csv when data is a [][]string or a slice of structs. If none of the formats
+// the client accepts is available, the response is 406 Not Acceptable.
+//
+// For HTML, data is passed to the view as is when it is a *render.TemplateData, and
+// otherwise as .Data.data in Go templates, and as the variable data in Jet templates.
+func (s *Sokudo) Respond(w http.ResponseWriter, r *http.Request, status int, data interface{}, view string) error {
+	available := make(map[string]bool)
+	available["html"] = view != ""
+	available["json"] = true
+	available["xml"] = data != nil && reflect.Indirect(reflect.ValueOf(data)).Kind() != reflect.Map
+	_, available["csv"] = csvRecords(data)
+
+	format := negotiateFormat(r, available)
+	w.Header().Add("Vary", "Accept")
+
+	switch format {
+	case "html":
+		return s.respondHTML(w, r, status, data, view)
+	case "json":
+		return s.WriteJSON(w, status, data)
+	case "xml":
+		return s.WriteXML(w, status, data)
+	case "csv":
+		records, _ := csvRecords(data)
+		return writeCSV(w, status, records)
+	default:
+		s.ErrorPage(w, r, http.StatusNotAcceptable, nil)
+		return nil
+	}
+}
+
+// respondHTML renders view, and only sends it with status once it has rendered, so that a
+// template error can still be answered with an error status
+func (s *Sokudo) respondHTML(w http.ResponseWriter, r *http.Request, status int, data interface{}, view string) error {
+	td, ok := data.(*render.TemplateData)
+	if !ok {
+		td = &render.TemplateData{Data: map[string]interface{}{"data": data}}
+	}
+
+	vars := make(jet.VarMap)
+	vars.Set("data", data)
+
+	buf := &bufferedResponse{header: w.Header()}
+	err := s.Render.Page(buf, r, view, vars, td)
+	if err != nil {
+		return err
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.WriteHeader(status)
+	_, err = w.Write(buf.body.Bytes())
+	return err
+}
+
+// negotiateFormat returns the available format the client prefers, or an empty string if
+// it accepts none of them. Each format gets the quality of the most specific media range
+// in the Accept header that matches it; ties go to the earlier format in formats.
+func negotiateFormat(r *http.Request, available map[string]bool) string {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		if available[format] {
+			return format
+		}
+		return ""
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	best, bestQ := "", 0.0
+	for _, f := range formats {
+		if !available[f.name] {
+			continue
+		}
+
+		if q := acceptQuality(accept, f.mediaType); q > bestQ {
+			best, bestQ = f.name, q
+		}
+	}
+
+	return best
+}
+
+// acceptQuality returns the quality an Accept header gives mediaType, from the most
+// specific media range that matches it, or 0 if none does
+func acceptQuality(accept, mediaType string) float64 {
+	mainType := strings.SplitN(mediaType, "/", 2)[0]
+
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		accepted := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		s := -1
+		switch accepted {
+		case mediaType:
+			s = 2
+		case mainType + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+	}
+
+	return q
+}
+
+// csvRecords returns data as csv records, if it is a [][]string or a slice of structs,
+// whose exported fields become the columns, named by their csv tags or field names
+func csvRecords(data interface{}) ([][]string, bool) {
+	if records, ok := data.([][]string); ok {
+		return records, true
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	elemType := v.Type().Elem()
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	var header []string
+	var fields []int
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		name := field.Tag.Get("csv")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	records := [][]string{header}
+	for i := 0; i < v.Len(); i++ {
+		elem := reflect.Indirect(v.Index(i))
+		record := make([]string, len(fields))
+		if elem.IsValid() {
+			for j, field := range fields {
+				record[j] = fmt.Sprint(elem.Field(field).Interface())
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, true
+}
+
+func writeCSV(w http.ResponseWriter, status int, records [][]string) error {
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(records); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// bufferedResponse collects a rendered page, so that its status can be chosen after it
+// has rendered
+type bufferedResponse struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(int) {}
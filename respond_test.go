@@ -0,0 +1,114 @@
+package sokudo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/petrostrak/sokudo/render"
+)
+
+type testProduct struct {
+	Name  string  `csv:"name" json:"name"`
+	Price float64 `csv:"price" json:"price"`
+	notes string
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	all := map[string]bool{"html": true, "json": true, "xml": true, "csv": true}
+	noHTML := map[string]bool{"json": true, "xml": true}
+
+	tests := []struct {
+		name      string
+		url       string
+		accept    string
+		available map[string]bool
+		expected  string
+	}{
+		{"browser", "/", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", all, "html"},
+		{"api client", "/", "application/json", all, "json"},
+		{"no accept header", "/", "", all, "html"},
+		{"no accept header without view", "/", "", noHTML, "json"},
+		{"anything", "/", "*/*", noHTML, "json"},
+		{"quality", "/", "application/json;q=0.5, application/xml", all, "xml"},
+		{"wildcard refused", "/", "text/*;q=0, */*", all, "json"},
+		{"specific range wins", "/", "text/*, text/html;q=0", all, "csv"},
+		{"format override", "/?format=csv", "application/json", all, "csv"},
+		{"unavailable override", "/?format=html", "", noHTML, ""},
+		{"not acceptable", "/", "image/png", all, ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.url, nil)
+		r.Header.Set("Accept", test.accept)
+
+		if got := negotiateFormat(r, test.available); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestSokudo_Respond(t *testing.T) {
+	s := &Sokudo{}
+	products := []testProduct{{"Tea", 2.5, ""}, {"Coffee", 3, ""}}
+
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"application/json", http.StatusOK, "application/json", `"name": "Tea"`},
+		{"application/xml", http.StatusOK, "application/xml", "<Name>Tea</Name>"},
+		{"text/csv", http.StatusOK, "text/csv", "name,price\nTea,2.5\nCoffee,3\n"},
+		{"text/html", http.StatusNotAcceptable, "text/plain", "Not Acceptable"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/products", nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+
+		err := s.Respond(w, r, http.StatusOK, products, "")
+		if err != nil {
+			t.Error(test.accept, err)
+		}
+
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.accept, test.status, w.Code)
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), test.contentType) {
+			t.Errorf("%s: wrong Content-Type %q", test.accept, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s: expected %q in %q", test.accept, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestSokudo_RespondHTML(t *testing.T) {
+	s := &Sokudo{Render: &render.Render{Renderer: "go", RootPath: "./render/testdata"}}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+
+	err := s.Respond(w, r, http.StatusCreated, nil, "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), "Hello world") {
+		t.Error("page was not rendered:", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	err = s.Respond(w, r, http.StatusOK, nil, "missing")
+	if err == nil {
+		t.Error("no error rendering a missing view")
+	}
+	if w.Body.Len() != 0 {
+		t.Error("response was written for a view that failed to render")
+	}
+}
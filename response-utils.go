@@ -84,25 +84,26 @@ func (s *Sokudo) DownloadFile(w http.ResponseWriter, r *http.Request, pathToFile
 
 // Error404 returns page not found response
 func (s *Sokudo) Error404(w http.ResponseWriter, r *http.Request) {
-	s.ErrorStatus(w, http.StatusNotFound)
+	s.ErrorPage(w, r, http.StatusNotFound, nil)
 }
 
 // Error500 returns internal server error response
 func (s *Sokudo) Error500(w http.ResponseWriter, r *http.Request) {
-	s.ErrorStatus(w, http.StatusInternalServerError)
+	s.ErrorPage(w, r, http.StatusInternalServerError, nil)
 }
 
 // ErrorUnauthorized sends an unauthorized status (client is not known)
 func (s *Sokudo) ErrorUnauthorized(w http.ResponseWriter, r *http.Request) {
-	s.ErrorStatus(w, http.StatusUnauthorized)
+	s.ErrorPage(w, r, http.StatusUnauthorized, nil)
 }
 
 // ErrorForbidden returns a forbidden status message (client is known)
 func (s *Sokudo) ErrorForbidden(w http.ResponseWriter, r *http.Request) {
-	s.ErrorStatus(w, http.StatusForbidden)
+	s.ErrorPage(w, r, http.StatusForbidden, nil)
 }
 
-// ErrorStatus returns a response with the supplied http status
+// ErrorStatus returns a plain text response with the supplied http status; use ErrorPage
+// to render the error page for the status instead
 func (s *Sokudo) ErrorStatus(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/petrostrak/sokudo/assets"
 )
 
 func (s *Sokudo) routes() http.Handler {
@@ -14,10 +15,13 @@ func (s *Sokudo) routes() http.Handler {
 	if s.Debug {
 		mux.Use(middleware.Logger)
 	}
-	mux.Use(middleware.Recoverer)
+	mux.Use(s.RecoverPanic)
 	mux.Use(s.SessionLoad)
+	mux.Use(s.DetectLocale)
 	mux.Use(s.NoSurf)
 	mux.Use(s.CheckForMaintenanceMode)
 
+	mux.Handle("/public/*", http.StripPrefix("/public", assets.FileServer(s.RootPath+"/public")))
+
 	return mux
 }
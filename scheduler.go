@@ -0,0 +1,33 @@
+package sokudo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/petrostrak/sokudo/cache"
+	"github.com/robfig/cron/v3"
+)
+
+// AddExclusiveFunc adds a job to the scheduler which runs on only one instance of the
+// application at a time. Every instance schedules the job, and at each run the first to
+// take the lock named name runs it, while the others skip that run. The lock is kept for
+// ttl, which should be longer than the job takes and shorter than the interval between
+// runs, so that instances whose clocks differ slightly do not run the job twice.
+func (s *Sokudo) AddExclusiveFunc(spec, name string, ttl time.Duration, cmd func()) (cron.EntryID, error) {
+	if s.Locker == nil {
+		return 0, errors.New("exclusive jobs need a cache; set CACHE in .env")
+	}
+
+	return s.Scheduler.AddFunc(spec, func() {
+		_, err := s.Locker.Acquire("cron:"+name, ttl)
+		if err == cache.ErrLocked {
+			return
+		}
+		if err != nil {
+			s.ErrorLog.Println("scheduler:", name, err)
+			return
+		}
+
+		cmd()
+	})
+}
@@ -26,6 +26,10 @@ func (s *Sokudo) ListenAndServe() error {
 		defer redisPool.Close()
 	}
 
+	if redisCluster != nil {
+		defer redisCluster.Close()
+	}
+
 	if badgerConn != nil {
 		defer badgerConn.Close()
 	}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// BadgerStore is a session store which keeps sessions in a badger database. Sessions
+// expire using badger's own expiry, so they need no cleanup.
+type BadgerStore struct {
+	db     *badger.DB
+	prefix string
+}
+
+// NewBadgerStore returns a session store which keeps sessions in db
+func NewBadgerStore(db *badger.DB) *BadgerStore {
+	return &BadgerStore{
+		db:     db,
+		prefix: "scs:session:",
+	}
+}
+
+// Find returns the data for a session token. If the session does not exist or has
+// expired, exists is false.
+func (b *BadgerStore) Find(token string) ([]byte, bool, error) {
+	var data []byte
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(b.prefix + token))
+		if err != nil {
+			return err
+		}
+
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+// Commit stores the data for a session token, until expiry
+func (b *BadgerStore) Commit(token string, data []byte, expiry time.Time) error {
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		return b.Delete(token)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(b.prefix+token), data).WithTTL(ttl))
+	})
+}
+
+// Delete removes a session token
+func (b *BadgerStore) Delete(token string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(b.prefix + token))
+	})
+}
+
+// All returns every session that has not expired
+func (b *BadgerStore) All() (map[string][]byte, error) {
+	sessions := make(map[string][]byte)
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(b.prefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			data, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			sessions[string(item.Key()[len(prefix):])] = data
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,72 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestBadgerStore(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewBadgerStore(db)
+
+	err = store.Commit("token", []byte("data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Error(err)
+	}
+
+	b, exists, err := store.Find("token")
+	if err != nil || !exists || string(b) != "data" {
+		t.Error("did not find committed session:", string(b), exists, err)
+	}
+
+	err = store.Delete("token")
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, exists, _ = store.Find("token")
+	if exists {
+		t.Error("session found after it was deleted")
+	}
+
+	err = store.Commit("expired", []byte("data"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, exists, _ = store.Find("expired")
+	if exists {
+		t.Error("expired session was stored")
+	}
+}
+
+func TestBadgerStore_All(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewBadgerStore(db)
+	_ = store.Commit("one", []byte("1"), time.Now().Add(time.Minute))
+	_ = store.Commit("two", []byte("2"), time.Now().Add(time.Minute))
+	_ = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("not-a-session"), []byte("3"))
+	})
+
+	sessions, err := store.All()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(sessions) != 2 || string(sessions["one"]) != "1" || string(sessions["two"]) != "2" {
+		t.Error("wrong sessions returned:", sessions)
+	}
+}
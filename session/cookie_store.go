@@ -0,0 +1,411 @@
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// chunkSize is the largest value written to a single cookie. Browsers allow about 4096
+// bytes for the name, value and attributes of each cookie.
+const chunkSize = 3800
+
+var (
+	// ErrCookieTooLarge is returned when a session does not fit in the session cookies
+	ErrCookieTooLarge = errors.New("session is too large to be stored in cookies")
+	// ErrNoCookieKeys is returned when a cookie store has no keys to encrypt sessions with
+	ErrNoCookieKeys = errors.New("cookie session store needs at least one key")
+)
+
+// CookieStore is a session store which keeps the whole session in the session cookie,
+// so that the application needs no server side storage for sessions. Sessions are
+// encrypted with AES-GCM and authenticated with HMAC-SHA256, using keys derived from
+// the application KEY. Large sessions are split across several cookies.
+//
+// Because the session lives in the browser, a session cannot be revoked on the server,
+// and sessions cannot be listed. Its LoadAndSave must be used instead of the one of the
+// session manager; the LoadAndSave function of this package picks the right one.
+type CookieStore struct {
+	keys []cookieKey
+	// MaxChunks is the greatest number of cookies a session is split across
+	MaxChunks int
+
+	mu      sync.Mutex
+	pending map[string]pendingSession
+}
+
+// cookieKey is the pair of keys derived from one application key
+type cookieKey struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// pendingSession is a session being loaded from, or written to, the cookies of a request
+type pendingSession struct {
+	data   []byte
+	expiry time.Time
+}
+
+// NewCookieStore returns a session store which keeps sessions in cookies. Sessions are
+// encrypted with the first of keys; the others are previous keys, which are still
+// accepted so that sessions survive a change of key.
+func NewCookieStore(keys ...string) (*CookieStore, error) {
+	c := &CookieStore{
+		MaxChunks: 5,
+		pending:   make(map[string]pendingSession),
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		block, err := aes.NewCipher(deriveKey(key, "encryption"))
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		c.keys = append(c.keys, cookieKey{aead: aead, macKey: deriveKey(key, "authentication")})
+	}
+
+	if len(c.keys) == 0 {
+		return nil, ErrNoCookieKeys
+	}
+
+	return c, nil
+}
+
+// deriveKey returns a 32 byte key for purpose, so that the same application key is never
+// used for both encryption and authentication
+func deriveKey(key, purpose string) []byte {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte("sokudo session " + purpose))
+	return h.Sum(nil)
+}
+
+// Find returns the session loaded from the cookies of the current request
+func (c *CookieStore) Find(token string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, found := c.pending[token]
+	if !found || !time.Now().Before(p.expiry) {
+		return nil, false, nil
+	}
+
+	return p.data, true, nil
+}
+
+// Commit keeps the session of the current request until it is written to cookies
+func (c *CookieStore) Commit(token string, data []byte, expiry time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending[token] = pendingSession{data: data, expiry: expiry}
+
+	return nil
+}
+
+// Delete forgets the session of the current request
+func (c *CookieStore) Delete(token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, token)
+
+	return nil
+}
+
+// take removes and returns the session with token
+func (c *CookieStore) take(token string) (pendingSession, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, found := c.pending[token]
+	delete(c.pending, token)
+
+	return p, found
+}
+
+// LoadAndSave is middleware which loads the session of sm from the session cookies of the
+// request, and writes it back to them when it changes
+func (c *CookieStore) LoadAndSave(sm *scs.SessionManager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunks := c.readChunks(r, sm.Cookie.Name)
+
+		// the session is handed to the session manager under a token which only lives
+		// for this request
+		token := ""
+		if p, ok := c.open(strings.Join(chunks, "")); ok {
+			token = randomToken()
+			_ = c.Commit(token, p.data, p.expiry)
+			defer c.take(token)
+		}
+
+		ctx, err := sm.Load(r.Context(), token)
+		if err != nil {
+			sm.ErrorFunc(w, r, err)
+			return
+		}
+
+		sr := r.WithContext(ctx)
+		if isStream(r) {
+			next.ServeHTTP(w, sr)
+			return
+		}
+
+		bw := &bufferedWriter{ResponseWriter: w}
+		next.ServeHTTP(bw, sr)
+
+		switch sm.Status(ctx) {
+		case scs.Modified:
+			newToken, expiry, err := sm.Commit(ctx)
+			if err != nil {
+				sm.ErrorFunc(w, r, err)
+				return
+			}
+
+			p, _ := c.take(newToken)
+			value, err := c.seal(p.data, expiry)
+			if err != nil {
+				sm.ErrorFunc(w, r, err)
+				return
+			}
+
+			err = c.writeChunks(ctx, w, sm, value, len(chunks), expiry)
+			if err != nil {
+				sm.ErrorFunc(w, r, err)
+				return
+			}
+		case scs.Destroyed:
+			_ = c.writeChunks(ctx, w, sm, "", len(chunks), time.Time{})
+		}
+
+		w.Header().Add("Vary", "Cookie")
+
+		if bw.code != 0 {
+			w.WriteHeader(bw.code)
+		}
+		_, _ = w.Write(bw.buf)
+	})
+}
+
+// readChunks returns the values of the session cookies of r, in order
+func (c *CookieStore) readChunks(r *http.Request, name string) []string {
+	first, err := r.Cookie(name)
+	if err != nil {
+		return nil
+	}
+
+	chunks := []string{first.Value}
+	for i := 1; i < c.MaxChunks; i++ {
+		cookie, err := r.Cookie(chunkName(name, i))
+		if err != nil {
+			break
+		}
+		chunks = append(chunks, cookie.Value)
+	}
+
+	return chunks
+}
+
+// writeChunks writes value to as many session cookies as it needs, and deletes the
+// session cookies the request had which are no longer needed. An empty value deletes
+// every session cookie.
+func (c *CookieStore) writeChunks(ctx context.Context, w http.ResponseWriter, sm *scs.SessionManager, value string, previous int, expiry time.Time) error {
+	var chunks []string
+	for len(value) > chunkSize {
+		chunks = append(chunks, value[:chunkSize])
+		value = value[chunkSize:]
+	}
+	if value != "" {
+		chunks = append(chunks, value)
+	}
+
+	if len(chunks) > c.MaxChunks {
+		return fmt.Errorf("%w: %d cookies needed, %d allowed", ErrCookieTooLarge, len(chunks), c.MaxChunks)
+	}
+
+	persist := sm.Cookie.Persist || sm.GetBool(ctx, "__rememberMe")
+	for i := 0; i < len(chunks) || i < previous; i++ {
+		cookie := &http.Cookie{
+			Name:     chunkName(sm.Cookie.Name, i),
+			Path:     sm.Cookie.Path,
+			Domain:   sm.Cookie.Domain,
+			Secure:   sm.Cookie.Secure,
+			HttpOnly: sm.Cookie.HttpOnly,
+			SameSite: sm.Cookie.SameSite,
+		}
+
+		switch {
+		case i >= len(chunks):
+			cookie.Expires = time.Unix(1, 0)
+			cookie.MaxAge = -1
+		case persist:
+			cookie.Value = chunks[i]
+			cookie.Expires = time.Unix(expiry.Unix()+1, 0)
+			cookie.MaxAge = int(time.Until(expiry).Seconds() + 1)
+		default:
+			cookie.Value = chunks[i]
+		}
+
+		w.Header().Add("Set-Cookie", cookie.String())
+	}
+	w.Header().Add("Cache-Control", `no-cache="Set-Cookie"`)
+
+	return nil
+}
+
+// chunkName returns the name of the cookie holding chunk i of a session
+func chunkName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+
+	return name + "_" + strconv.Itoa(i)
+}
+
+// seal encrypts and authenticates data, which expires at expiry, with the current key.
+// The cookie value is the base64 encoding of nonce | ciphertext | mac, where the
+// plaintext is the expiry as unix seconds followed by data.
+func (c *CookieStore) seal(data []byte, expiry time.Time) (string, error) {
+	key := c.keys[0]
+
+	plaintext := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(plaintext, uint64(expiry.Unix()))
+	plaintext = append(plaintext, data...)
+
+	nonce := make([]byte, key.aead.NonceSize(), key.aead.NonceSize()+len(plaintext)+key.aead.Overhead()+sha256.Size)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := key.aead.Seal(nonce, nonce, plaintext, nil)
+	sealed = append(sealed, sign(key.macKey, sealed)...)
+
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// open verifies and decrypts a cookie value written by seal, with any of the keys. It
+// reports false if the value was not written with one of the keys, was tampered with,
+// or has expired.
+func (c *CookieStore) open(value string) (pendingSession, bool) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(sealed) < sha256.Size {
+		return pendingSession{}, false
+	}
+
+	body, mac := sealed[:len(sealed)-sha256.Size], sealed[len(sealed)-sha256.Size:]
+	for _, key := range c.keys {
+		if !hmac.Equal(mac, sign(key.macKey, body)) {
+			continue
+		}
+
+		nonceSize := key.aead.NonceSize()
+		if len(body) < nonceSize {
+			return pendingSession{}, false
+		}
+
+		plaintext, err := key.aead.Open(nil, body[:nonceSize], body[nonceSize:], nil)
+		if err != nil || len(plaintext) < 8 {
+			return pendingSession{}, false
+		}
+
+		expiry := time.Unix(int64(binary.BigEndian.Uint64(plaintext[:8])), 0)
+		if !time.Now().Before(expiry) {
+			return pendingSession{}, false
+		}
+
+		return pendingSession{data: plaintext[8:], expiry: expiry}, true
+	}
+
+	return pendingSession{}, false
+}
+
+func sign(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// randomToken returns a token which is unique among the requests in flight
+func randomToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// LoadAndSave is middleware which loads and saves the session of sm for every request,
+// using the cookie store when sm keeps sessions in cookies.
+//
+// Responses are held back until the session has been saved, which streams cannot wait
+// for, so requests for event streams and WebSocket connections only load the session:
+// changes they make to it are not saved.
+func LoadAndSave(sm *scs.SessionManager, next http.Handler) http.Handler {
+	if c, ok := sm.Store.(*CookieStore); ok {
+		return c.LoadAndSave(sm, next)
+	}
+
+	loadAndSave := sm.LoadAndSave(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isStream(r) {
+			loadAndSave.ServeHTTP(w, r)
+			return
+		}
+
+		var token string
+		if cookie, err := r.Cookie(sm.Cookie.Name); err == nil {
+			token = cookie.Value
+		}
+
+		ctx, err := sm.Load(r.Context(), token)
+		if err != nil {
+			sm.ErrorFunc(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isStream reports whether r asks for a response which is streamed to the client: an
+// event stream, or an upgrade to a WebSocket connection
+func isStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// bufferedWriter holds back the response until the session cookies have been written
+type bufferedWriter struct {
+	http.ResponseWriter
+	buf  []byte
+	code int
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	bw.buf = append(bw.buf, b...)
+	return len(b), nil
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	bw.code = code
+}
@@ -0,0 +1,230 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+const testKey = "abcdefghijklmnopqrstuvwxyz123456"
+
+func newCookieManager(t *testing.T, keys ...string) *scs.SessionManager {
+	store, err := NewCookieStore(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := scs.New()
+	sm.Store = store
+	return sm
+}
+
+// roundTrip sends a request with cookies through the cookie store of sm and handler, and
+// returns the cookies set by the response and any error passed to ErrorFunc
+func roundTrip(sm *scs.SessionManager, handler http.HandlerFunc, cookies []*http.Cookie) ([]*http.Cookie, error) {
+	var handlerErr error
+	sm.ErrorFunc = func(w http.ResponseWriter, r *http.Request, err error) {
+		handlerErr = err
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	rr := httptest.NewRecorder()
+	LoadAndSave(sm, handler).ServeHTTP(rr, req)
+
+	return rr.Result().Cookies(), handlerErr
+}
+
+func TestCookieStore_RoundTrip(t *testing.T) {
+	sm := newCookieManager(t, testKey)
+
+	cookies, err := roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "userID", 7)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cookies) != 1 || strings.Contains(cookies[0].Value, "userID") {
+		t.Fatal("session was not written to an encrypted cookie:", cookies)
+	}
+
+	var userID int
+	_, _ = roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+		userID = sm.GetInt(r.Context(), "userID")
+	}, cookies)
+
+	if userID != 7 {
+		t.Error("session was not read back from the cookie")
+	}
+
+	store := sm.Store.(*CookieStore)
+	if len(store.pending) != 0 {
+		t.Error("sessions were left behind in the store:", len(store.pending))
+	}
+}
+
+func TestCookieStore_Tampered(t *testing.T) {
+	sm := newCookieManager(t, testKey)
+
+	cookies, _ := roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "userID", 7)
+	}, nil)
+
+	value := []byte(cookies[0].Value)
+	value[len(value)/2] ^= 1
+	cookies[0].Value = string(value)
+
+	var exists bool
+	_, _ = roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+		exists = sm.Exists(r.Context(), "userID")
+	}, cookies)
+
+	if exists {
+		t.Error("tampered cookie was accepted")
+	}
+}
+
+func TestCookieStore_KeyRotation(t *testing.T) {
+	oldKey := "00000000000000000000000000000000"
+	sm := newCookieManager(t, oldKey)
+
+	cookies, _ := roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "userID", 7)
+	}, nil)
+
+	var userID int
+	rotated := newCookieManager(t, testKey, oldKey)
+	_, _ = roundTrip(rotated, func(w http.ResponseWriter, r *http.Request) {
+		userID = rotated.GetInt(r.Context(), "userID")
+	}, cookies)
+
+	if userID != 7 {
+		t.Error("session encrypted with a previous key was not accepted")
+	}
+
+	other := newCookieManager(t, testKey)
+	_, _ = roundTrip(other, func(w http.ResponseWriter, r *http.Request) {
+		userID = other.GetInt(r.Context(), "userID")
+	}, cookies)
+
+	if userID != 0 {
+		t.Error("session encrypted with an unknown key was accepted")
+	}
+}
+
+func TestCookieStore_Chunks(t *testing.T) {
+	sm := newCookieManager(t, testKey)
+
+	// random data does not compress, so it needs several cookies
+	big := randomToken() + strings.Repeat(randomToken(), 300)
+
+	cookies, err := roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "big", big)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cookies) < 2 {
+		t.Fatal("large session was not split across cookies:", len(cookies))
+	}
+
+	var got string
+	cookies, _ = roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+		got = sm.GetString(r.Context(), "big")
+		sm.Remove(r.Context(), "big")
+	}, cookies)
+
+	if got != big {
+		t.Error("large session was not read back from the cookies")
+	}
+
+	deleted := 0
+	for _, cookie := range cookies {
+		if cookie.MaxAge < 0 {
+			deleted++
+		}
+	}
+	if deleted == 0 {
+		t.Error("cookies no longer needed were not deleted")
+	}
+}
+
+func TestCookieStore_TooLarge(t *testing.T) {
+	sm := newCookieManager(t, testKey)
+	sm.Store.(*CookieStore).MaxChunks = 1
+
+	_, err := roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "big", strings.Repeat(randomToken(), 300))
+	}, nil)
+
+	if !errors.Is(err, ErrCookieTooLarge) {
+		t.Error("expected ErrCookieTooLarge, got", err)
+	}
+}
+
+func TestCookieStore_Expired(t *testing.T) {
+	store, _ := NewCookieStore(testKey)
+
+	value, _ := store.seal([]byte("data"), time.Now().Add(-time.Minute))
+	if _, ok := store.open(value); ok {
+		t.Error("expired session was accepted")
+	}
+
+	value, _ = store.seal([]byte("data"), time.Now().Add(time.Minute))
+	if p, ok := store.open(value); !ok || string(p.data) != "data" {
+		t.Error("session was not opened")
+	}
+}
+
+func TestNewCookieStore_NoKeys(t *testing.T) {
+	_, err := NewCookieStore("", "")
+	if err != ErrNoCookieKeys {
+		t.Error("expected ErrNoCookieKeys, got", err)
+	}
+}
+
+func TestLoadAndSave_Stream(t *testing.T) {
+	memory := scs.New()
+	memory.Store = NewMemoryStore(0)
+
+	for name, sm := range map[string]*scs.SessionManager{"memory": memory, "cookie": newCookieManager(t, testKey)} {
+		// a session to load
+		cookies, err := roundTrip(sm, func(w http.ResponseWriter, r *http.Request) {
+			sm.Put(r.Context(), "userID", 7)
+		}, nil)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		var userID int
+		var flushable bool
+		handler := LoadAndSave(sm, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID = sm.GetInt(r.Context(), "userID")
+			_, flushable = w.(http.Flusher)
+		}))
+
+		req := httptest.NewRequest("GET", "/events", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if userID != 7 {
+			t.Error(name, "session not loaded for a stream")
+		}
+		if !flushable {
+			t.Error(name, "stream response is buffered")
+		}
+	}
+}
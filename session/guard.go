@@ -0,0 +1,73 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// fingerprintKey is the key of the user agent fingerprint a session is bound to
+const fingerprintKey = "session_fingerprint"
+
+// Guard is middleware which protects sessions against fixation and theft. It renews the
+// session token whenever one of the RenewOn keys changes, such as on login, logout or a
+// change of role, and can bind the session of a logged in user to their user agent.
+type Guard struct {
+	Manager *scs.SessionManager
+	// RenewOn lists the session keys whose changes are privilege changes
+	RenewOn []string
+	// BindUserAgent ends sessions which are used by a different user agent from the one
+	// the user logged in with
+	BindUserAgent bool
+}
+
+// Middleware must run inside the LoadAndSave middleware of the session manager
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		sm := g.Manager
+
+		if g.BindUserAgent && sm.Exists(ctx, fingerprintKey) && sm.GetString(ctx, fingerprintKey) != fingerprint(r) {
+			// the session was stolen, or the browser changed; either way, start again
+			if err := sm.Destroy(ctx); err != nil {
+				sm.ErrorFunc(w, r, err)
+				return
+			}
+		}
+
+		before := make([]interface{}, len(g.RenewOn))
+		for i, key := range g.RenewOn {
+			before[i] = sm.Get(ctx, key)
+		}
+
+		next.ServeHTTP(w, r)
+
+		if sm.Status(ctx) == scs.Destroyed {
+			return
+		}
+
+		for i, key := range g.RenewOn {
+			if !reflect.DeepEqual(before[i], sm.Get(ctx, key)) {
+				if err := sm.RenewToken(ctx); err != nil {
+					sm.ErrorFunc(w, r, err)
+					return
+				}
+				sm.Remove(ctx, fingerprintKey)
+				break
+			}
+		}
+
+		if g.BindUserAgent && sm.Exists(ctx, userIDKey) && !sm.Exists(ctx, fingerprintKey) {
+			sm.Put(ctx, fingerprintKey, fingerprint(r))
+		}
+	})
+}
+
+// fingerprint identifies the user agent that sent r
+func fingerprint(r *http.Request) string {
+	sum := sha256.Sum256([]byte(r.UserAgent()))
+	return hex.EncodeToString(sum[:16])
+}
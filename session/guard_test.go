@@ -0,0 +1,111 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// serve sends a request with the session cookie token and userAgent through the guard
+// and handler, and returns the token of the session cookie in the response, if any
+func serve(sm *scs.SessionManager, g *Guard, handler http.HandlerFunc, token, userAgent string) string {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", userAgent)
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: sm.Cookie.Name, Value: token})
+	}
+
+	rr := httptest.NewRecorder()
+	sm.LoadAndSave(g.Middleware(handler)).ServeHTTP(rr, req)
+
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == sm.Cookie.Name {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+func TestGuard_RenewsTokenOnLogin(t *testing.T) {
+	sm := scs.New()
+	sm.Store = NewMemoryStore(0)
+	g := (&Session{}).Guard(sm)
+
+	anonymous := serve(sm, g, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "cart", "1 item")
+	}, "", "browser")
+
+	loggedIn := serve(sm, g, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "userID", 1)
+	}, anonymous, "browser")
+
+	if loggedIn == "" || loggedIn == anonymous {
+		t.Error("session token was not renewed on login")
+	}
+
+	if _, found, _ := sm.Store.Find(anonymous); found {
+		t.Error("session with the old token was not removed")
+	}
+
+	unchanged := serve(sm, g, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "cart", "2 items")
+	}, loggedIn, "browser")
+
+	if unchanged != loggedIn {
+		t.Error("session token was renewed without a privilege change")
+	}
+}
+
+func TestGuard_BindUserAgent(t *testing.T) {
+	sm := scs.New()
+	sm.Store = NewMemoryStore(0)
+	g := (&Session{BindUserAgent: "true"}).Guard(sm)
+
+	token := serve(sm, g, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "userID", 1)
+	}, "", "browser")
+
+	var userID int
+	serve(sm, g, func(w http.ResponseWriter, r *http.Request) {
+		userID = sm.GetInt(r.Context(), "userID")
+	}, token, "browser")
+
+	if userID != 1 {
+		t.Error("session was lost with the same user agent")
+	}
+
+	serve(sm, g, func(w http.ResponseWriter, r *http.Request) {
+		userID = sm.GetInt(r.Context(), "userID")
+	}, token, "somebody else")
+
+	if userID != 0 {
+		t.Error("session was used with a different user agent")
+	}
+
+	if _, found, _ := sm.Store.Find(token); found {
+		t.Error("session used with a different user agent was not destroyed")
+	}
+}
+
+func TestSession_InitSessionHardening(t *testing.T) {
+	s := &Session{
+		CookieLifetime: "120",
+		CookieName:     "sokudo",
+		CookieSameSite: "none",
+		IdleTimeout:    "20",
+		SessionType:    "memory",
+	}
+
+	sm := s.InitSession()
+
+	if sm.Cookie.SameSite != http.SameSiteNoneMode || !sm.Cookie.Secure || !sm.Cookie.HttpOnly {
+		t.Error("wrong cookie flags:", sm.Cookie)
+	}
+
+	if sm.IdleTimeout.Minutes() != 20 || sm.Lifetime.Minutes() != 120 {
+		t.Error("wrong timeouts:", sm.IdleTimeout, sm.Lifetime)
+	}
+}
@@ -0,0 +1,373 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+)
+
+// UserIndex keeps the tokens of the sessions of every user, so that the sessions of a user
+// can be found without reading every session in the store
+type UserIndex interface {
+	// Add records that the session with token, which expires at expiry, is userID's
+	Add(userID int, token string, expiry time.Time) error
+	// Remove forgets the session with token of userID
+	Remove(userID int, token string) error
+	// Tokens returns the tokens of the sessions of userID which have not expired. They may
+	// include sessions which have since been taken over by another user, or destroyed
+	// without the index knowing, so the sessions must be checked.
+	Tokens(userID int) ([]string, error)
+}
+
+// IndexedStore is a session store which keeps Index up to date with the sessions committed
+// to and deleted from Store. Failures to update the index are logged to ErrorLog, or to the
+// standard logger if it is nil, rather than failing the session, so that users can still
+// log in when the index is unavailable, for example before the sessions_users table is
+// created.
+type IndexedStore struct {
+	scs.Store
+	Index    UserIndex
+	ErrorLog *log.Logger
+
+	codec scs.Codec
+}
+
+// NewIndexedStore returns store, indexing the sessions of logged in users in index.
+// Sessions are decoded with codec, which must be the codec of the session manager.
+func NewIndexedStore(store scs.Store, index UserIndex, codec scs.Codec) *IndexedStore {
+	return &IndexedStore{
+		Store: store,
+		Index: index,
+		codec: codec,
+	}
+}
+
+// Commit stores the data for a session token, and indexes it if a user is logged in
+func (s *IndexedStore) Commit(token string, b []byte, expiry time.Time) error {
+	if err := s.Store.Commit(token, b, expiry); err != nil {
+		return err
+	}
+
+	if userID := s.userID(b); userID != 0 {
+		if err := s.Index.Add(userID, token, expiry); err != nil {
+			s.logIndexError(err)
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a session token, and its entry in the index
+func (s *IndexedStore) Delete(token string) error {
+	b, found, err := s.Store.Find(token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.Delete(token); err != nil {
+		return err
+	}
+
+	if userID := s.userID(b); found && userID != 0 {
+		if err := s.Index.Remove(userID, token); err != nil {
+			s.logIndexError(err)
+		}
+	}
+
+	return nil
+}
+
+// logIndexError logs a failure to update the index
+func (s *IndexedStore) logIndexError(err error) {
+	logger := s.ErrorLog
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	logger.Println("updating the index of sessions by user:", err)
+}
+
+// All returns the data of every session in Store, so that sessions can be iterated over
+// with Iterate. It returns an error if Store does not support iteration.
+func (s *IndexedStore) All() (map[string][]byte, error) {
+	store, ok := s.Store.(scs.IterableStore)
+	if !ok {
+		return nil, fmt.Errorf("type %T does not support iteration", s.Store)
+	}
+
+	return store.All()
+}
+
+// userID returns the user logged in to the session with data b, or 0
+func (s *IndexedStore) userID(b []byte) int {
+	_, values, err := s.codec.Decode(b)
+	if err != nil {
+		return 0
+	}
+
+	userID, _ := values[userIDKey].(int)
+	return userID
+}
+
+// MemoryIndex is a UserIndex kept in memory, for the memory store
+type MemoryIndex struct {
+	mu    sync.Mutex
+	users map[int]map[string]time.Time
+}
+
+// NewMemoryIndex returns an empty MemoryIndex
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{users: make(map[int]map[string]time.Time)}
+}
+
+func (m *MemoryIndex) Add(userID int, token string, expiry time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[userID] == nil {
+		m.users[userID] = make(map[string]time.Time)
+	}
+	m.users[userID][token] = expiry
+
+	return nil
+}
+
+func (m *MemoryIndex) Remove(userID int, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.users[userID], token)
+	if len(m.users[userID]) == 0 {
+		delete(m.users, userID)
+	}
+
+	return nil
+}
+
+func (m *MemoryIndex) Tokens(userID int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var tokens []string
+	for token, expiry := range m.users[userID] {
+		if !now.Before(expiry) {
+			delete(m.users[userID], token)
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// RedisIndex is a UserIndex kept in redis, with a sorted set of tokens, scored by expiry,
+// for every user. Conn is used for a single server; when Cluster is set, it is used
+// instead.
+type RedisIndex struct {
+	Conn    *redis.Pool
+	Cluster *redisc.Cluster
+	prefix  string
+}
+
+// NewRedisIndex returns a UserIndex kept in the redis server of pool, or in cluster if it
+// is not nil
+func NewRedisIndex(pool *redis.Pool, cluster *redisc.Cluster) *RedisIndex {
+	return &RedisIndex{
+		Conn:    pool,
+		Cluster: cluster,
+		prefix:  "scs:user:",
+	}
+}
+
+// redisIndexAddScript adds a token, drops the expired ones, and lets the set expire with
+// the last of its sessions
+var redisIndexAddScript = redis.NewScript(1, `
+redis.call("ZADD", KEYS[1], ARGV[1], ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[3])
+local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+redis.call("EXPIREAT", KEYS[1], last[2])
+return 1
+`)
+
+func (r *RedisIndex) Add(userID int, token string, expiry time.Time) error {
+	key := r.key(userID)
+	conn := r.conn(key)
+	defer conn.Close()
+
+	_, err := redisIndexAddScript.Do(conn, key, expiry.Unix(), token, time.Now().Unix())
+	return err
+}
+
+func (r *RedisIndex) Remove(userID int, token string) error {
+	key := r.key(userID)
+	conn := r.conn(key)
+	defer conn.Close()
+
+	_, err := conn.Do("ZREM", key, token)
+	return err
+}
+
+func (r *RedisIndex) Tokens(userID int) ([]string, error) {
+	key := r.key(userID)
+	conn := r.conn(key)
+	defer conn.Close()
+
+	// tokens expiring this second have expired in the store too
+	return redis.Strings(conn.Do("ZRANGEBYSCORE", key, "("+strconv.FormatInt(time.Now().Unix(), 10), "+inf"))
+}
+
+func (r *RedisIndex) key(userID int) string {
+	return r.prefix + strconv.Itoa(userID)
+}
+
+// conn returns a connection to the node holding key
+func (r *RedisIndex) conn(key string) redis.Conn {
+	if r.Cluster == nil {
+		return r.Conn.Get()
+	}
+
+	conn := r.Cluster.Get()
+	_ = redisc.BindConn(conn, key)
+
+	retryConn, err := redisc.RetryConn(conn, 3, 100*time.Millisecond)
+	if err != nil {
+		return conn
+	}
+
+	return retryConn
+}
+
+// BadgerIndex is a UserIndex kept in badger, with a key for every session of a user which
+// expires with the session
+type BadgerIndex struct {
+	db     *badger.DB
+	prefix string
+}
+
+// NewBadgerIndex returns a UserIndex kept in db
+func NewBadgerIndex(db *badger.DB) *BadgerIndex {
+	return &BadgerIndex{
+		db:     db,
+		prefix: "scs:user:",
+	}
+}
+
+func (b *BadgerIndex) Add(userID int, token string, expiry time.Time) error {
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		return b.Remove(userID, token)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(b.key(userID, token), nil).WithTTL(ttl))
+	})
+}
+
+func (b *BadgerIndex) Remove(userID int, token string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(b.key(userID, token))
+	})
+}
+
+func (b *BadgerIndex) Tokens(userID int) ([]string, error) {
+	var tokens []string
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := b.key(userID, "")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			tokens = append(tokens, string(it.Item().Key()[len(prefix):]))
+		}
+
+		return nil
+	})
+
+	return tokens, err
+}
+
+func (b *BadgerIndex) key(userID int, token string) []byte {
+	return []byte(fmt.Sprintf("%s%d:%s", b.prefix, userID, token))
+}
+
+// SQLIndex is a UserIndex kept in the sessions_users table, which the make session command
+// creates next to the sessions table. Applications whose sessions table was made earlier
+// create it with make session-index.
+type SQLIndex struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// NewSQLIndex returns a UserIndex kept in db, which is a postgres database if postgres is
+// true, and a mysql or mariadb database otherwise
+func NewSQLIndex(db *sql.DB, postgres bool) *SQLIndex {
+	return &SQLIndex{db: db, postgres: postgres}
+}
+
+func (s *SQLIndex) Add(userID int, token string, expiry time.Time) error {
+	query := "REPLACE INTO sessions_users (token, user_id, expiry) VALUES (?, ?, ?)"
+	if s.postgres {
+		query = `INSERT INTO sessions_users (token, user_id, expiry) VALUES ($1, $2, $3)
+			ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, expiry = EXCLUDED.expiry`
+	}
+
+	_, err := s.db.Exec(query, token, userID, expiry.UTC())
+	return err
+}
+
+func (s *SQLIndex) Remove(userID int, token string) error {
+	query := "DELETE FROM sessions_users WHERE token = ? AND user_id = ?"
+	if s.postgres {
+		query = "DELETE FROM sessions_users WHERE token = $1 AND user_id = $2"
+	}
+
+	_, err := s.db.Exec(query, token, userID)
+	return err
+}
+
+func (s *SQLIndex) Tokens(userID int) ([]string, error) {
+	now := time.Now().UTC()
+
+	// expired rows are cleaned up with the sessions of the user
+	query := "DELETE FROM sessions_users WHERE user_id = ? AND expiry <= ?"
+	if s.postgres {
+		query = "DELETE FROM sessions_users WHERE user_id = $1 AND expiry <= $2"
+	}
+	if _, err := s.db.Exec(query, userID, now); err != nil {
+		return nil, err
+	}
+
+	query = "SELECT token FROM sessions_users WHERE user_id = ?"
+	if s.postgres {
+		query = "SELECT token FROM sessions_users WHERE user_id = $1"
+	}
+
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
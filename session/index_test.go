@@ -0,0 +1,115 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gomodule/redigo/redis"
+)
+
+// testUserIndex checks the behaviour every UserIndex shares
+func testUserIndex(t *testing.T, name string, index UserIndex) {
+	expiry := time.Now().Add(time.Hour)
+
+	for _, token := range []string{"laptop", "phone"} {
+		if err := index.Add(1, token, expiry); err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	_ = index.Add(2, "other", expiry)
+	_ = index.Add(1, "expired", time.Now().Add(-time.Second))
+
+	tokens, err := index.Tokens(1)
+	sort.Strings(tokens)
+	if err != nil || len(tokens) != 2 || tokens[0] != "laptop" || tokens[1] != "phone" {
+		t.Errorf("%s: wrong tokens for user 1: %v %v", name, tokens, err)
+	}
+
+	if err := index.Remove(1, "phone"); err != nil {
+		t.Error(name, err)
+	}
+
+	tokens, _ = index.Tokens(1)
+	if len(tokens) != 1 || tokens[0] != "laptop" {
+		t.Errorf("%s: token was not removed: %v", name, tokens)
+	}
+
+	tokens, _ = index.Tokens(2)
+	if len(tokens) != 1 || tokens[0] != "other" {
+		t.Errorf("%s: wrong tokens for user 2: %v", name, tokens)
+	}
+}
+
+func TestMemoryIndex(t *testing.T) {
+	testUserIndex(t, "memory", NewMemoryIndex())
+}
+
+func TestRedisIndex(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	}
+	defer pool.Close()
+
+	testUserIndex(t, "redis", NewRedisIndex(pool, nil))
+
+	if ttl := s.TTL("scs:user:1"); ttl <= 0 || ttl > time.Hour {
+		t.Error("the index of a user does not expire with its sessions:", ttl)
+	}
+}
+
+func TestBadgerIndex(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	testUserIndex(t, "badger", NewBadgerIndex(db))
+}
+
+// failingIndex is a UserIndex whose writes fail, like an SQLIndex without its table
+type failingIndex struct {
+	MemoryIndex
+}
+
+func (f *failingIndex) Add(userID int, token string, expiry time.Time) error {
+	return errors.New("no such table: sessions_users")
+}
+
+func TestIndexedStore_IndexFailure(t *testing.T) {
+	sm := scs.New()
+	var logged bytes.Buffer
+	store := NewIndexedStore(NewMemoryStore(0), &failingIndex{}, sm.Codec)
+	store.ErrorLog = log.New(&logged, "", 0)
+	sm.Store = store
+
+	ctx, err := sm.Load(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Put(ctx, userIDKey, 1)
+
+	if _, _, err := sm.Commit(ctx); err != nil {
+		t.Error("session was not committed when the index failed:", err)
+	}
+	if !strings.Contains(logged.String(), "sessions_users") {
+		t.Error("index failure was not logged:", logged.String())
+	}
+}
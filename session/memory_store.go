@@ -0,0 +1,124 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a session store which keeps sessions in memory. Sessions are lost when
+// the application stops, and are not shared between instances, so it is meant for tests
+// and development.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	items       map[string]memoryItem
+	stopCleanup chan struct{}
+}
+
+type memoryItem struct {
+	data   []byte
+	expiry time.Time
+}
+
+// NewMemoryStore returns a session store which keeps sessions in memory, and removes
+// expired sessions every cleanupInterval. If cleanupInterval is 0, expired sessions are
+// only removed when they are looked up.
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	m := &MemoryStore{
+		items: make(map[string]memoryItem),
+	}
+
+	if cleanupInterval > 0 {
+		m.stopCleanup = make(chan struct{})
+		go m.startCleanup(cleanupInterval, m.stopCleanup)
+	}
+
+	return m
+}
+
+// Find returns the data for a session token. If the session does not exist or has
+// expired, exists is false.
+func (m *MemoryStore) Find(token string) ([]byte, bool, error) {
+	m.mu.RLock()
+	item, found := m.items[token]
+	m.mu.RUnlock()
+
+	if !found || !time.Now().Before(item.expiry) {
+		return nil, false, nil
+	}
+
+	return item.data, true, nil
+}
+
+// Commit stores the data for a session token, until expiry
+func (m *MemoryStore) Commit(token string, data []byte, expiry time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items[token] = memoryItem{
+		data:   data,
+		expiry: expiry,
+	}
+
+	return nil
+}
+
+// Delete removes a session token
+func (m *MemoryStore) Delete(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.items, token)
+
+	return nil
+}
+
+// All returns every session that has not expired
+func (m *MemoryStore) All() (map[string][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	sessions := make(map[string][]byte)
+	for token, item := range m.items {
+		if now.Before(item.expiry) {
+			sessions[token] = item.data
+		}
+	}
+
+	return sessions, nil
+}
+
+// StopCleanup stops the goroutine that removes expired sessions
+func (m *MemoryStore) StopCleanup() {
+	if m.stopCleanup != nil {
+		close(m.stopCleanup)
+		m.stopCleanup = nil
+	}
+}
+
+func (m *MemoryStore) startCleanup(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.deleteExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// deleteExpired removes every session that has expired
+func (m *MemoryStore) deleteExpired() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for token, item := range m.items {
+		if !now.Before(item.expiry) {
+			delete(m.items, token)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(0)
+
+	_ = store.Commit("token", []byte("data"), time.Now().Add(time.Minute))
+
+	b, exists, err := store.Find("token")
+	if err != nil || !exists || string(b) != "data" {
+		t.Error("did not find committed session:", string(b), exists, err)
+	}
+
+	_ = store.Delete("token")
+
+	_, exists, _ = store.Find("token")
+	if exists {
+		t.Error("session found after it was deleted")
+	}
+}
+
+func TestMemoryStore_All(t *testing.T) {
+	store := NewMemoryStore(0)
+
+	_ = store.Commit("live", []byte("1"), time.Now().Add(time.Minute))
+	_ = store.Commit("expired", []byte("2"), time.Now().Add(-time.Minute))
+
+	sessions, err := store.All()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(sessions) != 1 || string(sessions["live"]) != "1" {
+		t.Error("wrong sessions returned:", sessions)
+	}
+}
+
+func TestMemoryStore_Cleanup(t *testing.T) {
+	store := NewMemoryStore(10 * time.Millisecond)
+	defer store.StopCleanup()
+
+	_ = store.Commit("token", []byte("data"), time.Now().Add(5*time.Millisecond))
+
+	time.Sleep(50 * time.Millisecond)
+
+	store.mu.RLock()
+	remaining := len(store.items)
+	store.mu.RUnlock()
+
+	if remaining != 0 {
+		t.Error("expired session was not cleaned up")
+	}
+}
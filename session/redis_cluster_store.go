@@ -0,0 +1,119 @@
+package session
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+)
+
+// RedisClusterStore is a session store for redis cluster. It stores sessions under the
+// same keys as the scs redis store, so that sessions survive a move from a single redis
+// server to a cluster.
+type RedisClusterStore struct {
+	cluster *redisc.Cluster
+	prefix  string
+}
+
+// NewRedisClusterStore returns a session store which keeps sessions in cluster
+func NewRedisClusterStore(cluster *redisc.Cluster) *RedisClusterStore {
+	return &RedisClusterStore{
+		cluster: cluster,
+		prefix:  "scs:session:",
+	}
+}
+
+// Find returns the data for a session token. If the session does not exist or has
+// expired, exists is false.
+func (r *RedisClusterStore) Find(token string) ([]byte, bool, error) {
+	conn := r.conn(r.prefix + token)
+	defer conn.Close()
+
+	b, err := redis.Bytes(conn.Do("GET", r.prefix+token))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit stores the data for a session token, until expiry
+func (r *RedisClusterStore) Commit(token string, b []byte, expiry time.Time) error {
+	conn := r.conn(r.prefix + token)
+	defer conn.Close()
+
+	ttl := time.Until(expiry).Milliseconds()
+	if ttl <= 0 {
+		_, err := conn.Do("DEL", r.prefix+token)
+		return err
+	}
+
+	_, err := conn.Do("SET", r.prefix+token, b, "PX", ttl)
+	return err
+}
+
+// Delete removes a session token
+func (r *RedisClusterStore) Delete(token string) error {
+	conn := r.conn(r.prefix + token)
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", r.prefix+token)
+	return err
+}
+
+// All returns every session, from every primary node of the cluster
+func (r *RedisClusterStore) All() (map[string][]byte, error) {
+	var tokens []string
+	err := r.cluster.EachNode(false, func(addr string, conn redis.Conn) error {
+		iter := 0
+		for {
+			arr, err := redis.Values(conn.Do("SCAN", iter, "MATCH", r.prefix+"*"))
+			if err != nil {
+				return err
+			}
+
+			iter, _ = redis.Int(arr[0], nil)
+			keys, _ := redis.Strings(arr[1], nil)
+			for _, key := range keys {
+				tokens = append(tokens, key[len(r.prefix):])
+			}
+
+			if iter == 0 {
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make(map[string][]byte)
+	for _, token := range tokens {
+		b, exists, err := r.Find(token)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			sessions[token] = b
+		}
+	}
+
+	return sessions, nil
+}
+
+// conn returns a connection bound to the node holding key, which follows redirections
+// when slots have moved
+func (r *RedisClusterStore) conn(key string) redis.Conn {
+	conn := r.cluster.Get()
+	_ = redisc.BindConn(conn, key)
+
+	retryConn, err := redisc.RetryConn(conn, 3, 100*time.Millisecond)
+	if err != nil {
+		return conn
+	}
+
+	return retryConn
+}
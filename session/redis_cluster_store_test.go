@@ -0,0 +1,47 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mna/redisc"
+)
+
+func TestRedisClusterStore(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cluster := &redisc.Cluster{StartupNodes: []string{s.Addr()}}
+	defer cluster.Close()
+
+	store := NewRedisClusterStore(cluster)
+
+	err = store.Commit("token", []byte("data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Error(err)
+	}
+
+	b, exists, err := store.Find("token")
+	if err != nil || !exists || string(b) != "data" {
+		t.Error("did not find committed session:", string(b), exists, err)
+	}
+
+	all, err := store.All()
+	if err != nil || len(all) != 1 {
+		t.Error("expected one session from All, got", all, err)
+	}
+
+	err = store.Delete("token")
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, exists, _ = store.Find("token")
+	if exists {
+		t.Error("session found after it was deleted")
+	}
+}
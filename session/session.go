@@ -2,6 +2,7 @@ package session
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,18 +12,39 @@ import (
 	"github.com/alexedwards/scs/postgresstore"
 	"github.com/alexedwards/scs/redisstore"
 	"github.com/alexedwards/scs/v2"
+	"github.com/dgraph-io/badger/v3"
 	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
 )
 
 type Session struct {
+	// CookieLifetime is the absolute lifetime of a session, in minutes
 	CookieLifetime string
 	CookiePersist  string
 	CookieName     string
 	CookieDomain   string
 	SessionType    string
 	CookieSecure   string
-	DBPool         *sql.DB
-	RedisPool      *redis.Pool
+	// CookieSameSite is lax, strict or none. Cookies with SameSite=None are always secure.
+	CookieSameSite string
+	// IdleTimeout ends sessions which are not used for that many minutes; empty or 0
+	// for no idle timeout
+	IdleTimeout string
+	// RenewOn is a comma separated list of session keys, such as userID, whose changes
+	// renew the session token
+	RenewOn string
+	// BindUserAgent, if true, ends sessions used by a different user agent from the one
+	// the user logged in with
+	BindUserAgent string
+	// CookieKeys encrypt sessions kept in cookies. The first is used for new sessions,
+	// and the others are previous keys, still accepted when reading cookies.
+	CookieKeys   []string
+	DBPool       *sql.DB
+	RedisPool    *redis.Pool
+	RedisCluster *redisc.Cluster
+	BadgerConn   *badger.DB
+	// ErrorLog receives failures to update the index of sessions by user
+	ErrorLog *log.Logger
 }
 
 func (c *Session) InitSession() *scs.SessionManager {
@@ -44,26 +66,86 @@ func (c *Session) InitSession() *scs.SessionManager {
 		secure = true
 	}
 
+	// which sites may send the cookie?
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(c.CookieSameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		// browsers reject SameSite=None cookies which are not secure
+		sameSite = http.SameSiteNoneMode
+		secure = true
+	}
+
+	// how long may sessions be idle?
+	idleMinutes, _ := strconv.Atoi(c.IdleTimeout)
+
 	// create session
 	session := scs.New()
 	session.Lifetime = time.Duration(minutes) * time.Minute
+	session.IdleTimeout = time.Duration(idleMinutes) * time.Minute
 	session.Cookie.Persist = persist
 	session.Cookie.Name = c.CookieName
 	session.Cookie.Secure = secure
+	session.Cookie.HttpOnly = true
 	session.Cookie.Domain = c.CookieDomain
-	session.Cookie.SameSite = http.SameSiteLaxMode
+	session.Cookie.SameSite = sameSite
 
-	// which session store?
+	// which session store, and which index of the sessions of every user?
+	index := UserIndex(NewMemoryIndex())
 	switch strings.ToLower(c.SessionType) {
 	case "redis":
-		session.Store = redisstore.New(c.RedisPool)
+		if c.RedisCluster != nil {
+			session.Store = NewRedisClusterStore(c.RedisCluster)
+		} else {
+			session.Store = redisstore.New(c.RedisPool)
+		}
+		index = NewRedisIndex(c.RedisPool, c.RedisCluster)
+	case "badger":
+		session.Store = NewBadgerStore(c.BadgerConn)
+		index = NewBadgerIndex(c.BadgerConn)
+	case "memory":
+		session.Store = NewMemoryStore(time.Minute)
 	case "mysql", "mariadb":
 		session.Store = mysqlstore.New(c.DBPool)
+		index = NewSQLIndex(c.DBPool, false)
 	case "postgres", "postgresql":
 		session.Store = postgresstore.New(c.DBPool)
+		index = NewSQLIndex(c.DBPool, true)
+	case "cookie":
+		// without keys sessions cannot be kept in cookies, so they are kept in memory
+		if store, err := NewCookieStore(c.CookieKeys...); err == nil {
+			session.Store = store
+			// sessions in cookies cannot be listed or revoked
+			return session
+		}
 	default:
-		// cookie
+		// memory
 	}
+	indexed := NewIndexedStore(session.Store, index, session.Codec)
+	indexed.ErrorLog = c.ErrorLog
+	session.Store = indexed
 
 	return session
 }
+
+// Guard returns middleware for sm which renews the session token when the RenewOn keys
+// change, and binds sessions to user agents if BindUserAgent is true. If RenewOn is empty,
+// the token is renewed when userID changes, that is on login and logout.
+func (c *Session) Guard(sm *scs.SessionManager) *Guard {
+	renewOn := []string{userIDKey}
+	if c.RenewOn != "" {
+		renewOn = nil
+		for _, key := range strings.Split(c.RenewOn, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				renewOn = append(renewOn, key)
+			}
+		}
+	}
+
+	return &Guard{
+		Manager:       sm,
+		RenewOn:       renewOn,
+		BindUserAgent: strings.ToLower(c.BindUserAgent) == "true",
+	}
+}
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -47,3 +48,43 @@ func TestSession_InitSession(t *testing.T) {
 	}
 
 }
+
+func TestSession_InitSessionMemory(t *testing.T) {
+	s := &Session{
+		CookieLifetime: "100",
+		CookieName:     "sokudo",
+		SessionType:    "memory",
+	}
+
+	ses := s.InitSession()
+
+	store, ok := ses.Store.(*IndexedStore)
+	if !ok {
+		t.Fatalf("sessions are not indexed: %T", ses.Store)
+	}
+
+	if _, ok := store.Store.(*MemoryStore); !ok {
+		t.Errorf("wrong store for memory sessions: %T", store.Store)
+	}
+
+	ctx, err := ses.Load(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ses.Put(ctx, userIDKey, 1)
+	if _, _, err := ses.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := 0
+	err = ses.Iterate(context.Background(), func(ctx context.Context) error {
+		sessions++
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if sessions != 1 {
+		t.Error("expected to iterate over 1 session, got", sessions)
+	}
+}
@@ -0,0 +1,210 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// Keys of the metadata that Track records in every session of a logged in user
+const (
+	userIDKey    = "userID"
+	createdKey   = "session_created_at"
+	lastSeenKey  = "session_last_seen"
+	ipKey        = "session_ip"
+	userAgentKey = "session_user_agent"
+)
+
+// lastSeenInterval is how often the last seen time of a session is updated. Updating it
+// on every request would write the session to the store on every request.
+const lastSeenInterval = time.Minute
+
+var (
+	// ErrNotIndexed is returned when the session store does not index sessions by user
+	ErrNotIndexed = errors.New("session store does not index sessions by user")
+	// ErrUnknownSession is returned by RevokeSession when the user has no session with the ID
+	ErrUnknownSession = errors.New("session not found")
+)
+
+// Info describes one of the sessions of a user
+type Info struct {
+	// ID identifies the session. It is derived from, but does not reveal, the session token,
+	// so it is safe to show to the user.
+	ID        string
+	UserID    int
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+// Track is middleware which records the IP address, user agent, and creation and last
+// seen times in the session of a logged in user, so that the sessions of a user can be
+// listed. It must run inside the LoadAndSave middleware of sm.
+func Track(sm *scs.SessionManager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sm.Exists(ctx, userIDKey) {
+			now := time.Now().Unix()
+			if !sm.Exists(ctx, createdKey) {
+				sm.Put(ctx, createdKey, now)
+			}
+
+			if now-sm.GetInt64(ctx, lastSeenKey) >= int64(lastSeenInterval/time.Second) {
+				sm.Put(ctx, lastSeenKey, now)
+				sm.Put(ctx, ipKey, remoteIP(r))
+				sm.Put(ctx, userAgentKey, r.UserAgent())
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListSessions returns the sessions of the user with userID, most recently seen first
+func ListSessions(sm *scs.SessionManager, userID int) ([]Info, error) {
+	sessions, err := userSessions(sm, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []Info
+	for token, values := range sessions {
+		infos = append(infos, sessionInfo(token, values))
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].LastSeen.After(infos[j].LastSeen)
+	})
+
+	return infos, nil
+}
+
+// RevokeSession ends the session with id, as returned by ListSessions, of the user with
+// userID. It returns ErrUnknownSession if the user has no such session, so that a user
+// cannot end the sessions of others.
+func RevokeSession(sm *scs.SessionManager, userID int, id string) error {
+	sessions, err := userSessions(sm, userID)
+	if err != nil {
+		return err
+	}
+
+	for token := range sessions {
+		if sessionID(token) == id {
+			return sm.Store.Delete(token)
+		}
+	}
+
+	return ErrUnknownSession
+}
+
+// RevokeAll ends every session of the user with userID, except the session whose token is
+// except, and returns how many sessions were ended. Pass the token of the current session,
+// from sm.Token, to log the user out everywhere else, or an empty string to log them out
+// everywhere.
+func RevokeAll(sm *scs.SessionManager, userID int, except string) (int, error) {
+	sessions, err := userSessions(sm, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for token := range sessions {
+		if token == except {
+			continue
+		}
+
+		if err := sm.Store.Delete(token); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+
+	return revoked, nil
+}
+
+// CurrentID returns the ID of the session of the request with ctx, as used by ListSessions,
+// so that the current session can be marked in a list of sessions
+func CurrentID(sm *scs.SessionManager, ctx context.Context) string {
+	token := sm.Token(ctx)
+	if token == "" {
+		return ""
+	}
+
+	return sessionID(token)
+}
+
+// userSessions returns the values of the sessions of the user with userID, by token, from
+// the index of the store of sm. Index entries of sessions which have ended, or which are
+// no longer the user's, are removed.
+func userSessions(sm *scs.SessionManager, userID int) (map[string]map[string]interface{}, error) {
+	store, ok := sm.Store.(*IndexedStore)
+	if !ok {
+		return nil, ErrNotIndexed
+	}
+
+	tokens, err := store.Index.Tokens(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make(map[string]map[string]interface{})
+	for _, token := range tokens {
+		b, found, err := store.Find(token)
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			_, values, err := sm.Codec.Decode(b)
+			if id, _ := values[userIDKey].(int); err == nil && id == userID {
+				sessions[token] = values
+				continue
+			}
+		}
+
+		if err := store.Index.Remove(userID, token); err != nil {
+			return nil, err
+		}
+	}
+
+	return sessions, nil
+}
+
+func sessionInfo(token string, values map[string]interface{}) Info {
+	info := Info{ID: sessionID(token)}
+	info.UserID, _ = values[userIDKey].(int)
+	info.IP, _ = values[ipKey].(string)
+	info.UserAgent, _ = values[userAgentKey].(string)
+	if created, ok := values[createdKey].(int64); ok {
+		info.CreatedAt = time.Unix(created, 0)
+	}
+	if lastSeen, ok := values[lastSeenKey].(int64); ok {
+		info.LastSeen = time.Unix(lastSeen, 0)
+	}
+
+	return info
+}
+
+// sessionID returns the ID of the session with token
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:12])
+}
+
+// remoteIP returns the IP address of the client that sent r
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,181 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// newIndexedManager returns a session manager whose sessions are indexed by user
+func newIndexedManager() *scs.SessionManager {
+	sm := scs.New()
+	sm.Store = NewIndexedStore(NewMemoryStore(0), NewMemoryIndex(), sm.Codec)
+	return sm
+}
+
+// login commits a session for userID to the store of sm, as if the user had logged in
+// from userAgent, and returns its token
+func login(t *testing.T, sm *scs.SessionManager, userID int, userAgent string) string {
+	var token string
+
+	handler := sm.LoadAndSave(Track(sm, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = sm.Token(r.Context())
+	})))
+
+	ctx, err := sm.Load(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Put(ctx, userIDKey, userID)
+	loginToken, _, err := sm.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", userAgent)
+	req.AddCookie(&http.Cookie{Name: sm.Cookie.Name, Value: loginToken})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	return token
+}
+
+func TestListSessions(t *testing.T) {
+	sm := newIndexedManager()
+
+	login(t, sm, 1, "laptop")
+	login(t, sm, 1, "phone")
+	login(t, sm, 2, "other")
+
+	sessions, err := ListSessions(sm, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatal("expected 2 sessions, got", len(sessions))
+	}
+
+	for _, info := range sessions {
+		if info.UserID != 1 || info.IP != "192.0.2.1" || info.CreatedAt.IsZero() || info.LastSeen.IsZero() {
+			t.Error("session metadata was not recorded:", info)
+		}
+		if info.UserAgent != "laptop" && info.UserAgent != "phone" {
+			t.Error("wrong user agent:", info.UserAgent)
+		}
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	sm := newIndexedManager()
+
+	login(t, sm, 1, "laptop")
+	phone := login(t, sm, 1, "phone")
+	other := login(t, sm, 2, "other")
+
+	err := RevokeSession(sm, 1, sessionID(other))
+	if err != ErrUnknownSession {
+		t.Error("expected ErrUnknownSession revoking the session of another user, got", err)
+	}
+
+	err = RevokeSession(sm, 1, sessionID(phone))
+	if err != nil {
+		t.Error(err)
+	}
+
+	sessions, _ := ListSessions(sm, 1)
+	if len(sessions) != 1 || sessions[0].UserAgent != "laptop" {
+		t.Error("wrong session revoked:", sessions)
+	}
+
+	sessions, _ = ListSessions(sm, 2)
+	if len(sessions) != 1 {
+		t.Error("the session of another user was revoked")
+	}
+}
+
+func TestRevokeAll(t *testing.T) {
+	sm := newIndexedManager()
+
+	current := login(t, sm, 1, "laptop")
+	login(t, sm, 1, "phone")
+	login(t, sm, 1, "tablet")
+	login(t, sm, 2, "other")
+
+	revoked, err := RevokeAll(sm, 1, current)
+	if err != nil {
+		t.Error(err)
+	}
+	if revoked != 2 {
+		t.Error("expected 2 sessions revoked, got", revoked)
+	}
+
+	sessions, _ := ListSessions(sm, 1)
+	if len(sessions) != 1 || sessions[0].ID != sessionID(current) {
+		t.Error("current session was not kept:", sessions)
+	}
+
+	sessions, _ = ListSessions(sm, 2)
+	if len(sessions) != 1 {
+		t.Error("sessions of another user were revoked")
+	}
+}
+
+func TestListSessions_NotIndexed(t *testing.T) {
+	sm := scs.New()
+	sm.Store = NewMemoryStore(0)
+
+	_, err := ListSessions(sm, 1)
+	if err != ErrNotIndexed {
+		t.Error("expected ErrNotIndexed, got", err)
+	}
+}
+
+func TestListSessions_StaleIndex(t *testing.T) {
+	sm := newIndexedManager()
+	store := sm.Store.(*IndexedStore)
+
+	token := login(t, sm, 1, "laptop")
+
+	// logging out without a new token leaves the token in the index
+	ctx, err := sm.Load(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Remove(ctx, userIDKey)
+	if _, _, err := sm.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, _ := ListSessions(sm, 1)
+	if len(sessions) != 0 {
+		t.Error("listed a session the user has logged out of:", sessions)
+	}
+
+	tokens, _ := store.Index.Tokens(1)
+	if len(tokens) != 0 {
+		t.Error("stale tokens were not removed from the index:", tokens)
+	}
+}
+
+func TestTrack_LastSeenThrottled(t *testing.T) {
+	sm := newIndexedManager()
+
+	token := login(t, sm, 1, "laptop")
+
+	var status scs.Status
+	handler := sm.LoadAndSave(Track(sm, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status = sm.Status(r.Context())
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: sm.Cookie.Name, Value: token})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if status != scs.Unmodified {
+		t.Error("session was modified within", lastSeenInterval, "of the last request")
+	}
+}
@@ -0,0 +1,36 @@
+package sokudo
+
+import (
+	"net/http"
+
+	"github.com/petrostrak/sokudo/session"
+)
+
+// ListSessions returns the sessions of the user with userID, most recently seen first
+func (s *Sokudo) ListSessions(userID int) ([]session.Info, error) {
+	return session.ListSessions(s.Session, userID)
+}
+
+// RevokeSession ends the session with id, as returned by ListSessions, of the user with
+// userID. It returns session.ErrUnknownSession if the session is not the user's.
+func (s *Sokudo) RevokeSession(userID int, id string) error {
+	return session.RevokeSession(s.Session, userID, id)
+}
+
+// RevokeAll ends every session of the user with userID, except the session of r, if r is
+// not nil, and returns how many sessions were ended. Call it after a password change, so
+// that anyone else using the old password is logged out.
+func (s *Sokudo) RevokeAll(userID int, r *http.Request) (int, error) {
+	except := ""
+	if r != nil {
+		except = s.Session.Token(r.Context())
+	}
+
+	return session.RevokeAll(s.Session, userID, except)
+}
+
+// CurrentSessionID returns the ID of the session of r, so that it can be marked in the
+// list returned by ListSessions
+func (s *Sokudo) CurrentSessionID(r *http.Request) string {
+	return session.CurrentID(s.Session, r.Context())
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"net/rpc"
 	"os"
 	"strconv"
@@ -16,14 +17,20 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/gomodule/redigo/redis"
 	"github.com/joho/godotenv"
+	"github.com/mna/redisc"
+	"github.com/petrostrak/sokudo/assets"
 	"github.com/petrostrak/sokudo/cache"
 	"github.com/petrostrak/sokudo/filesystems/miniofilesystem"
 	"github.com/petrostrak/sokudo/filesystems/s3filesystem"
 	"github.com/petrostrak/sokudo/filesystems/sftpfilesystem"
 	"github.com/petrostrak/sokudo/filesystems/webdavfilesystem"
+	"github.com/petrostrak/sokudo/i18n"
 	"github.com/petrostrak/sokudo/mailer"
+	"github.com/petrostrak/sokudo/outbox"
 	"github.com/petrostrak/sokudo/render"
 	"github.com/petrostrak/sokudo/session"
+	"github.com/petrostrak/sokudo/sse"
+	"github.com/petrostrak/sokudo/ws"
 	"github.com/robfig/cron/v3"
 )
 
@@ -35,6 +42,7 @@ var (
 	myRedisCache    *cache.RedisCache
 	myBadgerCache   *cache.BadgerCache
 	redisPool       *redis.Pool
+	redisCluster    *redisc.Cluster
 	badgerConn      *badger.DB
 	maintenanceMode bool
 )
@@ -51,19 +59,29 @@ type Sokudo struct {
 	Routes        *chi.Mux
 	Render        *render.Render
 	Session       *scs.SessionManager
+	sessionGuard  *session.Guard
 	DB            Database
 	JetViews      *jet.Set
 	config        config
 	EncryptionKey string
 	Cache         cache.Cache
+	Locker        cache.Locker
 	Scheduler     *cron.Cron
 	Mail          mailer.Mail
+	I18n          *i18n.Bundle
+	Events        *sse.Broker
+	WebSockets    *ws.Hub
+	Outbox        *outbox.Outbox
 	Server        Server
 	FileSystems   map[string]interface{}
 	S3            s3filesystem.S3
 	SFTP          sftpfilesystem.SFTP
 	WebDAV        webdavfilesystem.WebDAV
 	Minio         miniofilesystem.Minio
+
+	// TokenAuth returns the user of the API token in the Authorization header of a
+	// request, for authenticating WebSocket clients without a session
+	TokenAuth func(r *http.Request) (userID int, err error)
 }
 
 type Server struct {
@@ -78,9 +96,12 @@ type config struct {
 	renderer    string
 	cookie      cookieConfig
 	sessionType string
+	session     sessionConfig
 	database    databaseConfig
 	redis       redisConfig
 	uploads     uploadConfig
+	// localeURLPrefix detects the locale from a prefix of the url path, such as /el/
+	localeURLPrefix bool
 }
 
 type uploadConfig struct {
@@ -93,7 +114,7 @@ type uploadConfig struct {
 func (s *Sokudo) New(rootPath string) error {
 	pathConfig := initPaths{
 		rootPath:    rootPath,
-		folderNames: []string{"handlers", "migrations", "views", "mail", "data", "public", "tmp", "logs", "middleware"},
+		folderNames: []string{"handlers", "migrations", "views", "mail", "data", "public", "tmp", "logs", "middleware", "lang"},
 	}
 
 	err := s.Init(pathConfig)
@@ -115,6 +136,12 @@ func (s *Sokudo) New(rootPath string) error {
 	// create loggers
 	infoLog, errorLog := s.startLoggers()
 
+	s.InfoLog = infoLog
+	s.ErrorLog = errorLog
+	s.Debug, _ = strconv.ParseBool(os.Getenv("DEBUG"))
+	s.Version = version
+	s.RootPath = rootPath
+
 	// connect to database
 	if os.Getenv("DATABASE_TYPE") != "" {
 		db, err := s.OpenDB(os.Getenv("DATABASE_TYPE"), s.BuildDSN())
@@ -128,36 +155,6 @@ func (s *Sokudo) New(rootPath string) error {
 		}
 	}
 
-	scheduler := cron.New()
-	s.Scheduler = scheduler
-
-	if os.Getenv("CACHE") == "redis" || os.Getenv("SESSION_TYPE") == "redis" {
-		myRedisCache = s.createClientRedisCache()
-		s.Cache = myRedisCache
-		redisPool = myRedisCache.Conn
-	}
-
-	if os.Getenv("CACHE") == "badger" {
-		myBadgerCache = s.createClientBadgerCache()
-		s.Cache = myBadgerCache
-		badgerConn = myBadgerCache.Conn
-
-		_, err = s.Scheduler.AddFunc("@daily", func() {
-			_ = myBadgerCache.Conn.RunValueLogGC(0.7)
-		})
-		if err != nil {
-			return err
-		}
-	}
-
-	s.InfoLog = infoLog
-	s.ErrorLog = errorLog
-	s.Debug, _ = strconv.ParseBool(os.Getenv("DEBUG"))
-	s.Version = version
-	s.RootPath = rootPath
-	s.Mail = s.createMailer()
-	s.Routes = s.routes().(*chi.Mux)
-
 	// file uploads
 	exploded := strings.Split(os.Getenv("ALLOWED_FILETYPES"), ",")
 	var mimeTypes []string
@@ -178,26 +175,93 @@ func (s *Sokudo) New(rootPath string) error {
 		cookie: cookieConfig{
 			name:     os.Getenv("COOKIE_NAME"),
 			lifetime: os.Getenv("COOKIE_LIFETIME"),
-			persist:  os.Getenv("COOKIE_PERSISTS"),
+			persist:  os.Getenv("COOKIE_PERSIST"),
 			secure:   os.Getenv("COOKIE_SECURE"),
 			domain:   os.Getenv("COOKIE_DOMAIN"),
+			sameSite: os.Getenv("COOKIE_SAMESITE"),
 		},
 		sessionType: os.Getenv("SESSION_TYPE"),
+		session: sessionConfig{
+			idleTimeout:   os.Getenv("SESSION_IDLE_TIMEOUT"),
+			renewOn:       os.Getenv("SESSION_RENEW_ON"),
+			bindUserAgent: os.Getenv("SESSION_BIND_USER_AGENT"),
+		},
 		database: databaseConfig{
 			database: os.Getenv("DATABASE_TYPE"),
 			dsn:      s.BuildDSN(),
 		},
 		redis: redisConfig{
-			host:     os.Getenv("REDIS_HOST"),
-			password: os.Getenv("REDIS_PASSWORD"),
-			prefix:   os.Getenv("REDIS_PREFIX"),
+			mode:             os.Getenv("REDIS_MODE"),
+			host:             os.Getenv("REDIS_HOST"),
+			username:         os.Getenv("REDIS_USERNAME"),
+			password:         os.Getenv("REDIS_PASSWORD"),
+			prefix:           os.Getenv("REDIS_PREFIX"),
+			tls:              strings.ToLower(os.Getenv("REDIS_TLS")) == "true",
+			sentinelMaster:   os.Getenv("REDIS_SENTINEL_MASTER"),
+			sentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
 		},
 		uploads: uploadConfig{
 			maxUploadSize:    maxUploadSize,
 			allowedMimeTypes: mimeTypes,
 		},
+		localeURLPrefix: strings.ToLower(os.Getenv("LOCALE_URL_PREFIX")) == "true",
 	}
 
+	s.I18n, err = s.createI18n()
+	if err != nil {
+		return err
+	}
+
+	scheduler := cron.New()
+	s.Scheduler = scheduler
+
+	cacheEncoding, err := s.createCacheEncoding()
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv("CACHE") == "redis" || os.Getenv("CACHE") == "tiered" || os.Getenv("SESSION_TYPE") == "redis" {
+		myRedisCache = s.createClientRedisCache(cacheEncoding)
+		s.Cache = myRedisCache
+		redisPool = myRedisCache.Conn
+		redisCluster = myRedisCache.Cluster
+	}
+
+	if os.Getenv("CACHE") == "badger" || os.Getenv("SESSION_TYPE") == "badger" {
+		badgerConn, err = s.createBadgerConn()
+		if err != nil {
+			return err
+		}
+
+		err = s.scheduleBadgerGC(badgerConn)
+		if err != nil {
+			return err
+		}
+	}
+
+	if os.Getenv("CACHE") == "badger" {
+		myBadgerCache = s.createClientBadgerCache(cacheEncoding)
+		s.Cache = myBadgerCache
+	}
+
+	if os.Getenv("CACHE") == "memory" {
+		s.Cache = s.createClientMemoryCache()
+	}
+
+	if os.Getenv("CACHE") == "tiered" {
+		tieredCache := s.createClientTieredCache()
+		s.Cache = tieredCache
+		go tieredCache.ListenForInvalidations()
+	}
+
+	if locker, ok := s.Cache.(cache.Locker); ok {
+		s.Locker = locker
+	}
+
+	s.Mail = s.createMailer()
+	s.Events = s.createEventBroker()
+	s.WebSockets = s.createWebSocketHub()
+
 	secure := true
 	if strings.ToLower(os.Getenv("SECURE")) == "false" {
 		secure = false
@@ -212,24 +276,45 @@ func (s *Sokudo) New(rootPath string) error {
 
 	// create session
 
+	// session cookies must be secure when the application is served over https
+	cookieSecure := s.config.cookie.secure
+	if s.Server.Secure {
+		cookieSecure = "true"
+	}
+
 	sess := session.Session{
 		CookieLifetime: s.config.cookie.lifetime,
 		CookiePersist:  s.config.cookie.persist,
 		CookieName:     s.config.cookie.name,
 		SessionType:    s.config.sessionType,
 		CookieDomain:   s.config.cookie.domain,
+		CookieSecure:   cookieSecure,
+		CookieSameSite: s.config.cookie.sameSite,
+		IdleTimeout:    s.config.session.idleTimeout,
+		RenewOn:        s.config.session.renewOn,
+		BindUserAgent:  s.config.session.bindUserAgent,
+		CookieKeys:     append([]string{os.Getenv("KEY")}, strings.Split(os.Getenv("PREVIOUS_KEYS"), ",")...),
+		ErrorLog:       s.ErrorLog,
 	}
 
 	switch s.config.sessionType {
 	case "redis":
 		sess.RedisPool = myRedisCache.Conn
+		sess.RedisCluster = myRedisCache.Cluster
+	case "badger":
+		sess.BadgerConn = badgerConn
 	case "mysql", "postgres", "mariadb", "postgresql":
 		sess.DBPool = s.DB.Pool
 	}
 
 	s.Session = sess.InitSession()
+	s.sessionGuard = sess.Guard(s.Session)
 	s.EncryptionKey = os.Getenv("KEY")
 
+	// chi builds the middleware chain when the first route is mounted, so the routes are
+	// created once the session the middleware loads exists
+	s.Routes = s.routes().(*chi.Mux)
+
 	if s.Debug {
 		var views = jet.NewSet(
 			jet.NewOSFileSystemLoader(fmt.Sprintf("%s/views", rootPath)),
@@ -247,6 +332,14 @@ func (s *Sokudo) New(rootPath string) error {
 	s.FileSystems = s.createFileSystems()
 	go s.Mail.ListenForMail()
 
+	// deliver outbox messages in the background, if an interval (in seconds) is set
+	if s.DB.Pool != nil {
+		s.Outbox = s.createOutbox()
+		if interval, err := strconv.Atoi(os.Getenv("OUTBOX_INTERVAL")); err == nil && interval > 0 {
+			go s.Outbox.ListenForMessages(time.Duration(interval) * time.Second)
+		}
+	}
+
 	return nil
 }
 
@@ -283,13 +376,30 @@ func (s *Sokudo) startLoggers() (*log.Logger, *log.Logger) {
 
 func (s *Sokudo) createRenderer() {
 	myRenderer := render.Render{
-		Renderer: s.config.renderer,
-		RootPath: s.RootPath,
-		Port:     s.config.port,
-		JetViews: s.JetViews,
-		Session:  s.Session,
+		Renderer:   s.config.renderer,
+		RootPath:   s.RootPath,
+		Port:       s.config.port,
+		JetViews:   s.JetViews,
+		Session:    s.Session,
+		Debug:      s.Debug,
+		SigningKey: s.EncryptionKey,
 	}
 	s.Render = &myRenderer
+	s.Render.I18n = s.I18n
+	s.Render.AddDefaultFuncs()
+
+	manifest, err := assets.LoadManifest(s.RootPath + "/public")
+	if err != nil {
+		s.ErrorLog.Println("loading asset manifest:", err)
+	}
+	s.Render.Assets = manifest
+
+	// compile Go templates at startup, so that errors in them show up straight away
+	if s.config.renderer == "go" {
+		if err := s.Render.BuildTemplateCache(); err != nil {
+			s.ErrorLog.Println("building template cache:", err)
+		}
+	}
 }
 
 func (s *Sokudo) createMailer() mailer.Mail {
@@ -309,34 +419,126 @@ func (s *Sokudo) createMailer() mailer.Mail {
 		API:         os.Getenv("MAILER_API"),
 		APIKey:      os.Getenv("MAILER_KEY"),
 		APIUrl:      os.Getenv("MAILER_URL"),
+		I18n:        s.I18n,
 	}
 	return m
 }
 
-func (s *Sokudo) createClientRedisCache() *cache.RedisCache {
+// createI18n loads the translation catalogs in the lang folder, or returns nil if there
+// are none
+func (s *Sokudo) createI18n() (*i18n.Bundle, error) {
+	defaultLocale := os.Getenv("DEFAULT_LOCALE")
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+
+	bundle := i18n.New(defaultLocale)
+	err := bundle.LoadDir(s.RootPath + "/lang")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(bundle.Locales()) == 0 {
+		return nil, nil
+	}
+
+	return bundle, nil
+}
+
+// createOutbox creates an outbox in the application database, which delivers mail
+// using the application mailer, and webhooks using a default http client
+func (s *Sokudo) createOutbox() *outbox.Outbox {
+	o := outbox.New(s.DB.Pool, s.DB.DataType, s.ErrorLog)
+	o.Register(outbox.TopicMail, outbox.MailHandler(&s.Mail))
+	o.Register(outbox.TopicWebhook, outbox.WebhookHandler(&http.Client{Timeout: 10 * time.Second}))
+	return o
+}
+
+func (s *Sokudo) createClientRedisCache(encoding cache.Encoding) *cache.RedisCache {
 	cacheClient := cache.RedisCache{
-		Conn:   s.createRedisPool(),
-		Prefix: s.config.redis.prefix,
+		Prefix:   s.config.redis.prefix,
+		Encoding: encoding,
+	}
+
+	if s.config.redis.mode == "cluster" {
+		cacheClient.Cluster = s.createRedisCluster()
+	} else {
+		cacheClient.Conn = s.createRedisPool()
 	}
+
 	return &cacheClient
 }
 
-func (s *Sokudo) createClientBadgerCache() *cache.BadgerCache {
+func (s *Sokudo) createClientBadgerCache(encoding cache.Encoding) *cache.BadgerCache {
 	cacheClient := cache.BadgerCache{
-		Conn: s.createBadgerConn(),
+		Conn:     badgerConn,
+		Encoding: encoding,
 	}
 	return &cacheClient
 }
 
+// createCacheEncoding reads how the redis and badger caches store values from CACHE_CODEC
+// (gob, json or msgpack), CACHE_COMPRESSION (none, zstd or snappy) and CACHE_COMPRESS_ABOVE,
+// the size in bytes above which values are compressed (1024 by default)
+func (s *Sokudo) createCacheEncoding() (cache.Encoding, error) {
+	codec, err := cache.ParseCodec(os.Getenv("CACHE_CODEC"))
+	if err != nil {
+		return cache.Encoding{}, err
+	}
+
+	compression, err := cache.ParseCompression(os.Getenv("CACHE_COMPRESSION"))
+	if err != nil {
+		return cache.Encoding{}, err
+	}
+
+	compressAbove, err := strconv.Atoi(os.Getenv("CACHE_COMPRESS_ABOVE"))
+	if err != nil {
+		compressAbove = 1024
+	}
+
+	return cache.Encoding{
+		Codec:         codec,
+		Compression:   compression,
+		CompressAbove: compressAbove,
+	}, nil
+}
+
+// createClientMemoryCache creates a process-local cache, limited by CACHE_MAX_ENTRIES
+// entries (10000 by default) and CACHE_MAX_BYTES bytes (no limit by default)
+func (s *Sokudo) createClientMemoryCache() *cache.MemoryCache {
+	maxEntries, err := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES"))
+	if err != nil {
+		maxEntries = 10000
+	}
+
+	maxBytes, _ := strconv.ParseInt(os.Getenv("CACHE_MAX_BYTES"), 10, 64)
+
+	return cache.NewMemoryCache(maxEntries, maxBytes)
+}
+
+// createClientTieredCache puts a memory cache in front of the redis cache. Local copies
+// expire after CACHE_LOCAL_TTL seconds (60 by default)
+func (s *Sokudo) createClientTieredCache() *cache.TieredCache {
+	localTTL, err := strconv.Atoi(os.Getenv("CACHE_LOCAL_TTL"))
+	if err != nil {
+		localTTL = 60
+	}
+
+	return cache.NewTieredCache(s.createClientMemoryCache(), myRedisCache, localTTL)
+}
+
+// createRedisPool creates a pool of connections to REDIS_HOST or, when REDIS_MODE is
+// sentinel, to the current master of REDIS_SENTINEL_MASTER, as reported by the sentinels
+// listed in REDIS_HOST
 func (s *Sokudo) createRedisPool() *redis.Pool {
-	return &redis.Pool{
+	pool := &redis.Pool{
 		MaxIdle:     50,
 		MaxActive:   10000,
 		IdleTimeout: 240 * time.Second,
 		Dial: func() (redis.Conn, error) {
 			return redis.Dial("tcp",
 				s.config.redis.host,
-				redis.DialPassword(s.config.redis.password))
+				s.redisDialOptions()...)
 		},
 
 		TestOnBorrow: func(conn redis.Conn, t time.Time) error {
@@ -344,14 +546,143 @@ func (s *Sokudo) createRedisPool() *redis.Pool {
 			return err
 		},
 	}
+
+	if s.config.redis.mode == "sentinel" {
+		sentinel := &cache.Sentinel{
+			Addrs:       redisAddrs(s.config.redis.host),
+			MasterName:  s.config.redis.sentinelMaster,
+			DialOptions: s.redisSentinelDialOptions(),
+		}
+
+		pool.Dial = func() (redis.Conn, error) {
+			return sentinel.Dial(s.redisDialOptions()...)
+		}
+		pool.TestOnBorrow = sentinel.TestOnBorrow
+	}
+
+	return pool
+}
+
+// createRedisCluster creates a client for the redis cluster whose nodes, or some of
+// them, are listed in REDIS_HOST
+func (s *Sokudo) createRedisCluster() *redisc.Cluster {
+	cluster := &redisc.Cluster{
+		StartupNodes: redisAddrs(s.config.redis.host),
+		DialOptions:  s.redisDialOptions(),
+		CreatePool: func(address string, options ...redis.DialOption) (*redis.Pool, error) {
+			return &redis.Pool{
+				MaxIdle:     50,
+				MaxActive:   10000,
+				IdleTimeout: 240 * time.Second,
+				Dial: func() (redis.Conn, error) {
+					return redis.Dial("tcp", address, options...)
+				},
+			}, nil
+		},
+	}
+
+	// if the layout of the cluster cannot be loaded now, it is loaded on first use
+	_ = cluster.Refresh()
+
+	return cluster
+}
+
+// redisDialOptions returns the options used to connect to redis servers, with the ACL
+// username, password and TLS settings from .env
+func (s *Sokudo) redisDialOptions() []redis.DialOption {
+	return []redis.DialOption{
+		redis.DialUsername(s.config.redis.username),
+		redis.DialPassword(s.config.redis.password),
+		redis.DialUseTLS(s.config.redis.tls),
+	}
 }
 
-func (s *Sokudo) createBadgerConn() *badger.DB {
-	db, err := badger.Open(badger.DefaultOptions(s.RootPath + "/tmp/badger"))
+// redisSentinelDialOptions returns the options used to connect to sentinels, which have
+// their own password
+func (s *Sokudo) redisSentinelDialOptions() []redis.DialOption {
+	return []redis.DialOption{
+		redis.DialPassword(s.config.redis.sentinelPassword),
+		redis.DialUseTLS(s.config.redis.tls),
+	}
+}
+
+// redisAddrs splits a comma separated list of redis addresses
+func redisAddrs(hosts string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(hosts, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// createBadgerConn opens the badger database in BADGER_DIR (tmp/badger by default), or
+// in memory only if BADGER_IN_MEMORY is true. If BADGER_ENCRYPT is true, data is encrypted
+// at rest with the application KEY, which must be 16, 24 or 32 bytes long. The size of value
+// log files can be set with BADGER_VLOG_FILE_SIZE, in megabytes, and BADGER_VLOG_MAX_ENTRIES.
+func (s *Sokudo) createBadgerConn() (*badger.DB, error) {
+	dir := os.Getenv("BADGER_DIR")
+	if dir == "" {
+		dir = s.RootPath + "/tmp/badger"
+	}
+
+	opts := badger.DefaultOptions(dir)
+
+	if inMemory, _ := strconv.ParseBool(os.Getenv("BADGER_IN_MEMORY")); inMemory {
+		opts = opts.WithDir("").WithValueDir("").WithInMemory(true)
+	}
+
+	if encrypt, _ := strconv.ParseBool(os.Getenv("BADGER_ENCRYPT")); encrypt {
+		// badger needs an index cache to keep decrypted indexes when data is encrypted
+		opts = opts.WithEncryptionKey([]byte(os.Getenv("KEY"))).WithIndexCacheSize(100 << 20)
+	}
+
+	if size, err := strconv.ParseInt(os.Getenv("BADGER_VLOG_FILE_SIZE"), 10, 64); err == nil && size > 0 {
+		opts = opts.WithValueLogFileSize(size << 20)
+	}
+
+	if entries, err := strconv.ParseUint(os.Getenv("BADGER_VLOG_MAX_ENTRIES"), 10, 32); err == nil && entries > 0 {
+		opts = opts.WithValueLogMaxEntries(uint32(entries))
+	}
+
+	db, err := badger.Open(opts)
 	if err != nil {
+		return nil, fmt.Errorf("opening badger database: %w", err)
+	}
+
+	return db, nil
+}
+
+// scheduleBadgerGC collects garbage in the badger value log on the cron schedule in
+// BADGER_GC_SCHEDULE (daily by default), rewriting files in which at least
+// BADGER_GC_DISCARD_RATIO (0.7 by default) of the space can be reclaimed
+func (s *Sokudo) scheduleBadgerGC(db *badger.DB) error {
+	// there is no value log to collect in memory
+	if db.Opts().InMemory {
 		return nil
 	}
-	return db
+
+	schedule := os.Getenv("BADGER_GC_SCHEDULE")
+	if schedule == "" {
+		schedule = "@daily"
+	}
+
+	ratio, err := strconv.ParseFloat(os.Getenv("BADGER_GC_DISCARD_RATIO"), 64)
+	if err != nil || ratio <= 0 || ratio >= 1 {
+		ratio = 0.7
+	}
+
+	_, err = s.Scheduler.AddFunc(schedule, func() {
+		rewritten, err := cache.RunBadgerGC(db, ratio)
+		if err != nil {
+			s.ErrorLog.Println("badger gc:", err)
+			return
+		}
+		s.InfoLog.Printf("badger gc: rewrote %d value log files", rewritten)
+	})
+
+	return err
 }
 
 // BuildDSN builds the datasource name for our database, and returns it as a string
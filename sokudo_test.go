@@ -0,0 +1,136 @@
+package sokudo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestSokudo_New(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("SESSION_TYPE", "memory")
+	t.Setenv("COOKIE_NAME", "sokudo")
+	t.Setenv("COOKIE_LIFETIME", "1440")
+
+	err := os.MkdirAll(filepath.Join(root, "public"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(root, "public", "robots.txt"), []byte("User-agent: *"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Sokudo{}
+	if err := s.New(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Session == nil || s.Routes == nil {
+		t.Fatal("New did not create the session and routes")
+	}
+
+	w := httptest.NewRecorder()
+	s.Routes.ServeHTTP(w, httptest.NewRequest("GET", "/public/robots.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Error("static file not served:", w.Code)
+	}
+}
+
+func TestSokudo_createBadgerConnInMemory(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("BADGER_IN_MEMORY", "true")
+
+	s := &Sokudo{RootPath: root}
+	db, err := s.createBadgerConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if !db.Opts().InMemory {
+		t.Error("database is not in memory")
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "tmp", "badger")); !os.IsNotExist(err) {
+		t.Error("in-memory database wrote files:", err)
+	}
+}
+
+func TestSokudo_createBadgerConnEncrypted(t *testing.T) {
+	t.Setenv("BADGER_DIR", t.TempDir())
+	t.Setenv("BADGER_ENCRYPT", "true")
+	t.Setenv("KEY", "0123456789abcdef0123456789abcdef")
+
+	s := &Sokudo{}
+	db, err := s.createBadgerConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("key"), []byte("secret"))
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	_ = db.Close()
+
+	t.Setenv("BADGER_ENCRYPT", "false")
+	if db, err := s.createBadgerConn(); err == nil {
+		db.Close()
+		t.Error("opened an encrypted database without its key")
+	}
+
+	t.Setenv("BADGER_ENCRYPT", "true")
+	db, err = s.createBadgerConn()
+	if err != nil {
+		t.Fatal("could not reopen the encrypted database with its key:", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		if string(value) != "secret" {
+			t.Error("wrong value read back:", string(value))
+		}
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSokudo_createBadgerConnValueLog(t *testing.T) {
+	t.Setenv("BADGER_DIR", t.TempDir())
+	t.Setenv("BADGER_VLOG_FILE_SIZE", "16")
+	t.Setenv("BADGER_VLOG_MAX_ENTRIES", "5000")
+
+	s := &Sokudo{}
+	db, err := s.createBadgerConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if size := db.Opts().ValueLogFileSize; size != 16<<20 {
+		t.Error("expected value log files of 16MB, got", size)
+	}
+	if entries := db.Opts().ValueLogMaxEntries; entries != 5000 {
+		t.Error("expected at most 5000 entries in a value log file, got", entries)
+	}
+}
@@ -0,0 +1,169 @@
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PubSub carries published events between the instances of an application; the redis
+// cache implements it
+type PubSub interface {
+	Publish(channel string, data []byte) error
+	Subscribe(channel string, handle func(data []byte)) error
+}
+
+// pubSubChannel is the channel events are published on
+const pubSubChannel = "sse-events"
+
+// Broker delivers the events published to a topic to the streams subscribed to it. With
+// PubSub set, events are published through it, so that they reach the streams of every
+// instance of the application; Listen must then be running on every instance.
+type Broker struct {
+	// Heartbeat is how often idle streams get a heartbeat
+	Heartbeat time.Duration
+	// BufferSize is the number of events held for a subscriber which is slow to take them;
+	// further events are dropped until it catches up
+	BufferSize int
+	PubSub     PubSub
+
+	mu          sync.RWMutex
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+// NewBroker returns a broker which delivers events on this instance only, until PubSub is set
+func NewBroker() *Broker {
+	return &Broker{
+		Heartbeat:   15 * time.Second,
+		BufferSize:  16,
+		subscribers: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// UserTopic is the topic of the events for the user with userID
+func UserTopic(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// Subscription receives the events published to its topics on Events, until it is closed
+type Subscription struct {
+	Events <-chan Event
+
+	broker *Broker
+	topics []string
+	events chan Event
+	once   sync.Once
+}
+
+// Subscribe returns a subscription to the events published to topics
+func (b *Broker) Subscribe(topics ...string) *Subscription {
+	events := make(chan Event, b.BufferSize)
+	sub := &Subscription{Events: events, broker: b, topics: topics, events: events}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, topic := range topics {
+		if b.subscribers[topic] == nil {
+			b.subscribers[topic] = make(map[*Subscription]struct{})
+		}
+		b.subscribers[topic][sub] = struct{}{}
+	}
+
+	return sub
+}
+
+// Close stops the delivery of events to the subscription, and closes Events
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		b := s.broker
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		for _, topic := range s.topics {
+			delete(b.subscribers[topic], s)
+			if len(b.subscribers[topic]) == 0 {
+				delete(b.subscribers, topic)
+			}
+		}
+		close(s.events)
+	})
+}
+
+// published is an event published through PubSub
+type published struct {
+	Topic string `json:"topic"`
+	Event Event  `json:"event"`
+}
+
+// Publish sends e to the subscribers of topic
+func (b *Broker) Publish(topic string, e Event) error {
+	if b.PubSub == nil {
+		b.deliver(topic, e)
+		return nil
+	}
+
+	data, err := json.Marshal(published{Topic: topic, Event: e})
+	if err != nil {
+		return err
+	}
+
+	return b.PubSub.Publish(pubSubChannel, data)
+}
+
+// PublishToUser sends e to the streams of the user with userID
+func (b *Broker) PublishToUser(userID int, e Event) error {
+	return b.Publish(UserTopic(userID), e)
+}
+
+// deliver sends e to the subscribers of topic on this instance, skipping those whose
+// buffers are full
+func (b *Broker) deliver(topic string, e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers[topic] {
+		select {
+		case sub.events <- e:
+		default:
+		}
+	}
+}
+
+// ListenForEvents delivers the events published by every instance through PubSub. It
+// runs continually, resubscribing if the connection is lost, so it should be started in
+// its own goroutine.
+func (b *Broker) ListenForEvents() {
+	for {
+		_ = b.Listen()
+		time.Sleep(time.Second)
+	}
+}
+
+// Listen delivers the events published through PubSub, until its connection fails
+func (b *Broker) Listen() error {
+	return b.PubSub.Subscribe(pubSubChannel, func(data []byte) {
+		var msg published
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return
+		}
+
+		b.deliver(msg.Topic, msg.Event)
+	})
+}
+
+// Stream streams the events published to topics to the client of r, until it
+// disconnects, for example
+//
+//	func (h *Handlers) Notifications(w http.ResponseWriter, r *http.Request) {
+//		_ = h.App.Events.Stream(w, r, "announcements")
+//	}
+func (b *Broker) Stream(w http.ResponseWriter, r *http.Request, topics ...string) error {
+	sub := b.Subscribe(topics...)
+	defer sub.Close()
+
+	return Serve(w, r, sub.Events, b.Heartbeat)
+}
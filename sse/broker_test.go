@@ -0,0 +1,118 @@
+package sse
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPubSub stands in for redis, sharing published events between brokers
+type testPubSub struct {
+	mu       sync.Mutex
+	handlers []func([]byte)
+}
+
+func (p *testPubSub) Publish(channel string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, handle := range p.handlers {
+		handle(data)
+	}
+	return nil
+}
+
+func (p *testPubSub) Subscribe(channel string, handle func([]byte)) error {
+	p.mu.Lock()
+	p.handlers = append(p.handlers, handle)
+	p.mu.Unlock()
+
+	select {}
+}
+
+func receive(t *testing.T, sub *Subscription) (Event, bool) {
+	t.Helper()
+
+	select {
+	case e, ok := <-sub.Events:
+		return e, ok
+	case <-time.After(time.Second):
+		return Event{}, false
+	}
+}
+
+func TestBroker_Publish(t *testing.T) {
+	b := NewBroker()
+	news := b.Subscribe("news")
+	user := b.Subscribe("news", UserTopic(7))
+	defer news.Close()
+	defer user.Close()
+
+	_ = b.Publish("news", Event{Data: "extra"})
+	_ = b.PublishToUser(7, Event{Data: "hello 7"})
+	_ = b.PublishToUser(8, Event{Data: "hello 8"})
+
+	if e, _ := receive(t, news); e.Data != "extra" {
+		t.Error("news subscriber got", e.Data)
+	}
+	if e, _ := receive(t, user); e.Data != "extra" {
+		t.Error("user subscriber got", e.Data)
+	}
+	if e, _ := receive(t, user); e.Data != "hello 7" {
+		t.Error("user subscriber got", e.Data)
+	}
+	if len(user.Events) != 0 {
+		t.Error("user 7 got the event for user 8")
+	}
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	b.BufferSize = 1
+	sub := b.Subscribe("news")
+
+	_ = b.Publish("news", Event{Data: "one"})
+	_ = b.Publish("news", Event{Data: "two"})
+
+	if e, _ := receive(t, sub); e.Data != "one" {
+		t.Error("got", e.Data)
+	}
+	if len(sub.Events) != 0 {
+		t.Error("event delivered past the buffer")
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Events; ok {
+		t.Error("events not closed")
+	}
+	sub.Close()
+}
+
+func TestBroker_PubSub(t *testing.T) {
+	pubSub := &testPubSub{}
+	a, b := NewBroker(), NewBroker()
+	a.PubSub, b.PubSub = pubSub, pubSub
+	go a.ListenForEvents()
+	go b.ListenForEvents()
+
+	sub := b.Subscribe("news")
+	defer sub.Close()
+
+	// wait for both brokers to subscribe
+	for i := 0; i < 100; i++ {
+		pubSub.mu.Lock()
+		n := len(pubSub.handlers)
+		pubSub.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_ = a.Publish("news", Event{ID: "1", Name: "story", Data: "from a"})
+
+	e, ok := receive(t, sub)
+	if !ok || e.Data != "from a" || e.Name != "story" || e.ID != "1" {
+		t.Error("event not delivered across brokers:", e)
+	}
+}
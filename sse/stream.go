@@ -0,0 +1,152 @@
+// Package sse streams server-sent events to browsers, and publishes events to the
+// streams of every instance of an application through a broker.
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamingUnsupported is returned when the response writer cannot be flushed, so
+// events would not reach the client as they are sent
+var ErrStreamingUnsupported = errors.New("sse: streaming is not supported by the response writer")
+
+// Event is a server-sent event. Name is the type of the event, which browsers dispatch
+// to listeners added for it, or to onmessage if it is empty. Retry, in milliseconds, tells
+// the browser how long to wait before reconnecting after the stream is closed.
+type Event struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Data  string `json:"data"`
+	Retry int    `json:"retry,omitempty"`
+}
+
+// WriteTo writes e to w in the event stream format
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", singleLine(e.ID))
+	}
+	if e.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", singleLine(e.Name))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry)
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// singleLine removes line breaks, which would end a field
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// Stream sends events to a client. It is safe for concurrent use.
+type Stream struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// NewStream starts an event stream on w: it sets the headers of the response, and sends
+// them straight away, so that the client knows the stream is open
+func NewStream(w http.ResponseWriter) (*Stream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &Stream{w: w, flusher: flusher}, nil
+}
+
+// Send sends e to the client
+func (s *Stream) Send(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := e.WriteTo(s.w)
+	if err != nil {
+		return err
+	}
+	s.flusher.Flush()
+
+	return nil
+}
+
+// Heartbeat sends a comment, which clients ignore, so that proxies do not close an idle
+// stream, and a closed connection is noticed
+func (s *Stream) Heartbeat() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := io.WriteString(s.w, ": heartbeat\n\n")
+	if err != nil {
+		return err
+	}
+	s.flusher.Flush()
+
+	return nil
+}
+
+// Serve streams events to the client of r until events is closed or the client
+// disconnects, sending a heartbeat whenever there has been no event for heartbeat, if it
+// is positive. A client disconnecting is not an error.
+//
+// The server's WriteTimeout still applies to streams; browsers reconnect when it closes
+// one, and send the ID of the last event they received in the Last-Event-ID header.
+func Serve(w http.ResponseWriter, r *http.Request, events <-chan Event, heartbeat time.Duration) error {
+	stream, err := NewStream(w)
+	if err != nil {
+		return err
+	}
+
+	var ticker *time.Ticker
+	var ticks <-chan time.Time
+	if heartbeat > 0 {
+		ticker = time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+			// the event kept the stream busy, so the next heartbeat is due a full interval later
+			if ticker != nil {
+				ticker.Reset(heartbeat)
+			}
+		case <-ticks:
+			if err := stream.Heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
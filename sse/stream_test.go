@@ -0,0 +1,87 @@
+package sse
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvent_WriteTo(t *testing.T) {
+	var b strings.Builder
+	e := Event{ID: "7", Name: "update", Data: "line one\nline two", Retry: 3000}
+
+	_, err := e.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "id: 7\nevent: update\nretry: 3000\ndata: line one\ndata: line two\n\n"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/events", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	events := make(chan Event, 1)
+	events <- Event{Data: "hello"}
+
+	done := make(chan error)
+	go func() {
+		done <- Serve(w, r, events, 10*time.Millisecond)
+	}()
+
+	// let a heartbeat go out, then disconnect the client
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Error("wrong Content-Type:", w.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(w.Body.String(), "data: hello\n\n") {
+		t.Error("event not sent:", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), ": heartbeat\n\n") {
+		t.Error("no heartbeat sent")
+	}
+	if !w.Flushed {
+		t.Error("stream was not flushed")
+	}
+}
+
+func TestServe_NoHeartbeatWhileBusy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/events", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	events := make(chan Event)
+
+	done := make(chan error)
+	go func() {
+		done <- Serve(w, r, events, 100*time.Millisecond)
+	}()
+
+	// events more frequent than the heartbeat keep the stream busy
+	for i := 0; i < 15; i++ {
+		events <- Event{Data: "tick"}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	if strings.Contains(w.Body.String(), ": heartbeat\n\n") {
+		t.Error("heartbeat sent although events were being sent")
+	}
+}
@@ -17,6 +17,14 @@ type cookieConfig struct {
 	persist  string
 	secure   string
 	domain   string
+	sameSite string
+}
+
+// sessionConfig holds session config values
+type sessionConfig struct {
+	idleTimeout   string
+	renewOn       string
+	bindUserAgent string
 }
 
 type databaseConfig struct {
@@ -30,7 +38,12 @@ type Database struct {
 }
 
 type redisConfig struct {
-	host     string
-	password string
-	prefix   string
+	mode             string
+	host             string
+	username         string
+	password         string
+	prefix           string
+	tls              bool
+	sentinelMaster   string
+	sentinelPassword string
 }
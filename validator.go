@@ -8,18 +8,49 @@ import (
 	"time"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/petrostrak/sokudo/i18n"
 )
 
 type Validation struct {
 	Data   url.Values
 	Errors map[string]string
+	// Locale is the language of the error messages, which are looked up in the catalogs
+	// under validation.required, validation.email and so on, falling back to English
+	Locale string
+
+	i18n *i18n.Bundle
 }
 
 func (s *Sokudo) Validator(data url.Values) *Validation {
 	return &Validation{
 		Errors: make(map[string]string),
 		Data:   data,
+		i18n:   s.I18n,
+	}
+}
+
+// Localize sets the language of the error messages to the locale of r
+func (v *Validation) Localize(r *http.Request) *Validation {
+	v.Locale = i18n.Locale(r.Context())
+	return v
+}
+
+// message returns the translation of the message with key, or fallback if there is none
+func (v *Validation) message(key, fallback string) string {
+	if v.i18n == nil {
+		return fallback
 	}
+
+	locale := v.Locale
+	if locale == "" {
+		locale = v.i18n.DefaultLocale
+	}
+
+	if message := v.i18n.T(locale, key); message != key {
+		return message
+	}
+
+	return fallback
 }
 
 func (v *Validation) Valid() bool {
@@ -42,7 +73,7 @@ func (v *Validation) Required(r *http.Request, fields ...string) {
 	for _, field := range fields {
 		value := r.Form.Get(field)
 		if strings.TrimSpace(value) == "" {
-			v.AddError(field, "This field cannot be blank")
+			v.AddError(field, v.message("validation.required", "This field cannot be blank"))
 		}
 	}
 }
@@ -55,33 +86,33 @@ func (v *Validation) Check(ok bool, key, message string) {
 
 func (v *Validation) IsEmail(field, value string) {
 	if !govalidator.IsEmail(value) {
-		v.AddError(field, "Invalid email address")
+		v.AddError(field, v.message("validation.email", "Invalid email address"))
 	}
 }
 
 func (v *Validation) IsInt(field, value string) {
 	_, err := strconv.Atoi(value)
 	if err != nil {
-		v.AddError(field, "This field must be an integer")
+		v.AddError(field, v.message("validation.int", "This field must be an integer"))
 	}
 }
 
 func (v *Validation) IsFloat(field, value string) {
 	_, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		v.AddError(field, "This field must be a floating point number")
+		v.AddError(field, v.message("validation.float", "This field must be a floating point number"))
 	}
 }
 
 func (v *Validation) IsDateISO(field, value string) {
 	_, err := time.Parse("2006-01-02", value)
 	if err != nil {
-		v.AddError(field, "This field must be a date in the form of YYYY-MM-DD")
+		v.AddError(field, v.message("validation.date", "This field must be a date in the form of YYYY-MM-DD"))
 	}
 }
 
 func (v *Validation) NoSpaces(field, value string) {
 	if govalidator.HasWhitespace(value) {
-		v.AddError(field, "Spaces are not permitted")
+		v.AddError(field, v.message("validation.nospaces", "Spaces are not permitted"))
 	}
 }
@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrQueueFull is returned by Send when the client is not taking messages as fast as
+	// they are sent
+	ErrQueueFull = errors.New("ws: send queue is full")
+	// ErrClosed is returned by Send once the connection has closed
+	ErrClosed = errors.New("ws: connection is closed")
+)
+
+// Conn is a client's WebSocket connection. UserID is the user it authenticated as, or 0
+// for an anonymous client.
+type Conn struct {
+	UserID int
+
+	hub   *Hub
+	ws    *websocket.Conn
+	send  chan []byte
+	rooms map[string]struct{}
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+// Send queues data to be sent to the client as a text message. It does not wait for the
+// client: if the queue is full, ErrQueueFull is returned, and the caller may drop the
+// message or Close the connection.
+func (c *Conn) Send(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	select {
+	case c.send <- data:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Join adds the connection to room
+func (c *Conn) Join(room string) {
+	c.hub.Join(c, room)
+}
+
+// Leave removes the connection from room
+func (c *Conn) Leave(room string) {
+	c.hub.Leave(c, room)
+}
+
+// Close closes the connection, once the messages already queued have been sent
+func (c *Conn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// Done is closed once the connection has closed
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// readPump passes the messages from the client to OnMessage, until the connection fails
+// or the client stops answering pings
+func (c *Conn) readPump() {
+	defer func() {
+		c.Close()
+		c.hub.unregister(c)
+		// stop the write pump, if the client went away without closing the connection
+		_ = c.ws.Close()
+	}()
+
+	c.ws.SetReadLimit(c.hub.MaxMessageSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(c.hub.PongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(c.hub.PongWait))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if c.hub.OnMessage != nil {
+			c.hub.OnMessage(c, data)
+		}
+	}
+}
+
+// writePump sends the queued messages and pings to the client, and is the only writer to
+// the connection
+func (c *Conn) writePump() {
+	ticker := time.NewTicker(c.hub.PingInterval)
+	defer func() {
+		ticker.Stop()
+		_ = c.ws.Close()
+		close(c.done)
+		if c.hub.OnClose != nil {
+			c.hub.OnClose(c)
+		}
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(c.hub.WriteWait))
+			if !ok {
+				_ = c.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(c.hub.WriteWait))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// Handler upgrades requests to WebSocket connections, which it adds to Hub
+type Handler struct {
+	Hub *Hub
+	// Authenticate returns the user the request is from, or 0 for an anonymous client.
+	// An error rejects the request with 401 Unauthorized, as does an anonymous client
+	// unless AllowAnonymous is set.
+	Authenticate   func(r *http.Request) (userID int, err error)
+	AllowAnonymous bool
+	// CheckOrigin reports whether the page the request comes from may connect. By
+	// default only pages on the same host may, since browsers send the session cookie
+	// with requests from any site.
+	CheckOrigin func(r *http.Request) bool
+	// OnConnect is called with each new connection, for example to join it to rooms
+	OnConnect func(c *Conn, r *http.Request)
+}
+
+// ServeHTTP authenticates the client, upgrades the connection, and serves it until it
+// closes
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	if h.Authenticate != nil {
+		id, err := h.Authenticate(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		userID = id
+	}
+
+	if userID == 0 && !h.AllowAnonymous {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: h.CheckOrigin}
+	wsConn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has sent an error response
+		return
+	}
+
+	c := &Conn{
+		UserID: userID,
+		hub:    h.Hub,
+		ws:     wsConn,
+		send:   make(chan []byte, h.Hub.SendQueue),
+		rooms:  make(map[string]struct{}),
+		done:   make(chan struct{}),
+	}
+	h.Hub.register(c)
+
+	if h.OnConnect != nil {
+		h.OnConnect(c, r)
+	}
+
+	go c.writePump()
+	c.readPump()
+}
+
+// IsUpgrade reports whether r asks to be upgraded to a WebSocket connection
+func IsUpgrade(r *http.Request) bool {
+	return websocket.IsWebSocketUpgrade(r)
+}
@@ -0,0 +1,219 @@
+// Package ws keeps track of the WebSocket connections of an application, in rooms and by
+// user, and broadcasts messages to them on every instance of the application.
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// PubSub carries broadcasts between the instances of an application; the redis cache
+// implements it
+type PubSub interface {
+	Publish(channel string, data []byte) error
+	Subscribe(channel string, handle func(data []byte)) error
+}
+
+// pubSubChannel is the channel broadcasts are published on
+const pubSubChannel = "ws-broadcasts"
+
+// Hub holds the open connections. With PubSub set, broadcasts are published through it,
+// so that they reach the connections of every instance of the application;
+// ListenForBroadcasts must then be running on every instance.
+type Hub struct {
+	// SendQueue is the number of messages queued for a connection. A connection whose
+	// queue is full cannot keep up, and is closed rather than hold up its broadcasts.
+	SendQueue int
+	// PingInterval is how often connections are pinged; a connection which has not
+	// answered within PongWait is closed
+	PingInterval time.Duration
+	PongWait     time.Duration
+	// WriteWait is how long a write to a connection may take
+	WriteWait time.Duration
+	// MaxMessageSize is the largest message, in bytes, read from a client
+	MaxMessageSize int64
+	// OnMessage is called with every message a client sends, one at a time for each
+	// connection
+	OnMessage func(c *Conn, data []byte)
+	// OnClose is called when a connection has closed
+	OnClose func(c *Conn)
+	PubSub  PubSub
+
+	mu    sync.RWMutex
+	conns map[*Conn]struct{}
+	rooms map[string]map[*Conn]struct{}
+	users map[int]map[*Conn]struct{}
+}
+
+// NewHub returns a hub which broadcasts on this instance only, until PubSub is set
+func NewHub() *Hub {
+	return &Hub{
+		SendQueue:      64,
+		PingInterval:   50 * time.Second,
+		PongWait:       60 * time.Second,
+		WriteWait:      10 * time.Second,
+		MaxMessageSize: 64 * 1024,
+		conns:          make(map[*Conn]struct{}),
+		rooms:          make(map[string]map[*Conn]struct{}),
+		users:          make(map[int]map[*Conn]struct{}),
+	}
+}
+
+// Count returns the number of open connections on this instance
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.conns)
+}
+
+// Broadcast sends data to every connection
+func (h *Hub) Broadcast(data []byte) error {
+	return h.publish(broadcast{Data: data})
+}
+
+// BroadcastToRoom sends data to the connections which have joined room
+func (h *Hub) BroadcastToRoom(room string, data []byte) error {
+	return h.publish(broadcast{Room: room, Data: data})
+}
+
+// SendToUser sends data to the connections of the user with userID
+func (h *Hub) SendToUser(userID int, data []byte) error {
+	return h.publish(broadcast{UserID: userID, Data: data})
+}
+
+// broadcast is a message for every connection, the connections in Room, or those of
+// UserID
+type broadcast struct {
+	Room   string `json:"room,omitempty"`
+	UserID int    `json:"user_id,omitempty"`
+	Data   []byte `json:"data"`
+}
+
+func (h *Hub) publish(b broadcast) error {
+	if h.PubSub == nil {
+		h.deliver(b)
+		return nil
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	return h.PubSub.Publish(pubSubChannel, data)
+}
+
+// deliver queues a broadcast for its connections on this instance
+func (h *Hub) deliver(b broadcast) {
+	h.mu.RLock()
+	var conns []*Conn
+	switch {
+	case b.Room != "":
+		for c := range h.rooms[b.Room] {
+			conns = append(conns, c)
+		}
+	case b.UserID != 0:
+		for c := range h.users[b.UserID] {
+			conns = append(conns, c)
+		}
+	default:
+		for c := range h.conns {
+			conns = append(conns, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range conns {
+		if err := c.Send(b.Data); err == ErrQueueFull {
+			c.Close()
+		}
+	}
+}
+
+// ListenForBroadcasts delivers the broadcasts published by every instance through
+// PubSub. It runs continually, resubscribing if the connection is lost, so it should be
+// started in its own goroutine.
+func (h *Hub) ListenForBroadcasts() {
+	for {
+		_ = h.Listen()
+		time.Sleep(time.Second)
+	}
+}
+
+// Listen delivers the broadcasts published through PubSub, until its connection fails
+func (h *Hub) Listen() error {
+	return h.PubSub.Subscribe(pubSubChannel, func(data []byte) {
+		var b broadcast
+		if err := json.Unmarshal(data, &b); err != nil {
+			return
+		}
+
+		h.deliver(b)
+	})
+}
+
+// register adds c to the hub
+func (h *Hub) register(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.conns[c] = struct{}{}
+	if c.UserID != 0 {
+		if h.users[c.UserID] == nil {
+			h.users[c.UserID] = make(map[*Conn]struct{})
+		}
+		h.users[c.UserID][c] = struct{}{}
+	}
+}
+
+// unregister removes c, and its memberships of rooms, from the hub
+func (h *Hub) unregister(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.conns, c)
+
+	delete(h.users[c.UserID], c)
+	if len(h.users[c.UserID]) == 0 {
+		delete(h.users, c.UserID)
+	}
+
+	for room := range c.rooms {
+		h.removeFromRoom(c, room)
+	}
+}
+
+// Join adds c to room
+func (h *Hub) Join(c *Conn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, open := h.conns[c]; !open {
+		return
+	}
+
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Conn]struct{})
+	}
+	h.rooms[room][c] = struct{}{}
+	c.rooms[room] = struct{}{}
+}
+
+// Leave removes c from room
+func (h *Hub) Leave(c *Conn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeFromRoom(c, room)
+}
+
+// removeFromRoom removes c from room; the caller must hold the lock
+func (h *Hub) removeFromRoom(c *Conn, room string) {
+	delete(h.rooms[room], c)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+	delete(c.rooms, room)
+}
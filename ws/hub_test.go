@@ -0,0 +1,205 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testPubSub stands in for redis, sharing broadcasts between hubs
+type testPubSub struct {
+	mu       sync.Mutex
+	handlers []func([]byte)
+}
+
+func (p *testPubSub) Publish(channel string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, handle := range p.handlers {
+		handle(data)
+	}
+	return nil
+}
+
+func (p *testPubSub) Subscribe(channel string, handle func([]byte)) error {
+	p.mu.Lock()
+	p.handlers = append(p.handlers, handle)
+	p.mu.Unlock()
+
+	select {}
+}
+
+// testServer serves hub, authenticating clients by their user query parameter and
+// joining them to the room in their room query parameter
+func testServer(hub *Hub) *httptest.Server {
+	return httptest.NewServer(&Handler{
+		Hub: hub,
+		Authenticate: func(r *http.Request) (int, error) {
+			if r.URL.Query().Get("user") == "bad" {
+				return 0, errors.New("bad user")
+			}
+			id, _ := strconv.Atoi(r.URL.Query().Get("user"))
+			return id, nil
+		},
+		OnConnect: func(c *Conn, r *http.Request) {
+			if room := r.URL.Query().Get("room"); room != "" {
+				c.Join(room)
+			}
+		},
+	})
+}
+
+func dial(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func waitForCount(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Count() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d connections, got %d", n, hub.Count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func read(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestHandler_Authenticate(t *testing.T) {
+	srv := testServer(NewHub())
+	defer srv.Close()
+
+	for _, query := range []string{"", "user=bad"} {
+		_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?"+query, nil)
+		if err == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%q: client was not rejected", query)
+		}
+	}
+}
+
+func TestHub_Broadcast(t *testing.T) {
+	hub := NewHub()
+	srv := testServer(hub)
+	defer srv.Close()
+
+	alice := dial(t, srv, "user=1&room=sales")
+	bob := dial(t, srv, "user=2")
+	defer alice.Close()
+	defer bob.Close()
+	waitForCount(t, hub, 2)
+
+	_ = hub.BroadcastToRoom("sales", []byte("room"))
+	_ = hub.SendToUser(2, []byte("user"))
+	_ = hub.Broadcast([]byte("everyone"))
+
+	if got := read(t, alice); got != "room" {
+		t.Error("alice got", got)
+	}
+	if got := read(t, alice); got != "everyone" {
+		t.Error("alice got", got)
+	}
+	if got := read(t, bob); got != "user" {
+		t.Error("bob got", got)
+	}
+	if got := read(t, bob); got != "everyone" {
+		t.Error("bob got", got)
+	}
+
+	// closing the client removes the connection and its rooms
+	alice.Close()
+	waitForCount(t, hub, 1)
+	hub.mu.RLock()
+	rooms := len(hub.rooms)
+	hub.mu.RUnlock()
+	if rooms != 0 {
+		t.Error("room kept after its last connection closed")
+	}
+}
+
+func TestHub_OnMessage(t *testing.T) {
+	hub := NewHub()
+	hub.OnMessage = func(c *Conn, data []byte) {
+		_ = c.Send([]byte("echo: " + string(data)))
+	}
+	srv := testServer(hub)
+	defer srv.Close()
+
+	conn := dial(t, srv, "user=1")
+	defer conn.Close()
+
+	_ = conn.WriteMessage(websocket.TextMessage, []byte("hi"))
+	if got := read(t, conn); got != "echo: hi" {
+		t.Error("got", got)
+	}
+}
+
+func TestConn_Send(t *testing.T) {
+	c := &Conn{send: make(chan []byte, 1)}
+
+	if err := c.Send([]byte("one")); err != nil {
+		t.Error(err)
+	}
+	if err := c.Send([]byte("two")); err != ErrQueueFull {
+		t.Error("expected ErrQueueFull, got", err)
+	}
+
+	c.Close()
+	if err := c.Send([]byte("three")); err != ErrClosed {
+		t.Error("expected ErrClosed, got", err)
+	}
+}
+
+func TestHub_PubSub(t *testing.T) {
+	pubSub := &testPubSub{}
+	a, b := NewHub(), NewHub()
+	a.PubSub, b.PubSub = pubSub, pubSub
+	go a.ListenForBroadcasts()
+	go b.ListenForBroadcasts()
+
+	srv := testServer(b)
+	defer srv.Close()
+	conn := dial(t, srv, "user=3")
+	defer conn.Close()
+	waitForCount(t, b, 1)
+
+	// wait for both hubs to subscribe
+	for i := 0; i < 100; i++ {
+		pubSub.mu.Lock()
+		n := len(pubSub.handlers)
+		pubSub.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_ = a.SendToUser(3, []byte("from a"))
+	if got := read(t, conn); got != "from a" {
+		t.Error("got", got)
+	}
+}